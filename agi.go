@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -12,17 +13,47 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// ChannelState is the state of a channel as reported by CHANNEL STATUS.
+type ChannelState int
+
+const (
+	ChannelStateDown           ChannelState = 0 // Channel is down and available.
+	ChannelStateReserved       ChannelState = 1 // Channel is down, but reserved.
+	ChannelStateOffHook        ChannelState = 2 // Channel is off hook.
+	ChannelStateDialing        ChannelState = 3 // Digits (or equivalent) have been dialed.
+	ChannelStateRing           ChannelState = 4 // Line is ringing.
+	ChannelStateRinging        ChannelState = 5 // Remote end is ringing.
+	ChannelStateUp             ChannelState = 6 // Line is up.
+	ChannelStateBusy           ChannelState = 7 // Line is busy.
+	ChannelStateDialingOffHook ChannelState = 8 // Digits have been dialed while off hook.
+	ChannelStatePreRing        ChannelState = 9 // Channel detected an incoming call and is waiting for ring.
+)
+
 // AGI is used for the communication with asterisk by using AGI commands.
 type AGI struct {
 	scanner   *bufio.Scanner
+	writer    io.Writer
 	variables map[string]string
 	log       zerolog.Logger
 }
 
-// NewAGI returns an initialized agi instance.
+// NewAGI returns an initialized agi instance that communicates
+// with asterisk over stdin and stdout.
 func NewAGI(log zerolog.Logger) *AGI {
 	return &AGI{
 		scanner:   bufio.NewScanner(os.Stdin),
+		writer:    os.Stdout,
+		variables: map[string]string{},
+		log:       log,
+	}
+}
+
+// NewAGIConn returns an initialized agi instance that communicates
+// with asterisk over the given connection, e.g. a FastAGI TCP connection.
+func NewAGIConn(conn io.ReadWriter, log zerolog.Logger) *AGI {
+	return &AGI{
+		scanner:   bufio.NewScanner(conn),
+		writer:    conn,
 		variables: map[string]string{},
 		log:       log,
 	}
@@ -32,9 +63,6 @@ func NewAGI(log zerolog.Logger) *AGI {
 // starting the AGI program.
 func (a *AGI) ReadVariables() error {
 	for a.scanner.Scan() {
-		if err := a.scanner.Err(); err != nil {
-			return fmt.Errorf("reading AGI parameters: %w", err)
-		}
 		text := a.scanner.Text()
 		if text == "" {
 			break
@@ -45,61 +73,290 @@ func (a *AGI) ReadVariables() error {
 		}
 		a.variables[strings.TrimSpace(before)] = strings.TrimSpace(after)
 	}
+	if err := a.scanner.Err(); err != nil {
+		return fmt.Errorf("reading AGI parameters: %w", err)
+	}
 	return nil
 }
 
-// ReadDigit waits for user to enter a single digit.
-func (a *AGI) ReadDigit() (int, error) {
-	timeout := time.Second * 5
-
+// Command sends the given command with its arguments to asterisk and returns the parsed reply.
+// Arguments are quoted, so they may contain spaces.
+// If asterisk replies with an error code, the returned error is of type *AGIError.
+func (a *AGI) Command(command string, args ...string) (AGIResponse, error) {
 	var sb strings.Builder
+	sb.WriteString(command)
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		sb.WriteString(quoteAGIArgument(arg))
+	}
 
-	for {
-		a.log.Debug().
-			Int64("timeout_ms", timeout.Milliseconds()).
-			Msg("Waiting for digit with timeout")
+	a.log.Debug().Str("agi_command", sb.String()).Msg("Send AGI command")
 
-		fmt.Printf("WAIT FOR DIGIT %d\n", timeout.Milliseconds())
+	sb.WriteByte('\n')
+	if _, err := io.WriteString(a.writer, sb.String()); err != nil {
+		return AGIResponse{}, fmt.Errorf("send AGI command %s: %w", command, err)
+	}
 
-		a.scanner.Scan()
-		if err := a.scanner.Err(); err != nil {
-			return 0, fmt.Errorf("read stdin: %w", err)
+	resp, err := a.readResponse()
+	if err != nil {
+		return AGIResponse{}, fmt.Errorf("AGI command %s: %w", command, err)
+	}
+	return resp, nil
+}
+
+// readResponse reads and parses the reply to the last sent command.
+func (a *AGI) readResponse() (AGIResponse, error) {
+	line, err := a.readLine()
+	if err != nil {
+		return AGIResponse{}, err
+	}
+
+	// Asterisk announces a hangup on its own line before replying to the command.
+	for line == "HANGUP" {
+		a.log.Info().Msg("Asterisk reported that the channel was hung up")
+		if line, err = a.readLine(); err != nil {
+			return AGIResponse{}, err
 		}
-		text := a.scanner.Text()
-		_, after, ok := strings.Cut(text, "=")
-		if !ok {
-			return 0, fmt.Errorf("received invalid value from asterisk: %s", text)
+	}
+
+	prefix := strconv.Itoa(AGICodeInvalidUsage)
+	if !strings.HasPrefix(line, prefix+"-") {
+		return parseAGIResponse(line)
+	}
+
+	// Multi-line 520 reply, the usage is sent until the closing `520 ...` line.
+	aerr := &AGIError{
+		Code:    AGICodeInvalidUsage,
+		Message: strings.TrimPrefix(line, prefix+"-"),
+	}
+	var usage []string
+	for {
+		line, err := a.readLine()
+		if err != nil {
+			return AGIResponse{}, err
 		}
-		if after == "-1" {
-			return 0, fmt.Errorf("asterisk reported a channel failure")
+		if strings.HasPrefix(line, prefix+" ") {
+			break
 		}
-		if after == "0" {
-			continue
+		usage = append(usage, line)
+	}
+	aerr.Usage = strings.Join(usage, "\n")
+	return AGIResponse{}, aerr
+}
+
+// readLine reads a single line, failing if the input has been closed.
+func (a *AGI) readLine() (string, error) {
+	if !a.scanner.Scan() {
+		if err := a.scanner.Err(); err != nil {
+			return "", fmt.Errorf("read AGI reply: %w", err)
 		}
+		return "", errAGIHangup
+	}
+	return a.scanner.Text(), nil
+}
 
-		num, _ := strconv.ParseInt(after, 10, 32)
-		digit := rune(num)
+// resultDigit interprets the result of commands that may be interrupted by a digit.
+// A result of -1 means that the command failed and 0 means that no digit was pressed.
+func resultDigit(resp AGIResponse) (rune, error) {
+	n, err := resp.ResultInt()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("asterisk reported a channel failure")
+	}
+	return rune(n), nil
+}
 
-		if digit == '#' {
-			digits, _ := strconv.Atoi(sb.String())
-			a.log.Info().Int("digits", digits).Msg("Received final digits")
-			return digits, nil
+// Answer answers the channel if it is not already in the answered state.
+func (a *AGI) Answer() error {
+	resp, err := a.Command("ANSWER")
+	if err != nil {
+		return err
+	}
+	if resp.Result == "-1" {
+		return errors.New("asterisk failed to answer the channel")
+	}
+	return nil
+}
+
+// Hangup hangs up the current channel.
+func (a *AGI) Hangup() error {
+	resp, err := a.Command("HANGUP")
+	if err != nil {
+		return err
+	}
+	if resp.Result == "-1" {
+		return errors.New("asterisk failed to hang up the channel")
+	}
+	return nil
+}
+
+// StreamFile plays the given audio file, which must not contain the file extension.
+// Playback is interrupted when the caller presses one of the escape digits,
+// in which case the pressed digit is returned. Otherwise the returned digit is 0.
+func (a *AGI) StreamFile(file, escapeDigits string) (rune, error) {
+	resp, err := a.Command("STREAM FILE", file, escapeDigits)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Result == "-1" {
+		return 0, fmt.Errorf("asterisk failed to stream file %q", file)
+	}
+	return resultDigit(resp)
+}
+
+// GetData plays the given audio file and then collects up to maxDigits digits.
+// timedOut reports whether the caller stopped entering digits before pressing #.
+func (a *AGI) GetData(file string, timeout time.Duration, maxDigits int) (digits string, timedOut bool, err error) {
+	resp, err := a.Command(
+		"GET DATA",
+		file,
+		strconv.FormatInt(timeout.Milliseconds(), 10),
+		strconv.Itoa(maxDigits),
+	)
+	if err != nil {
+		return "", false, err
+	}
+	if resp.Result == "-1" {
+		return "", false, errors.New("asterisk reported a channel failure")
+	}
+	return resp.Result, resp.Data == "timeout", nil
+}
+
+// SayDigits speaks the given digits. See StreamFile for the escape digits.
+func (a *AGI) SayDigits(digits, escapeDigits string) (rune, error) {
+	resp, err := a.Command("SAY DIGITS", digits, escapeDigits)
+	if err != nil {
+		return 0, err
+	}
+	return resultDigit(resp)
+}
+
+// SayNumber speaks the given number. See StreamFile for the escape digits.
+func (a *AGI) SayNumber(number int, escapeDigits string) (rune, error) {
+	resp, err := a.Command("SAY NUMBER", strconv.Itoa(number), escapeDigits)
+	if err != nil {
+		return 0, err
+	}
+	return resultDigit(resp)
+}
+
+// GetVariable returns the value of the given channel variable.
+// ok is false if the variable is not set.
+func (a *AGI) GetVariable(name string) (value string, ok bool, err error) {
+	resp, err := a.Command("GET VARIABLE", name)
+	if err != nil {
+		return "", false, err
+	}
+	if resp.Result != "1" {
+		return "", false, nil
+	}
+	return resp.Data, true, nil
+}
+
+// SetVariable sets the given channel variable.
+func (a *AGI) SetVariable(name, value string) error {
+	_, err := a.Command("SET VARIABLE", name, value)
+	return err
+}
+
+// ChannelStatus returns the state of the given channel.
+// If channel is empty, the state of the current channel is returned.
+func (a *AGI) ChannelStatus(channel string) (ChannelState, error) {
+	var args []string
+	if channel != "" {
+		args = append(args, channel)
+	}
+	resp, err := a.Command("CHANNEL STATUS", args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := resp.ResultInt()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("channel %q does not exist", channel)
+	}
+	return ChannelState(n), nil
+}
+
+// Verbose logs the given message to the asterisk console with the given verbosity level.
+func (a *AGI) Verbose(message string, level int) error {
+	_, err := a.Command("VERBOSE", message, strconv.Itoa(level))
+	return err
+}
+
+// Exec executes the given dialplan application with the given arguments and
+// returns the result of the application.
+func (a *AGI) Exec(application string, args ...string) (int, error) {
+	cmdArgs := []string{application}
+	if len(args) > 0 {
+		cmdArgs = append(cmdArgs, strings.Join(args, ","))
+	}
+	resp, err := a.Command("EXEC", cmdArgs...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := resp.ResultInt()
+	if err != nil {
+		return 0, err
+	}
+	if n == -2 {
+		return 0, fmt.Errorf("dialplan application %q does not exist", application)
+	}
+	return n, nil
+}
+
+// WaitForDigit waits up to timeout for the caller to press a digit.
+// The returned digit is 0 if the timeout was reached.
+func (a *AGI) WaitForDigit(timeout time.Duration) (rune, error) {
+	resp, err := a.Command("WAIT FOR DIGIT", strconv.FormatInt(timeout.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	return resultDigit(resp)
+}
+
+// ReadInput collects the keys that the caller presses as described by the spec.
+func (a *AGI) ReadInput(spec InputSpec) (string, error) {
+	keys, err := spec.Read(func(timeout time.Duration) (rune, error) {
+		a.log.Debug().
+			Int64("timeout_ms", timeout.Milliseconds()).
+			Msg("Waiting for digit with timeout")
+
+		digit, err := a.WaitForDigit(timeout)
+		if err == nil && digit != 0 {
+			a.log.Debug().Str("digit", string(digit)).Msg("Received single digit")
 		}
+		return digit, err
+	})
+	if err != nil {
+		return "", err
+	}
+	a.log.Info().Str("digits", keys).Msg("Received final digits")
+	return keys, nil
+}
 
-		a.log.Debug().Str("digit", string(digit)).Msg("Received single digit")
-		sb.WriteRune(digit)
+// ReadDigit waits for the user to enter digits that are submitted with #,
+// see CodeInputSpec.
+func (a *AGI) ReadDigit() (int, error) {
+	keys, err := a.ReadInput(CodeInputSpec)
+	if err != nil {
+		return 0, err
+	}
+	digits, err := strconv.Atoi(keys)
+	if err != nil {
+		return 0, fmt.Errorf("input %q is not a number", keys)
 	}
+	return digits, nil
 }
 
 // StartAudioFork starts the asterisk-audio-fork extension which forks the audio stream
 // and then connects to the given websocket server sending the stream there.
-func (a *AGI) StartAudioFork(phoneNumber PhoneNumber) error {
-	fmt.Printf(
-		"EXEC AudioFork \"ws://localhost:8081/ws-audio?phoneNumber=\"%s\"\" \"r(0)\"\n",
-		phoneNumber,
-	)
-	a.scanner.Scan()
-	if err := a.scanner.Err(); err != nil {
+func (a *AGI) StartAudioFork(audioURL string) error {
+	if _, err := a.Exec("AudioFork", audioURL, "r(0)"); err != nil {
 		return fmt.Errorf("start asterisk audio fork: %w", err)
 	}
 	return nil
@@ -109,3 +366,10 @@ func (a *AGI) StartAudioFork(phoneNumber PhoneNumber) error {
 func (a *AGI) Get(variable string) string {
 	return a.variables[variable]
 }
+
+// quoteAGIArgument quotes the given argument so that asterisk treats it as a single argument.
+func quoteAGIArgument(arg string) string {
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
@@ -0,0 +1,116 @@
+package voipttt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Status codes asterisk uses when replying to an AGI command.
+const (
+	AGICodeSuccess        = 200
+	AGICodeInvalidCommand = 510
+	AGICodeDeadChannel    = 511
+	AGICodeInvalidUsage   = 520
+)
+
+// errAGIHangup is returned when the AGI stream ends, which asterisk closes once the channel
+// has been hung up.
+var errAGIHangup = errors.New("channel was hung up")
+
+// AGIError is returned when asterisk replies to an AGI command with an error code.
+type AGIError struct {
+	Code    int
+	Message string
+	// Usage contains the proper usage of the command that asterisk sends
+	// along with the multi-line 520 reply. It is empty for all other codes.
+	Usage string
+}
+
+func (e *AGIError) Error() string {
+	return fmt.Sprintf("agi error %d: %s", e.Code, e.Message)
+}
+
+// AGIResponse is a successful reply to an AGI command in the form
+// `200 result=N (data) key=value`.
+type AGIResponse struct {
+	Code   int
+	Result string
+	// Data is the optional value in parentheses, e.g. `timeout` or the value of a variable.
+	Data string
+	// Extra contains any further key value pairs, e.g. `endpos`.
+	Extra map[string]string
+}
+
+// ResultInt returns the result as an integer.
+func (r AGIResponse) ResultInt() (int, error) {
+	n, err := strconv.Atoi(r.Result)
+	if err != nil {
+		return 0, fmt.Errorf("agi result %q is not a number: %w", r.Result, err)
+	}
+	return n, nil
+}
+
+// parseAGIResponse parses a single line reply of asterisk.
+// The multi-line 520 reply is handled by the caller, as it requires further reads.
+func parseAGIResponse(line string) (AGIResponse, error) {
+	codeStr, rest, _ := strings.Cut(line, " ")
+	code, err := strconv.Atoi(codeStr)
+	if err != nil {
+		return AGIResponse{}, fmt.Errorf("unexpected format of AGI reply: %q", line)
+	}
+	if code != AGICodeSuccess {
+		return AGIResponse{}, &AGIError{Code: code, Message: strings.TrimSpace(rest)}
+	}
+
+	resp := AGIResponse{
+		Code:  code,
+		Extra: map[string]string{},
+	}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] == '(' {
+			end := closingParenthesis(rest)
+			if end < 0 {
+				return AGIResponse{}, fmt.Errorf("unbalanced parentheses in AGI reply: %q", line)
+			}
+			resp.Data = rest[1:end]
+			rest = rest[end+1:]
+			continue
+		}
+
+		token, after, _ := strings.Cut(rest, " ")
+		rest = after
+
+		key, value, ok := strings.Cut(token, "=")
+		if !ok {
+			return AGIResponse{}, fmt.Errorf("unexpected token %q in AGI reply: %q", token, line)
+		}
+		if key == "result" {
+			resp.Result = value
+		} else {
+			resp.Extra[key] = value
+		}
+	}
+
+	return resp, nil
+}
+
+// closingParenthesis returns the index of the parenthesis that closes
+// the one at the start of s, or -1 if there is none.
+func closingParenthesis(s string) int {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,204 @@
+package voipttt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseAGIResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		want  AGIResponse
+		code  int // Code of the expected *AGIError, 0 if no error is expected.
+		isErr bool
+	}{
+		{
+			name: "success",
+			line: "200 result=1",
+			want: AGIResponse{Code: 200, Result: "1", Extra: map[string]string{}},
+		},
+		{
+			name: "failure result",
+			line: "200 result=-1",
+			want: AGIResponse{Code: 200, Result: "-1", Extra: map[string]string{}},
+		},
+		{
+			name: "timeout",
+			line: "200 result=0 (timeout)",
+			want: AGIResponse{Code: 200, Result: "0", Data: "timeout", Extra: map[string]string{}},
+		},
+		{
+			name: "endpos",
+			line: "200 result=0 endpos=8000",
+			want: AGIResponse{Code: 200, Result: "0", Extra: map[string]string{"endpos": "8000"}},
+		},
+		{
+			name: "data with parentheses",
+			line: "200 result=1 (a (b) c) endpos=12",
+			want: AGIResponse{Code: 200, Result: "1", Data: "a (b) c", Extra: map[string]string{"endpos": "12"}},
+		},
+		{
+			name: "data with spaces",
+			line: "200 result=1 (Hello World)",
+			want: AGIResponse{Code: 200, Result: "1", Data: "Hello World", Extra: map[string]string{}},
+		},
+		{
+			name: "invalid command",
+			line: "510 Invalid or unknown command",
+			code: AGICodeInvalidCommand,
+		},
+		{
+			name: "dead channel",
+			line: "511 Command Not Permitted on a dead channel",
+			code: AGICodeDeadChannel,
+		},
+		{
+			name:  "unbalanced parentheses",
+			line:  "200 result=1 (timeout",
+			isErr: true,
+		},
+		{
+			name:  "no code",
+			line:  "result=1",
+			isErr: true,
+		},
+		{
+			name:  "token without value",
+			line:  "200 result=1 foo",
+			isErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAGIResponse(tt.line)
+			var aerr *AGIError
+			switch {
+			case tt.code != 0:
+				if !errors.As(err, &aerr) || aerr.Code != tt.code {
+					t.Fatalf("got error %v, want AGI error %d", err, tt.code)
+				}
+			case tt.isErr:
+				if err == nil || errors.As(err, &aerr) {
+					t.Fatalf("got error %v, want format error", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			default:
+				if got.Code != tt.want.Code || got.Result != tt.want.Result || got.Data != tt.want.Data ||
+					!equalStringMaps(got.Extra, tt.want.Extra) {
+					t.Fatalf("got %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAGIReadResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		result string
+		usage  string // Usage of the expected 520 error.
+		hangup bool
+	}{
+		{
+			name:   "single line",
+			input:  "200 result=1\n",
+			result: "1",
+		},
+		{
+			name:   "hangup before reply",
+			input:  "HANGUP\n200 result=-1\n",
+			result: "-1",
+		},
+		{
+			name:  "multi-line usage",
+			input: "520-Invalid command syntax.  Proper usage follows:\nUsage: ANSWER\n Answers channel.\n520 End of proper usage.\n",
+			usage: "Usage: ANSWER\n Answers channel.",
+		},
+		{
+			name:   "end of stream",
+			input:  "",
+			hangup: true,
+		},
+		{
+			name:   "end of stream after hangup",
+			input:  "HANGUP\n",
+			hangup: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeAGIConn{Reader: strings.NewReader(tt.input)}
+			a := NewAGIConn(conn, zerolog.Nop())
+			resp, err := a.Command("ANSWER")
+
+			if got := conn.written.String(); got != "ANSWER\n" {
+				t.Errorf("sent %q, want %q", got, "ANSWER\n")
+			}
+			var aerr *AGIError
+			switch {
+			case tt.hangup:
+				if !errors.Is(err, errAGIHangup) {
+					t.Fatalf("got error %v, want %v", err, errAGIHangup)
+				}
+			case tt.usage != "":
+				if !errors.As(err, &aerr) || aerr.Code != AGICodeInvalidUsage || aerr.Usage != tt.usage {
+					t.Fatalf("got error %#v, want usage %q", err, tt.usage)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case resp.Result != tt.result:
+				t.Fatalf("got result %q, want %q", resp.Result, tt.result)
+			}
+		})
+	}
+}
+
+func TestResultDigit(t *testing.T) {
+	tests := []struct {
+		result string
+		want   rune
+		isErr  bool
+	}{
+		{result: "53", want: '5'},
+		{result: "0", want: 0},
+		{result: "-1", isErr: true},
+		{result: "x", isErr: true},
+	}
+	for _, tt := range tests {
+		got, err := resultDigit(AGIResponse{Code: AGICodeSuccess, Result: tt.result})
+		if (err != nil) != tt.isErr || got != tt.want {
+			t.Errorf("resultDigit(%q) = %q, %v", tt.result, got, err)
+		}
+	}
+}
+
+// fakeAGIConn replays the replies of asterisk and records the sent commands.
+type fakeAGIConn struct {
+	*strings.Reader
+	written bytes.Buffer
+}
+
+func (c *fakeAGIConn) Write(p []byte) (int, error) {
+	return c.written.Write(p)
+}
+
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,304 @@
+// Package ami implements a client for the Asterisk Manager Interface (AMI)
+// which is used to receive call events and to control calls.
+package ami
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned for actions that could not complete because
+// the connection to asterisk was closed.
+var ErrClosed = errors.New("ami connection closed")
+
+// Message is a single AMI message, i.e. a response or an event,
+// consisting of its key value pairs.
+type Message map[string]string
+
+// Get returns the value of the given key, ignoring the case of the key.
+func (m Message) Get(key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Event is a message that asterisk sends on its own, e.g. when a channel hangs up.
+type Event Message
+
+// Name returns the name of the event, e.g. `Hangup`.
+func (e Event) Name() string {
+	return Message(e).Get("Event")
+}
+
+// Get returns the value of the given key, ignoring the case of the key.
+func (e Event) Get(key string) string {
+	return Message(e).Get(key)
+}
+
+// Names of the events that are used by this project.
+const (
+	EventNewchannel = "Newchannel"
+	EventHangup     = "Hangup"
+	EventDTMFEnd    = "DTMFEnd"
+)
+
+// ActionError is returned when asterisk responds to an action with an error.
+type ActionError struct {
+	Action  string
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("ami action %s failed: %s", e.Action, e.Message)
+}
+
+type subscription struct {
+	names   map[string]bool
+	handler func(Event)
+}
+
+// Client is a connection to the asterisk manager interface.
+// Each method is concurrency safe.
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+
+	actionCounter atomic.Uint64
+	pending       map[string]chan Message
+	pendingMu     sync.Mutex
+
+	subscriptions   []subscription
+	subscriptionsMu sync.Mutex
+	events          chan Event
+
+	done    chan struct{}
+	readErr error
+}
+
+// Dial connects to the asterisk manager interface at the given address.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial ami: %w", err)
+	}
+	c, err := NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient returns a client that communicates over the given connection.
+// It reads the greeting of asterisk and then starts receiving messages.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		pending: map[string]chan Message{},
+		events:  make(chan Event, 256),
+		done:    make(chan struct{}),
+	}
+
+	greeting, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read ami greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "Asterisk Call Manager") {
+		return nil, fmt.Errorf("unexpected ami greeting: %q", strings.TrimSpace(greeting))
+	}
+
+	go c.readLoop()
+	go c.dispatchEvents()
+
+	return c, nil
+}
+
+// Login authenticates with the given credentials.
+// eventMask selects which classes of events asterisk should send, e.g. `call,dtmf`.
+func (c *Client) Login(ctx context.Context, username, secret, eventMask string) error {
+	if eventMask == "" {
+		eventMask = "off"
+	}
+	_, err := c.Action(ctx, "Login", Message{
+		"Username": username,
+		"Secret":   secret,
+		"Events":   eventMask,
+	})
+	return err
+}
+
+// Logoff ends the session gracefully.
+func (c *Client) Logoff(ctx context.Context) error {
+	_, err := c.Action(ctx, "Logoff", nil)
+	return err
+}
+
+// Hangup hangs up the given channel.
+func (c *Client) Hangup(ctx context.Context, channel string) error {
+	_, err := c.Action(ctx, "Hangup", Message{"Channel": channel})
+	return err
+}
+
+// Action sends the action with the given fields and waits for its response.
+// If asterisk responds with an error, the returned error is of type *ActionError.
+func (c *Client) Action(ctx context.Context, action string, fields Message) (Message, error) {
+	id := strconv.FormatUint(c.actionCounter.Add(1), 10)
+	respCh := make(chan Message, 1)
+
+	c.pendingMu.Lock()
+	c.pending[id] = respCh
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Action: %s\r\nActionID: %s\r\n", action, id)
+	for k, v := range fields {
+		fmt.Fprintf(&sb, "%s: %s\r\n", k, v)
+	}
+	sb.WriteString("\r\n")
+
+	c.writeMu.Lock()
+	_, err := io.WriteString(c.conn, sb.String())
+	c.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("send ami action %s: %w", action, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, fmt.Errorf("ami action %s: %w", action, ErrClosed)
+	case resp := <-respCh:
+		if !strings.EqualFold(resp.Get("Response"), "Success") &&
+			!strings.EqualFold(resp.Get("Response"), "Goodbye") {
+			return resp, &ActionError{Action: action, Message: resp.Get("Message")}
+		}
+		return resp, nil
+	}
+}
+
+// Subscribe calls the handler for each received event with one of the given names.
+// If no names are given, the handler is called for all events.
+// Handlers are called sequentially from a single goroutine, so they should not block.
+func (c *Client) Subscribe(handler func(Event), names ...string) {
+	sub := subscription{
+		names:   map[string]bool{},
+		handler: handler,
+	}
+	for _, name := range names {
+		sub.names[strings.ToLower(name)] = true
+	}
+	c.subscriptionsMu.Lock()
+	c.subscriptions = append(c.subscriptions, sub)
+	c.subscriptionsMu.Unlock()
+}
+
+// Done returns a channel that is closed when the connection to asterisk is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason why the connection was lost, once Done is closed.
+func (c *Client) Err() error {
+	<-c.done
+	return c.readErr
+}
+
+// Close closes the connection to asterisk.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// readLoop reads all incoming messages and routes them to the waiting actions
+// or the event subscribers.
+func (c *Client) readLoop() {
+	defer close(c.events)
+	defer close(c.done)
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+
+		if _, ok := msg["Event"]; ok {
+			c.events <- Event(msg)
+			continue
+		}
+
+		id := msg.Get("ActionID")
+		c.pendingMu.Lock()
+		respCh, ok := c.pending[id]
+		c.pendingMu.Unlock()
+		if ok {
+			respCh <- msg
+		}
+	}
+}
+
+// readMessage reads a single message which is terminated by an empty line.
+func (c *Client) readMessage() (Message, error) {
+	msg := Message{}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read ami message: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(msg) == 0 {
+				// Tolerate superfluous empty lines between messages.
+				continue
+			}
+			return msg, nil
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			// Some responses, e.g. for the Command action, contain raw output lines.
+			continue
+		}
+		msg[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+}
+
+// dispatchEvents calls the subscribed handlers for all events.
+// This is decoupled from reading, so that handlers can send actions themselves.
+func (c *Client) dispatchEvents() {
+	for event := range c.events {
+		name := strings.ToLower(event.Name())
+
+		c.subscriptionsMu.Lock()
+		subs := c.subscriptions
+		c.subscriptionsMu.Unlock()
+
+		for _, sub := range subs {
+			if len(sub.names) == 0 || sub.names[name] {
+				sub.handler(event)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package ami
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is a local AMI server that answers actions with scripted responses.
+type fakeServer struct {
+	listener net.Listener
+	conns    chan *fakeConn
+}
+
+// fakeConn is the server side of a single AMI connection.
+type fakeConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: l, conns: make(chan *fakeConn, 1)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			if _, err := conn.Write([]byte("Asterisk Call Manager/5.0.2\r\n")); err != nil {
+				return
+			}
+			s.conns <- &fakeConn{conn: conn, reader: bufio.NewReader(conn)}
+		}
+	}()
+	return s
+}
+
+// accept returns the next connection of a client.
+func (s *fakeServer) accept(t *testing.T) *fakeConn {
+	t.Helper()
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(time.Second * 5):
+		t.Fatal("client did not connect")
+		return nil
+	}
+}
+
+// readAction reads the next action sent by the client.
+func (c *fakeConn) readAction(t *testing.T) Message {
+	t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	msg := Message{}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read action: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return msg
+		}
+		key, value, _ := strings.Cut(line, ": ")
+		msg[key] = value
+	}
+}
+
+// send writes a message with the given key value pairs, in order.
+func (c *fakeConn) send(t *testing.T, pairs ...string) {
+	t.Helper()
+	var sb strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(&sb, "%s: %s\r\n", pairs[i], pairs[i+1])
+	}
+	sb.WriteString("\r\n")
+	if _, err := c.conn.Write([]byte(sb.String())); err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+}
+
+func TestClientLoginAndEvents(t *testing.T) {
+	server := newFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := Dial(ctx, server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn := server.accept(t)
+
+	events := make(chan Event, 10)
+	client.Subscribe(func(e Event) { events <- e }, EventNewchannel, EventHangup)
+
+	loginErr := make(chan error, 1)
+	go func() { loginErr <- client.Login(ctx, "vt", "secret", "call") }()
+
+	login := conn.readAction(t)
+	if login["Action"] != "Login" || login["Username"] != "vt" || login["Secret"] != "secret" || login["Events"] != "call" {
+		t.Fatalf("unexpected login action: %v", login)
+	}
+	conn.send(t, "Response", "Success", "ActionID", login["ActionID"], "Message", "Authentication accepted")
+	if err := <-loginErr; err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	conn.send(t, "Event", "Newchannel", "Channel", "SIP/100-00000001", "CallerIDNum", "100")
+	conn.send(t, "Event", "DTMFEnd", "Channel", "SIP/100-00000001", "Digit", "5")
+	conn.send(t, "Event", "Hangup", "Channel", "SIP/100-00000001", "Cause-txt", "Normal Clearing")
+
+	for _, want := range []string{EventNewchannel, EventHangup} {
+		select {
+		case e := <-events:
+			if e.Name() != want || e.Get("channel") != "SIP/100-00000001" {
+				t.Fatalf("got event %v, want %s", e, want)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("did not receive %s", want)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("received event that was not subscribed: %v", e)
+	default:
+	}
+}
+
+func TestClientActionMatchesResponsesByID(t *testing.T) {
+	server := newFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := Dial(ctx, server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn := server.accept(t)
+
+	type result struct {
+		channel string
+		err     error
+	}
+	results := make(chan result, 2)
+	hangup := func(channel string) {
+		resp, err := client.Action(ctx, "Hangup", Message{"Channel": channel})
+		results <- result{channel: channel + "=" + resp.Get("Message"), err: err}
+	}
+
+	go hangup("SIP/1")
+	first := conn.readAction(t)
+	go hangup("SIP/2")
+	second := conn.readAction(t)
+	if first["ActionID"] == second["ActionID"] {
+		t.Fatalf("actions share the ActionID %s", first["ActionID"])
+	}
+
+	// Respond in reverse order, with an event in between.
+	conn.send(t, "Response", "Success", "ActionID", second["ActionID"], "Message", second["Channel"])
+	conn.send(t, "Event", "Newchannel", "Channel", "SIP/3")
+	conn.send(t, "Response", "Success", "ActionID", first["ActionID"], "Message", first["Channel"])
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("action failed: %v", r.err)
+		}
+		got[r.channel] = true
+	}
+	if !got["SIP/1=SIP/1"] || !got["SIP/2=SIP/2"] {
+		t.Fatalf("responses were not matched to their actions: %v", got)
+	}
+}
+
+func TestClientActionError(t *testing.T) {
+	server := newFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := Dial(ctx, server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn := server.accept(t)
+
+	errs := make(chan error, 1)
+	go func() { errs <- client.Hangup(ctx, "SIP/1") }()
+	action := conn.readAction(t)
+	conn.send(t, "Response", "Error", "ActionID", action["ActionID"], "Message", "No such channel")
+
+	var aerr *ActionError
+	if err := <-errs; !errors.As(err, &aerr) || aerr.Action != "Hangup" || aerr.Message != "No such channel" {
+		t.Fatalf("got error %v, want action error", err)
+	}
+
+	// Pending actions fail once the connection is lost.
+	go func() { errs <- client.Logoff(ctx) }()
+	conn.readAction(t)
+	_ = conn.conn.Close()
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Fatalf("got error %v, want %v", err, ErrClosed)
+	}
+	<-client.Done()
+	if client.Err() == nil {
+		t.Fatal("lost connection has no error")
+	}
+}
+
+func TestNewClientRejectsUnknownGreeting(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	go func() { _, _ = server.Write([]byte("SSH-2.0-OpenSSH\r\n")) }()
+	if _, err := NewClient(client); err == nil {
+		t.Fatal("accepted unknown greeting")
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/n9v9/voip-ttt/audio"
 )
 
 //go:embed frontend
@@ -21,6 +23,10 @@ var frontend embed.FS
 // clients, confirm their verification code and setup webhooks for further communication.
 const RoutePrivateAPIRegister = "/register"
 
+// RoutePrivateAPIAudio is the web socket route used by the private API to receive
+// the audio stream of a caller.
+const RoutePrivateAPIAudio = "/ws-audio"
+
 // privateAPI is a REST API that is used by internal services
 // to register a calling client to create a connection between the clients
 // web socket connections and its phone number.
@@ -43,7 +49,7 @@ func newPrivate(wsManager *webSocketManager) *privateAPI {
 func (pa *privateAPI) routes() {
 	RegisterHTTPMiddleware(pa.mux)
 	pa.mux.Post(RoutePrivateAPIRegister, pa.registerClient())
-	pa.mux.Get("/ws-audio", pa.handleAudioStream())
+	pa.mux.Get(RoutePrivateAPIAudio, pa.handleAudioStream())
 }
 
 // registerClient tries to verify a previously generated verification code.
@@ -60,14 +66,15 @@ func (pa *privateAPI) registerClient() http.HandlerFunc {
 		}
 		_ = r.Body.Close()
 
-		if err := pa.wsManager.verifyCode(
-			req.VerificationCode,
-			req.ClientPhoneNumber,
-			req.SelectDigitURL,
-			req.HeartbeatURL,
-			req.GameDoneURL,
-			req.GameStartURL,
-		); err != nil {
+		call := newWebhookCall(
+			req,
+			pa.wsManager.callMonitor,
+			hlog.FromRequest(r).With().Str("phone_number", string(req.ClientPhoneNumber)).Logger(),
+		)
+		pa.wsManager.trackCall(call)
+
+		if err := pa.wsManager.verifyCode(req.VerificationCode, req.ClientPhoneNumber, call); err != nil {
+			call.release()
 			hlog.FromRequest(r).Err(err).
 				Uint64("verification_code", uint64(req.VerificationCode)).
 				Msg("Verification code does not exist")
@@ -90,14 +97,25 @@ func (pa *privateAPI) handleAudioStream() http.HandlerFunc {
 			return
 		}
 
+		format, err := audio.ParseFormat(r.URL.Query())
+		if err != nil {
+			l.Warn().Err(err).Msg("Invalid audio format for web socket audio connection")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		conn, err := upgrade.Upgrade(w, r, nil)
 		if err != nil {
 			l.Err(err).Msg("Failed to accept audio stream web socket client")
 			return
 		}
 
-		l.Info().Msg("Register incoming audio stream on web socket")
-		pa.wsManager.registerAudioConnection(PhoneNumber(phoneNumber), conn)
+		l.Info().Stringer("audio_format", format).Msg("Register incoming audio stream on web socket")
+		pa.wsManager.registerAudioConnection(PhoneNumber(phoneNumber), &webSocketAudioStream{
+			conn:   conn,
+			format: format,
+			log:    l,
+		})
 	}
 }
 
@@ -136,6 +154,8 @@ func (pa *publicAPI) routes() {
 	pa.mux.Get("/", pa.handleStaticFiles())
 	pa.mux.Get("/js/*", pa.handleStaticFiles())
 	pa.mux.Get("/css/*", pa.handleStaticFiles())
+	pa.mux.Get("/games", pa.handleGameTypes())
+	pa.mux.Get("/bots", pa.handleBots())
 	pa.mux.Get("/ws", pa.handleWebSocket())
 }
 
@@ -146,16 +166,54 @@ func (pa *publicAPI) handleStaticFiles() http.HandlerFunc {
 	}
 }
 
+// handleGameTypes returns the names of the games the player can choose from.
+func (pa *publicAPI) handleGameTypes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(GameTypes()); err != nil {
+			hlog.FromRequest(r).Err(err).Msg("Failed to send game types")
+		}
+	}
+}
+
+// handleBots returns the names of the bots the player can choose as opponent.
+func (pa *publicAPI) handleBots() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(pa.wsManager.botNames()); err != nil {
+			hlog.FromRequest(r).Err(err).Msg("Failed to send bots")
+		}
+	}
+}
+
 // handleWebSocket upgrades an HTTP connection to a web socket connection
 // that is used to communicate with the client throughout the game's lifetime.
+// The game the client wants to play is passed as `game` query parameter,
+// the bot it wants to play against, if any, as `bot` query parameter.
 func (pa *publicAPI) handleWebSocket() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		gameType := r.URL.Query().Get("game")
+		if gameType == "" {
+			gameType = GameTicTacToe
+		}
+		if _, err := newGame(gameType); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("Client requested unknown game")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bot := r.URL.Query().Get("bot")
+		if _, ok := pa.wsManager.bots[bot]; bot != "" && !ok {
+			hlog.FromRequest(r).Warn().Str("bot", bot).Msg("Client requested unknown bot")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		conn, err := pa.upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			hlog.FromRequest(r).Err(err).Msg("Failed to upgrade to web socket connection for data stream")
 			return
 		}
-		pa.wsManager.handleClient(conn)
+		pa.wsManager.handleClient(conn, gameType, bot)
 	}
 }
 
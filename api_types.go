@@ -41,14 +41,26 @@ type WebhookURL string
 type RegisterClientRequest struct {
 	VerificationCode  VerificationCode `json:"verificationCode"`
 	ClientPhoneNumber PhoneNumber      `json:"clientPhoneNumber"`
-	SelectDigitURL    WebhookURL       `json:"selectDigitUrl"`
-	HeartbeatURL      WebhookURL       `json:"heartbeatUrl"`
-	GameDoneURL       WebhookURL       `json:"gameDoneUrl"`
-	GameStartURL      WebhookURL       `json:"gameStartUrl"`
+	// SelectDigitURL responds with the next move of the caller. If the caller did not
+	// complete the move after all retries, it responds with 408 Request Timeout, or with
+	// 422 Unprocessable Entity if the entered keys were too short.
+	SelectDigitURL WebhookURL `json:"selectDigitUrl"`
+	HeartbeatURL   WebhookURL `json:"heartbeatUrl"`
+	GameDoneURL    WebhookURL `json:"gameDoneUrl"`
+	GameStartURL   WebhookURL `json:"gameStartUrl"`
+	// Channel is the asterisk channel of the call. It is used to detect
+	// when the caller hangs up.
+	Channel string `json:"channel,omitempty"`
+	// AnnounceURL receives the events of the game as POST requests, so that they can be
+	// announced to the caller. It is empty if the client does not support announcements.
+	AnnounceURL WebhookURL `json:"announceUrl,omitempty"`
 }
 
 // ReceiveDigitRequest is used when making a private API call to
 // a webhook to get a new digit from a client.
 type ReceiveDigitRequest struct {
+	// Digit is the move if it is a number, kept for servers that only support single digits.
 	Digit int `json:"digit"`
+	// Keys are the keys of the move as entered by the caller.
+	Keys string `json:"keys"`
 }
@@ -0,0 +1,267 @@
+// Package ari implements a client for the Asterisk REST Interface (ARI)
+// which is used to control calls that enter a Stasis application.
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Types of the events that are used by this project.
+const (
+	EventStasisStart         = "StasisStart"
+	EventStasisEnd           = "StasisEnd"
+	EventChannelDtmfReceived = "ChannelDtmfReceived"
+	EventChannelDestroyed    = "ChannelDestroyed"
+	EventPlaybackFinished    = "PlaybackFinished"
+)
+
+// CallerID identifies the caller of a channel.
+type CallerID struct {
+	Name   string `json:"name"`
+	Number string `json:"number"`
+}
+
+// Channel is an asterisk channel.
+type Channel struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	State       string            `json:"state"`
+	Caller      CallerID          `json:"caller"`
+	ChannelVars map[string]string `json:"channelvars,omitempty"`
+}
+
+// Bridge mixes the media of the channels it contains.
+type Bridge struct {
+	ID   string `json:"id"`
+	Type string `json:"bridge_type"`
+}
+
+// Playback is a media playback on a channel.
+type Playback struct {
+	ID       string `json:"id"`
+	MediaURI string `json:"media_uri"`
+	// TargetURI is the resource the media is played on, e.g. `channel:<id>`.
+	TargetURI string `json:"target_uri"`
+	State     string `json:"state"`
+}
+
+// Event is an event of a Stasis application.
+// Only the fields of the events used by this project are decoded.
+type Event struct {
+	Type        string    `json:"type"`
+	Application string    `json:"application"`
+	Channel     *Channel  `json:"channel,omitempty"`
+	Playback    *Playback `json:"playback,omitempty"`
+	Args        []string  `json:"args,omitempty"`
+	Digit       string    `json:"digit,omitempty"`
+}
+
+// ExternalMedia configures the channel created by Client.ExternalMedia.
+type ExternalMedia struct {
+	// ExternalHost is the host and port that asterisk sends the RTP stream to.
+	ExternalHost string
+	// Format is the codec of the stream, e.g. `slin` or `ulaw`.
+	Format string
+	// Direction is either `both`, `in` or `out`. Defaults to `both` if empty.
+	Direction string
+}
+
+// Error is returned when ARI responds with an unexpected status code.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ari request failed with status code %d: %s", e.StatusCode, e.Message)
+}
+
+// Client is used to communicate with ARI on behalf of a single Stasis application.
+// Each method is concurrency safe.
+type Client struct {
+	baseURL     string
+	application string
+	username    string
+	password    string
+	http        *http.Client
+}
+
+// NewClient returns a client for the given Stasis application.
+// baseURL is the URL of the HTTP server of asterisk, e.g. `http://localhost:8088`.
+func NewClient(baseURL, application, username, password string) *Client {
+	return &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		application: application,
+		username:    username,
+		password:    password,
+		http:        &http.Client{},
+	}
+}
+
+// Application returns the name of the Stasis application.
+func (c *Client) Application() string {
+	return c.application
+}
+
+// Answer answers the given channel.
+func (c *Client) Answer(ctx context.Context, channelID string) error {
+	return c.do(ctx, http.MethodPost, "/channels/"+url.PathEscape(channelID)+"/answer", nil, nil)
+}
+
+// Hangup hangs up the given channel.
+func (c *Client) Hangup(ctx context.Context, channelID string) error {
+	return c.do(ctx, http.MethodDelete, "/channels/"+url.PathEscape(channelID), nil, nil)
+}
+
+// Play plays the given media, e.g. `sound:beep`, on the given channel.
+func (c *Client) Play(ctx context.Context, channelID, media string) (Playback, error) {
+	var playback Playback
+	err := c.do(
+		ctx,
+		http.MethodPost,
+		"/channels/"+url.PathEscape(channelID)+"/play",
+		url.Values{"media": {media}},
+		&playback,
+	)
+	return playback, err
+}
+
+// ExternalMedia creates a channel that exchanges the media of the
+// Stasis application with an external host through RTP.
+func (c *Client) ExternalMedia(ctx context.Context, media ExternalMedia) (Channel, error) {
+	direction := media.Direction
+	if direction == "" {
+		direction = "both"
+	}
+	var channel Channel
+	err := c.do(ctx, http.MethodPost, "/channels/externalMedia", url.Values{
+		"app":           {c.application},
+		"external_host": {media.ExternalHost},
+		"format":        {media.Format},
+		"direction":     {direction},
+		"encapsulation": {"rtp"},
+		"transport":     {"udp"},
+	}, &channel)
+	return channel, err
+}
+
+// CreateBridge creates a new bridge of the given type, e.g. `mixing`.
+func (c *Client) CreateBridge(ctx context.Context, typ string) (Bridge, error) {
+	var bridge Bridge
+	err := c.do(ctx, http.MethodPost, "/bridges", url.Values{"type": {typ}}, &bridge)
+	return bridge, err
+}
+
+// AddChannels adds the given channels to the bridge.
+func (c *Client) AddChannels(ctx context.Context, bridgeID string, channelIDs ...string) error {
+	return c.do(
+		ctx,
+		http.MethodPost,
+		"/bridges/"+url.PathEscape(bridgeID)+"/addChannel",
+		url.Values{"channel": {strings.Join(channelIDs, ",")}},
+		nil,
+	)
+}
+
+// DestroyBridge shuts down the given bridge.
+func (c *Client) DestroyBridge(ctx context.Context, bridgeID string) error {
+	return c.do(ctx, http.MethodDelete, "/bridges/"+url.PathEscape(bridgeID), nil, nil)
+}
+
+// do sends a request to the given ARI resource and decodes the JSON response into out, if not nil.
+func (c *Client) do(ctx context.Context, method, resource string, query url.Values, out any) error {
+	u := c.baseURL + "/ari" + resource
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return fmt.Errorf("create ari request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("send ari request %s %s: %w", method, resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode ari response of %s %s: %w", method, resource, err)
+	}
+	return nil
+}
+
+// Events connects to the event web socket of the Stasis application and sends all received
+// events on the returned channel. The channel is closed when the connection is lost or the
+// context is cancelled.
+func (c *Client) Events(ctx context.Context) (<-chan Event, error) {
+	u, err := url.Parse(c.baseURL + "/ari/events")
+	if err != nil {
+		return nil, fmt.Errorf("parse ari url: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.RawQuery = url.Values{
+		"app":     {c.application},
+		"api_key": {c.username + ":" + c.password},
+	}.Encode()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ari events: %w", err)
+	}
+
+	events := make(chan Event)
+	// Closed once the reader stops, so that the goroutine closing the connection on
+	// cancellation does not outlive the connection.
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer close(done)
+		defer conn.Close()
+		for {
+			var event Event
+			if err := conn.ReadJSON(&event); err != nil {
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
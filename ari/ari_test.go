@@ -0,0 +1,181 @@
+package ari
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stub is a minimal ARI server that records all requests and pushes events
+// to the connected event web socket.
+type stub struct {
+	server *httptest.Server
+	events chan Event
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newStub(t *testing.T) *stub {
+	t.Helper()
+	s := &stub{events: make(chan Event)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ari/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("app") != "voipttt" || r.URL.Query().Get("api_key") != "user:secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			select {
+			case event := <-s.events:
+				if err := conn.WriteJSON(event); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ari/", func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "user" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+		s.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/ari/bridges":
+			_, _ = w.Write([]byte(`{"id":"bridge-1","bridge_type":"mixing"}`))
+		case "/ari/channels/1/play":
+			_, _ = w.Write([]byte(`{"id":"playback-1","media_uri":"sound:beep","state":"queued"}`))
+		case "/ari/channels/unknown":
+			http.Error(w, `{"message":"Channel not found"}`, http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *stub) client() *Client {
+	return NewClient(s.server.URL+"/", "voipttt", "user", "secret")
+}
+
+func (s *stub) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func TestClientRequests(t *testing.T) {
+	s := newStub(t)
+	c := s.client()
+	ctx := context.Background()
+
+	if err := c.Answer(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	playback, err := c.Play(ctx, "1", "sound:beep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playback.ID != "playback-1" {
+		t.Fatalf("got playback %+v", playback)
+	}
+	bridge, err := c.CreateBridge(ctx, "mixing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bridge.ID != "bridge-1" || bridge.Type != "mixing" {
+		t.Fatalf("got bridge %+v", bridge)
+	}
+	if err := c.AddChannels(ctx, bridge.ID, "1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Hangup(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /ari/channels/1/answer",
+		"POST /ari/channels/1/play?media=sound%3Abeep",
+		"POST /ari/bridges?type=mixing",
+		"POST /ari/bridges/bridge-1/addChannel?channel=1%2C2",
+		"DELETE /ari/channels/1",
+	}
+	got := s.recorded()
+	if len(got) != len(want) {
+		t.Fatalf("got requests %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got request %q, want %q", got[i], want[i])
+		}
+	}
+
+	var aerr *Error
+	if err := c.Hangup(ctx, "unknown"); !errors.As(err, &aerr) || aerr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got error %v, want status code 404", err)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	s := newStub(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := s.client().Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := &Channel{ID: "1", Name: "PJSIP/100-00000001", Caller: CallerID{Number: "100"}}
+	sent := []Event{
+		{Type: EventStasisStart, Application: "voipttt", Channel: channel},
+		{Type: EventChannelDtmfReceived, Application: "voipttt", Channel: channel, Digit: "5"},
+		{Type: EventStasisEnd, Application: "voipttt", Channel: channel},
+	}
+	go func() {
+		for _, event := range sent {
+			s.events <- event
+		}
+	}()
+
+	for _, want := range sent {
+		select {
+		case got := <-events:
+			if got.Type != want.Type || got.Digit != want.Digit || got.Channel == nil || got.Channel.Caller.Number != "100" {
+				t.Fatalf("got event %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("did not receive %s", want.Type)
+		}
+	}
+
+	// The channel is closed once the context is cancelled.
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("received event after cancellation")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("events were not closed after cancellation")
+	}
+}
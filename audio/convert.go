@@ -0,0 +1,141 @@
+package audio
+
+// Converter converts a continuous audio stream from one format to another.
+// It keeps state between chunks, so a converter must only be used for a single stream.
+type Converter struct {
+	from, to  Format
+	resampler []resampler // One per channel of the target format.
+	// Incomplete frame of the previous chunk, e.g. a single byte of a 16 bit sample.
+	rest []byte
+}
+
+// NewConverter returns a converter for streams of the given formats,
+// which must be valid.
+func NewConverter(from, to Format) *Converter {
+	c := &Converter{
+		from:      from,
+		to:        to,
+		resampler: make([]resampler, to.Channels),
+	}
+	for i := range c.resampler {
+		c.resampler[i] = resampler{from: from.SampleRate, to: to.SampleRate}
+	}
+	return c
+}
+
+// Convert converts the next chunk of the stream.
+func (c *Converter) Convert(data []byte) []byte {
+	if c.from == c.to {
+		return data
+	}
+
+	frameSize := c.from.bytesPerSample() * c.from.Channels
+	if len(c.rest) > 0 {
+		data = append(c.rest, data...)
+		c.rest = nil
+	}
+	if n := len(data) % frameSize; n != 0 {
+		c.rest = append([]byte(nil), data[len(data)-n:]...)
+		data = data[:len(data)-n]
+	}
+
+	samples := decodeSamples(data, c.from.Encoding)
+	channels := splitChannels(samples, c.from.Channels, c.to.Channels)
+	for i := range channels {
+		channels[i] = c.resampler[i].resample(channels[i])
+	}
+	return encodeSamples(joinChannels(channels), c.to.Encoding)
+}
+
+// Samples returns the samples of signed linear 16 bit little endian PCM.
+func Samples(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(uint16(pcm[i*2]) | uint16(pcm[i*2+1])<<8)
+	}
+	return samples
+}
+
+// PCM returns the samples as signed linear 16 bit little endian PCM.
+func PCM(samples []int16) []byte {
+	pcm := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		pcm[i*2] = byte(sample)
+		pcm[i*2+1] = byte(uint16(sample) >> 8)
+	}
+	return pcm
+}
+
+func decodeSamples(data []byte, encoding Encoding) []int16 {
+	switch encoding {
+	case EncodingULaw:
+		return decodeWith(data, DecodeULaw)
+	case EncodingALaw:
+		return decodeWith(data, DecodeALaw)
+	default:
+		return Samples(data)
+	}
+}
+
+func decodeWith(data []byte, decode func(byte) int16) []int16 {
+	samples := make([]int16, len(data))
+	for i, b := range data {
+		samples[i] = decode(b)
+	}
+	return samples
+}
+
+func encodeSamples(samples []int16, encoding Encoding) []byte {
+	switch encoding {
+	case EncodingULaw:
+		return encodePCM(PCM(samples), EncodeULaw)
+	case EncodingALaw:
+		return encodePCM(PCM(samples), EncodeALaw)
+	default:
+		return PCM(samples)
+	}
+}
+
+// splitChannels splits interleaved samples into the given number of target channels.
+// More source than target channels are mixed down, fewer are duplicated.
+func splitChannels(samples []int16, from, to int) [][]int16 {
+	frames := len(samples) / from
+	channels := make([][]int16, to)
+	for c := range channels {
+		channels[c] = make([]int16, frames)
+	}
+
+	for f := 0; f < frames; f++ {
+		frame := samples[f*from : (f+1)*from]
+		if from == to {
+			for c := range channels {
+				channels[c][f] = frame[c]
+			}
+			continue
+		}
+		var sum int
+		for _, s := range frame {
+			sum += int(s)
+		}
+		mixed := int16(sum / from)
+		for c := range channels {
+			channels[c][f] = mixed
+		}
+	}
+	return channels
+}
+
+// joinChannels interleaves the samples of all channels.
+func joinChannels(channels [][]int16) []int16 {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	frames := len(channels[0])
+	samples := make([]int16, 0, frames*len(channels))
+	for f := 0; f < frames; f++ {
+		for _, ch := range channels {
+			samples = append(samples, ch[f])
+		}
+	}
+	return samples
+}
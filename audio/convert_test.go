@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConverterKeepsSplitSample(t *testing.T) {
+	from := FormatTelephone
+	to := Format{Encoding: EncodingULaw, SampleRate: 8000, Channels: 1}
+	c := NewConverter(from, to)
+
+	pcm := PCM([]int16{1000, -2000, 3000})
+	// The second sample is split between the chunks.
+	first := c.Convert(pcm[:3])
+	if want := []byte{EncodeULaw(1000)}; !bytes.Equal(first, want) {
+		t.Fatalf("got %v for the first chunk, want %v", first, want)
+	}
+	if len(c.rest) != 1 {
+		t.Fatalf("got %d bytes left, want the first byte of the split sample", len(c.rest))
+	}
+
+	second := c.Convert(pcm[3:])
+	if want := []byte{EncodeULaw(-2000), EncodeULaw(3000)}; !bytes.Equal(second, want) {
+		t.Fatalf("got %v for the second chunk, want %v", second, want)
+	}
+	if len(c.rest) != 0 {
+		t.Fatalf("got %d bytes left after a complete chunk", len(c.rest))
+	}
+}
+
+func TestConverterMixesDownStereo(t *testing.T) {
+	from := Format{Encoding: EncodingLinear16, SampleRate: 8000, Channels: 2}
+	c := NewConverter(from, FormatTelephone)
+
+	stereo := PCM([]int16{100, 300, -50, -150, 32767, 32767})
+	got := Samples(c.Convert(stereo))
+	want := []int16{200, -100, 32767}
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got samples %v, want %v", got, want)
+		}
+	}
+}
+
+func TestConverterUpsamplesAcrossChunks(t *testing.T) {
+	to := Format{Encoding: EncodingLinear16, SampleRate: 48000, Channels: 1}
+	c := NewConverter(Format{Encoding: EncodingULaw, SampleRate: 8000, Channels: 1}, to)
+
+	var total int
+	for i := 0; i < 50; i++ {
+		// 20 ms of μ-law, like a single RTP packet.
+		total += len(Samples(c.Convert(bytes.Repeat([]byte{EncodeULaw(500)}, 160))))
+	}
+	if want := 50 * 160 * 6; total < want-6 || total > want {
+		t.Fatalf("got %d samples for a second of audio, want %d", total, want)
+	}
+}
+
+func TestConverterPassesThroughSameFormat(t *testing.T) {
+	c := NewConverter(FormatTelephone, FormatTelephone)
+	pcm := PCM([]int16{1, 2, 3})
+	if got := c.Convert(pcm[:5]); !bytes.Equal(got, pcm[:5]) {
+		t.Fatalf("got %v, want the unchanged chunk", got)
+	}
+}
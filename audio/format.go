@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Encoding is the encoding of the samples of an audio stream.
+type Encoding string
+
+const (
+	EncodingLinear16 Encoding = "LINEAR16" // Signed linear 16 bit, little endian.
+	EncodingULaw     Encoding = "ULAW"     // G.711 μ-law.
+	EncodingALaw     Encoding = "ALAW"     // G.711 A-law.
+)
+
+// Sample rates that are supported by browsers and telephony providers alike.
+var SampleRates = []int{8000, 16000, 48000}
+
+// Format describes an audio stream. Samples of multiple channels are interleaved.
+type Format struct {
+	Encoding   Encoding `json:"encoding"`
+	SampleRate int      `json:"sampleRate"`
+	Channels   int      `json:"channels"`
+}
+
+// FormatTelephone is the format of narrowband telephone audio, which is what
+// callers send unless they declare otherwise.
+var FormatTelephone = Format{
+	Encoding:   EncodingLinear16,
+	SampleRate: 8000,
+	Channels:   1,
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%s %d Hz %d ch", f.Encoding, f.SampleRate, f.Channels)
+}
+
+// Validate returns an error if the format can not be converted.
+func (f Format) Validate() error {
+	switch f.Encoding {
+	case EncodingLinear16, EncodingULaw, EncodingALaw:
+	default:
+		return fmt.Errorf("unsupported audio encoding %q", f.Encoding)
+	}
+	if f.SampleRate < 1000 || f.SampleRate > 192000 {
+		return fmt.Errorf("unsupported audio sample rate %d", f.SampleRate)
+	}
+	if f.Channels < 1 || f.Channels > 8 {
+		return fmt.Errorf("unsupported number of audio channels %d", f.Channels)
+	}
+	return nil
+}
+
+// bytesPerSample returns the size of a single sample of a single channel.
+func (f Format) bytesPerSample() int {
+	if f.Encoding == EncodingLinear16 {
+		return 2
+	}
+	return 1
+}
+
+// AddToQuery adds the format as `encoding`, `sampleRate` and `channels` parameters to the query.
+func (f Format) AddToQuery(q url.Values) {
+	q.Set("encoding", string(f.Encoding))
+	q.Set("sampleRate", strconv.Itoa(f.SampleRate))
+	q.Set("channels", strconv.Itoa(f.Channels))
+}
+
+// ParseFormat parses a format from the query parameters added by AddToQuery.
+// Missing parameters default to the values of FormatTelephone.
+func ParseFormat(q url.Values) (Format, error) {
+	f := FormatTelephone
+	if v := q.Get("encoding"); v != "" {
+		f.Encoding = Encoding(v)
+	}
+	if v := q.Get("sampleRate"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid audio sample rate %q", v)
+		}
+		f.SampleRate = n
+	}
+	if v := q.Get("channels"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid number of audio channels %q", v)
+		}
+		f.Channels = n
+	}
+	return f, f.Validate()
+}
+
+// PlaybackFormat returns the format in which audio of the given format is played back:
+// signed linear 16 bit mono at the closest sample rate of SampleRates that does not
+// lose quality, at most the highest one.
+func PlaybackFormat(f Format) Format {
+	rate := SampleRates[len(SampleRates)-1]
+	for _, r := range SampleRates {
+		if r >= f.SampleRate {
+			rate = r
+			break
+		}
+	}
+	return Format{
+		Encoding:   EncodingLinear16,
+		SampleRate: rate,
+		Channels:   1,
+	}
+}
@@ -0,0 +1,128 @@
+// Package audio implements the codecs used to transport the audio of callers,
+// as well as the conversion between the formats of telephony providers and browsers.
+package audio
+
+// DecodeULaw decodes a single G.711 μ-law sample to signed linear 16 bit.
+func DecodeULaw(sample byte) int16 {
+	const bias = 0x84
+
+	sample = ^sample
+	sign := sample & 0x80
+	exponent := (sample >> 4) & 0x07
+	mantissa := sample & 0x0f
+
+	magnitude := ((int16(mantissa) << 3) + bias) << exponent
+	magnitude -= bias
+
+	if sign != 0 {
+		return -magnitude
+	}
+	return magnitude
+}
+
+// DecodeALaw decodes a single G.711 A-law sample to signed linear 16 bit.
+func DecodeALaw(sample byte) int16 {
+	sample ^= 0x55
+	sign := sample & 0x80
+	exponent := (sample >> 4) & 0x07
+	mantissa := sample & 0x0f
+
+	var magnitude int16
+	if exponent == 0 {
+		magnitude = int16(mantissa)<<4 + 8
+	} else {
+		magnitude = (int16(mantissa)<<4 + 0x108) << (exponent - 1)
+	}
+
+	if sign == 0 {
+		return -magnitude
+	}
+	return magnitude
+}
+
+// EncodeULaw encodes a signed linear 16 bit sample to G.711 μ-law.
+func EncodeULaw(sample int16) byte {
+	const (
+		bias = 0x84
+		clip = 32635
+	)
+
+	s := int(sample)
+	var sign int
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0f
+
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// EncodeALaw encodes a signed linear 16 bit sample to G.711 A-law.
+func EncodeALaw(sample int16) byte {
+	s := int(sample)
+	// Unlike μ-law, the sign bit is set for positive samples.
+	sign := 0x80
+	if s < 0 {
+		s = -s
+		sign = 0
+	}
+	if s > 32767 {
+		s = 32767
+	}
+
+	var exponent, mantissa int
+	if s >= 256 {
+		exponent = 7
+		for mask := 0x4000; s&mask == 0 && exponent > 1; mask >>= 1 {
+			exponent--
+		}
+		mantissa = (s >> (exponent + 3)) & 0x0f
+	} else {
+		mantissa = s >> 4
+	}
+
+	return byte(sign|exponent<<4|mantissa) ^ 0x55
+}
+
+// DecodeULawPCM decodes μ-law samples to signed linear 16 bit little endian PCM.
+func DecodeULawPCM(samples []byte) []byte {
+	return decodePCM(samples, DecodeULaw)
+}
+
+// DecodeALawPCM decodes A-law samples to signed linear 16 bit little endian PCM.
+func DecodeALawPCM(samples []byte) []byte {
+	return decodePCM(samples, DecodeALaw)
+}
+
+func decodePCM(samples []byte, decode func(byte) int16) []byte {
+	return PCM(decodeWith(samples, decode))
+}
+
+// EncodeULawPCM encodes signed linear 16 bit little endian PCM to μ-law samples.
+func EncodeULawPCM(pcm []byte) []byte {
+	return encodePCM(pcm, EncodeULaw)
+}
+
+// EncodeALawPCM encodes signed linear 16 bit little endian PCM to A-law samples.
+func EncodeALawPCM(pcm []byte) []byte {
+	return encodePCM(pcm, EncodeALaw)
+}
+
+func encodePCM(pcm []byte, encode func(int16) byte) []byte {
+	samples := Samples(pcm)
+	data := make([]byte, len(samples))
+	for i, sample := range samples {
+		data[i] = encode(sample)
+	}
+	return data
+}
@@ -0,0 +1,73 @@
+package audio
+
+import "testing"
+
+// g711MaxError returns the largest error of the quantisation of G.711 for the given
+// sample, which is half the step of its segment.
+func g711MaxError(sample int16) int {
+	s := int(sample)
+	if s < 0 {
+		s = -s
+	}
+	return s/32 + 16
+}
+
+func TestG711RoundTrip(t *testing.T) {
+	codecs := []struct {
+		name   string
+		encode func(int16) byte
+		decode func(byte) int16
+		// max is the largest magnitude that can be encoded.
+		max int
+	}{
+		{name: "ulaw", encode: EncodeULaw, decode: DecodeULaw, max: 32124},
+		{name: "alaw", encode: EncodeALaw, decode: DecodeALaw, max: 32256},
+	}
+
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			for s := -32768; s <= 32767; s++ {
+				sample := int16(s)
+				want := s
+				if want > c.max {
+					want = c.max
+				} else if want < -c.max {
+					want = -c.max
+				}
+				got := int(c.decode(c.encode(sample)))
+				if diff := got - want; diff > g711MaxError(sample) || -diff > g711MaxError(sample) {
+					t.Fatalf("sample %d: got %d after the round trip", s, got)
+				}
+			}
+
+			// Decoded samples are encoded without loss.
+			for b := 0; b < 256; b++ {
+				sample := c.decode(byte(b))
+				if got := c.decode(c.encode(sample)); got != sample {
+					t.Fatalf("code %#x: got %d after the round trip of %d", b, got, sample)
+				}
+			}
+		})
+	}
+}
+
+func TestG711PCM(t *testing.T) {
+	pcm := PCM([]int16{0, 1000, -1000, 30000})
+	for name, codec := range map[string]struct {
+		encode, decode func([]byte) []byte
+	}{
+		"ulaw": {EncodeULawPCM, DecodeULawPCM},
+		"alaw": {EncodeALawPCM, DecodeALawPCM},
+	} {
+		encoded := codec.encode(pcm)
+		if len(encoded) != len(pcm)/2 {
+			t.Fatalf("%s: got %d bytes for %d samples", name, len(encoded), len(pcm)/2)
+		}
+		decoded := Samples(codec.decode(encoded))
+		for i, want := range Samples(pcm) {
+			if diff := int(decoded[i]) - int(want); diff > g711MaxError(want) || -diff > g711MaxError(want) {
+				t.Fatalf("%s: got sample %d, want %d", name, decoded[i], want)
+			}
+		}
+	}
+}
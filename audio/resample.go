@@ -0,0 +1,40 @@
+package audio
+
+// resampler changes the sample rate of a single channel by linear interpolation,
+// which is good enough for speech. It carries the position between chunks,
+// so that chunk boundaries are inaudible.
+type resampler struct {
+	from, to int
+
+	// Position of the next output sample, relative to the last sample of the previous chunk.
+	pos float64
+	// Last sample of the previous chunk.
+	last    int16
+	hasLast bool
+}
+
+func (r *resampler) resample(in []int16) []int16 {
+	if r.from == r.to || len(in) == 0 {
+		return in
+	}
+
+	src := in
+	if r.hasLast {
+		src = append([]int16{r.last}, in...)
+	}
+
+	step := float64(r.from) / float64(r.to)
+	out := make([]int16, 0, int(float64(len(in))/step)+1)
+	for r.pos+1 < float64(len(src)) {
+		i := int(r.pos)
+		frac := r.pos - float64(i)
+		sample := float64(src[i]) + (float64(src[i+1])-float64(src[i]))*frac
+		out = append(out, int16(sample))
+		r.pos += step
+	}
+
+	r.pos -= float64(len(src) - 1)
+	r.last = src[len(src)-1]
+	r.hasLast = true
+	return out
+}
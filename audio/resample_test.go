@@ -0,0 +1,53 @@
+package audio
+
+import "testing"
+
+func TestResamplerCarriesPositionAcrossChunks(t *testing.T) {
+	// A second of a ramp, split into chunks of varying size like network packets.
+	in := make([]int16, 8000)
+	for i := range in {
+		in[i] = int16(i)
+	}
+	chunkSizes := []int{160, 7, 1, 333, 80}
+
+	for _, rate := range []int{16000, 48000} {
+		factor := rate / 8000
+		whole := (&resampler{from: 8000, to: rate}).resample(in)
+
+		r := resampler{from: 8000, to: rate}
+		var chunked []int16
+		for i, n := 0, 0; i < len(in); i, n = i+chunkSizes[n%len(chunkSizes)], n+1 {
+			end := i + chunkSizes[n%len(chunkSizes)]
+			if end > len(in) {
+				end = len(in)
+			}
+			chunked = append(chunked, r.resample(in[i:end])...)
+			// The samples up to the last input sample are produced, which is interpolated
+			// with the next chunk. Rounding of the position must not add up across chunks.
+			if want := (end - 1) * factor; len(chunked) < want-1 || len(chunked) > want+1 {
+				t.Fatalf("%d Hz: got %d samples after the chunk [%d, %d), want %d", rate, len(chunked), i, end, want)
+			}
+		}
+
+		if len(chunked) != len(whole) {
+			t.Fatalf("%d Hz: got %d samples in chunks, want %d", rate, len(chunked), len(whole))
+		}
+		for i := range whole {
+			// The interpolation of the ramp is the same no matter where the chunks end.
+			if diff := chunked[i] - whole[i]; diff > 1 || diff < -1 {
+				t.Fatalf("%d Hz: got sample %d at %d, want %d", rate, chunked[i], i, whole[i])
+			}
+		}
+	}
+}
+
+func TestResamplerDownsamples(t *testing.T) {
+	r := resampler{from: 48000, to: 8000}
+	var total int
+	for i := 0; i < 100; i++ {
+		total += len(r.resample(make([]int16, 480)))
+	}
+	if want := 8000; total < want-1 || total > want {
+		t.Fatalf("got %d samples for a second of audio, want %d", total, want)
+	}
+}
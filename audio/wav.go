@@ -0,0 +1,87 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format codes of the fmt chunk of a WAV file.
+const (
+	wavFormatPCM  = 1
+	wavFormatALaw = 6
+	wavFormatULaw = 7
+)
+
+// ReadWAV reads a WAV file of signed linear 16 bit or G.711 samples and returns
+// its format and samples. Other chunks than fmt and data are skipped.
+func ReadWAV(r io.Reader) (Format, []byte, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return Format{}, nil, fmt.Errorf("read wav header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return Format{}, nil, errors.New("not a wav file")
+	}
+
+	var (
+		f      Format
+		hasFmt bool
+	)
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return Format{}, nil, fmt.Errorf("read wav chunk: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return Format{}, nil, fmt.Errorf("wav fmt chunk of %d bytes is too short", size)
+			}
+			var data [16]byte
+			if _, err := io.ReadFull(r, data[:]); err != nil {
+				return Format{}, nil, fmt.Errorf("read wav fmt chunk: %w", err)
+			}
+			bits := binary.LittleEndian.Uint16(data[14:16])
+			switch code := binary.LittleEndian.Uint16(data[0:2]); {
+			case code == wavFormatPCM && bits == 16:
+				f.Encoding = EncodingLinear16
+			case code == wavFormatALaw && bits == 8:
+				f.Encoding = EncodingALaw
+			case code == wavFormatULaw && bits == 8:
+				f.Encoding = EncodingULaw
+			default:
+				return Format{}, nil, fmt.Errorf("unsupported wav format %d with %d bits per sample", code, bits)
+			}
+			f.Channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			f.SampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			if err := f.Validate(); err != nil {
+				return Format{}, nil, err
+			}
+			hasFmt = true
+			// Skip the extension of the chunk and its padding.
+			if _, err := io.CopyN(io.Discard, r, size-16+size%2); err != nil {
+				return Format{}, nil, fmt.Errorf("read wav fmt chunk: %w", err)
+			}
+
+		case "data":
+			if !hasFmt {
+				return Format{}, nil, errors.New("wav data chunk before fmt chunk")
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return Format{}, nil, fmt.Errorf("read wav data chunk: %w", err)
+			}
+			return f, data, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return Format{}, nil, fmt.Errorf("skip wav chunk %q: %w", id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// wavFile returns a WAV file with the given format code, bits per sample and chunks
+// between the fmt and the data chunk.
+func wavFile(code, channels uint16, sampleRate uint32, bits uint16, data []byte, extra ...[]byte) []byte {
+	chunk := func(id string, body []byte) []byte {
+		var b bytes.Buffer
+		b.WriteString(id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(body)))
+		b.Write(body)
+		if len(body)%2 == 1 {
+			b.WriteByte(0)
+		}
+		return b.Bytes()
+	}
+
+	var fmtChunk bytes.Buffer
+	blockAlign := channels * bits / 8
+	for _, v := range []any{code, channels, sampleRate, sampleRate * uint32(blockAlign), blockAlign, bits} {
+		_ = binary.Write(&fmtChunk, binary.LittleEndian, v)
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.Write(chunk("fmt ", fmtChunk.Bytes()))
+	for _, e := range extra {
+		body.Write(e)
+	}
+	body.Write(chunk("data", data))
+	return chunk("RIFF", body.Bytes())
+}
+
+func TestReadWAV(t *testing.T) {
+	list := append([]byte("LIST"), 3, 0, 0, 0, 'a', 'b', 'c', 0)
+
+	tests := []struct {
+		name   string
+		file   []byte
+		format Format
+		data   []byte
+		err    bool
+	}{
+		{
+			name:   "linear 16 bit",
+			file:   wavFile(wavFormatPCM, 1, 8000, 16, []byte{1, 2, 3, 4}),
+			format: Format{Encoding: EncodingLinear16, SampleRate: 8000, Channels: 1},
+			data:   []byte{1, 2, 3, 4},
+		},
+		{
+			name:   "μ-law with a padded chunk in between",
+			file:   wavFile(wavFormatULaw, 2, 16000, 8, []byte{0xff, 0x7f}, list),
+			format: Format{Encoding: EncodingULaw, SampleRate: 16000, Channels: 2},
+			data:   []byte{0xff, 0x7f},
+		},
+		{
+			name:   "A-law",
+			file:   wavFile(wavFormatALaw, 1, 8000, 8, []byte{0xd5}),
+			format: Format{Encoding: EncodingALaw, SampleRate: 8000, Channels: 1},
+			data:   []byte{0xd5},
+		},
+		{name: "8 bit linear", file: wavFile(wavFormatPCM, 1, 8000, 8, []byte{1}), err: true},
+		{name: "float", file: wavFile(3, 1, 8000, 32, []byte{1, 2, 3, 4}), err: true},
+		{name: "no channels", file: wavFile(wavFormatPCM, 0, 8000, 16, []byte{1, 2}), err: true},
+		{name: "truncated data", file: wavFile(wavFormatPCM, 1, 8000, 16, []byte{1, 2, 3, 4})[:46], err: true},
+		{name: "not a wav file", file: []byte("RIFF\x00\x00\x00\x00AVI LIST"), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, data, err := ReadWAV(bytes.NewReader(tt.file))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("read invalid file as %v", format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format || !bytes.Equal(data, tt.data) {
+				t.Fatalf("got %v %v, want %v %v", format, data, tt.format, tt.data)
+			}
+		})
+	}
+}
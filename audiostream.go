@@ -0,0 +1,55 @@
+package voipttt
+
+import (
+	"net"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/audio"
+)
+
+// audioStream is the incoming audio of a caller.
+type audioStream interface {
+	// ReadAudio blocks until the next chunk of audio is available.
+	ReadAudio() ([]byte, error)
+	// Format returns the format of the audio.
+	Format() audio.Format
+	// RemoteAddr returns the address the audio is received from.
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// webSocketAudioStream is an audio stream that is received as binary
+// web socket messages, e.g. from asterisk-audio-fork.
+type webSocketAudioStream struct {
+	conn   *websocket.Conn
+	format audio.Format
+	log    zerolog.Logger
+}
+
+func (ws *webSocketAudioStream) ReadAudio() ([]byte, error) {
+	for {
+		typ, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if typ != websocket.BinaryMessage {
+			ws.log.Warn().Int("msg_type", typ).Msg("Received unexpected web socket message type")
+			continue
+		}
+		return data, nil
+	}
+}
+
+func (ws *webSocketAudioStream) Format() audio.Format {
+	return ws.format
+}
+
+func (ws *webSocketAudioStream) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+func (ws *webSocketAudioStream) Close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,377 @@
+package voipttt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GameBattleship is the name of Battleship.
+const GameBattleship = "battleship"
+
+const (
+	battleshipRows = 10
+	battleshipCols = 10
+)
+
+// battleshipFleet are the lengths of the ships each player places.
+var battleshipFleet = []int{5, 4, 3, 3, 2}
+
+// Results of a shot.
+const (
+	shotMiss = "MISS"
+	shotHit  = "HIT"
+	shotSunk = "SUNK"
+)
+
+// States of a cell as it is shown on the website.
+const (
+	cellEmpty = "EMPTY" // Water or, on the opponent's board, unknown.
+	cellShip  = "SHIP"  // A ship that has not been hit, only shown on the own board.
+	cellMiss  = "MISS"
+	cellHit   = "HIT"
+	cellSunk  = "SUNK"
+)
+
+// Phases of the game.
+const (
+	battleshipPhaseSetup = "SETUP"
+	battleshipPhasePlay  = "PLAY"
+)
+
+// battleshipShip is a ship as it is placed on the website.
+type battleshipShip struct {
+	// Row and Col of the upper left end of the ship, starting at 1.
+	Row        int  `json:"row"`
+	Col        int  `json:"col"`
+	Length     int  `json:"length"`
+	Horizontal bool `json:"horizontal"`
+}
+
+// cells returns the zero based rows and columns the ship covers.
+func (s battleshipShip) cells() [][2]int {
+	cells := make([][2]int, s.Length)
+	for i := range cells {
+		if s.Horizontal {
+			cells[i] = [2]int{s.Row - 1, s.Col - 1 + i}
+		} else {
+			cells[i] = [2]int{s.Row - 1 + i, s.Col - 1}
+		}
+	}
+	return cells
+}
+
+// battleshipSetup is the setup a player sends from the website.
+type battleshipSetup struct {
+	Ships []battleshipShip `json:"ships"`
+	// Random places the ships randomly instead.
+	Random bool `json:"random"`
+}
+
+// battleshipBoard is the board of a single player.
+type battleshipBoard struct {
+	ships []battleshipShip // Empty until the player finished the setup.
+	// shot marks the cells the opponent has fired at, row by row.
+	shot [battleshipRows * battleshipCols]bool
+}
+
+func (b *battleshipBoard) placed() bool {
+	return len(b.ships) > 0
+}
+
+// shipAt returns the index of the ship at the zero based row and column, -1 if there is none.
+func (b *battleshipBoard) shipAt(row, col int) int {
+	for i, ship := range b.ships {
+		for _, c := range ship.cells() {
+			if c == [2]int{row, col} {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (b *battleshipBoard) sunk(ship int) bool {
+	for _, c := range b.ships[ship].cells() {
+		if !b.shot[c[0]*battleshipCols+c[1]] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *battleshipBoard) allSunk() bool {
+	for i := range b.ships {
+		if !b.sunk(i) {
+			return false
+		}
+	}
+	return b.placed()
+}
+
+// view returns the cells of the board. Ships that are not sunk are only shown to the owner.
+func (b *battleshipBoard) view(isOwner bool) battleshipBoardView {
+	v := battleshipBoardView{
+		Cells: make([]string, len(b.shot)),
+	}
+	for i := range v.Cells {
+		ship := b.shipAt(i/battleshipCols, i%battleshipCols)
+		switch {
+		case ship >= 0 && b.sunk(ship):
+			v.Cells[i] = cellSunk
+		case ship >= 0 && b.shot[i]:
+			v.Cells[i] = cellHit
+		case b.shot[i]:
+			v.Cells[i] = cellMiss
+		case ship >= 0 && isOwner:
+			v.Cells[i] = cellShip
+		default:
+			v.Cells[i] = cellEmpty
+		}
+	}
+	for i, ship := range b.ships {
+		if isOwner || b.sunk(i) {
+			v.Ships = append(v.Ships, ship)
+		}
+	}
+	return v
+}
+
+// place validates the ships and places them on the board.
+func (b *battleshipBoard) place(ships []battleshipShip) error {
+	lengths := make([]int, len(ships))
+	for i, ship := range ships {
+		lengths[i] = ship.Length
+	}
+	fleet := append([]int(nil), battleshipFleet...)
+	sort.Ints(lengths)
+	sort.Ints(fleet)
+	if fmt.Sprint(lengths) != fmt.Sprint(fleet) {
+		return fmt.Errorf("the fleet must consist of ships of the lengths %v", battleshipFleet)
+	}
+
+	var taken [battleshipRows * battleshipCols]bool
+	for _, ship := range ships {
+		for _, c := range ship.cells() {
+			if c[0] < 0 || c[0] >= battleshipRows || c[1] < 0 || c[1] >= battleshipCols {
+				return fmt.Errorf("the ship at %d*%d is not on the board", ship.Row, ship.Col)
+			}
+			if taken[c[0]*battleshipCols+c[1]] {
+				return fmt.Errorf("the ship at %d*%d overlaps another ship", ship.Row, ship.Col)
+			}
+			taken[c[0]*battleshipCols+c[1]] = true
+		}
+	}
+
+	b.ships = ships
+	return nil
+}
+
+// placeRandomly places the fleet at random positions.
+func (b *battleshipBoard) placeRandomly() {
+	for {
+		var ships []battleshipShip
+		for _, length := range battleshipFleet {
+			ship := battleshipShip{Length: length, Horizontal: rand.Intn(2) == 1}
+			if ship.Horizontal {
+				ship.Row = rand.Intn(battleshipRows) + 1
+				ship.Col = rand.Intn(battleshipCols-length+1) + 1
+			} else {
+				ship.Row = rand.Intn(battleshipRows-length+1) + 1
+				ship.Col = rand.Intn(battleshipCols) + 1
+			}
+			ships = append(ships, ship)
+		}
+		if b.place(ships) == nil {
+			return
+		}
+	}
+}
+
+// battleship is a game of Battleship. Each player secretly places their ships on the
+// website, then the players take turns to fire at a field of the opponent's board.
+// The player who sinks all ships of the opponent wins.
+//
+// A shot is the row and the column of a field, both counted from 1 and separated
+// by a star, e.g. `3*10`. The move is submitted with #.
+type battleship struct {
+	boards [3]battleshipBoard // Indexed by the player who owns the board.
+	turn   Player
+	// result is the result of the latest shot, empty before the first shot.
+	result string
+}
+
+func newBattleship() Game {
+	return new(battleship)
+}
+
+// battleshipView is the state of the game from the perspective of a single player.
+type battleshipView struct {
+	Phase string `json:"phase"`
+	Rows  int    `json:"rows"`
+	Cols  int    `json:"cols"`
+	// Fleet are the lengths of the ships that are placed during the setup.
+	Fleet             []int               `json:"fleet"`
+	SetupDone         bool                `json:"setupDone"`
+	OpponentSetupDone bool                `json:"opponentSetupDone"`
+	Own               battleshipBoardView `json:"own"`
+	Opponent          battleshipBoardView `json:"opponent"`
+}
+
+type battleshipBoardView struct {
+	// Cells are the states of all cells, row by row.
+	Cells []string `json:"cells"`
+	// Ships are the ships of the own board and the sunk ships of the opponent's board.
+	Ships []battleshipShip `json:"ships"`
+}
+
+func (b *battleship) Turn() Player {
+	if b.turn == PlayerNone {
+		return PlayerOne
+	}
+	return b.turn
+}
+
+// Moves returns the fields of the opponent's board that have not been fired at.
+func (b *battleship) Moves() []string {
+	if b.Outcome().Done || !b.setupDone() {
+		return nil
+	}
+	target := &b.boards[b.Turn().Opponent()]
+	var moves []string
+	for i, shot := range target.shot {
+		if !shot {
+			moves = append(moves, mnkMove(i/battleshipCols, i%battleshipCols))
+		}
+	}
+	return moves
+}
+
+func (b *battleship) Play(move string) error {
+	rowKeys, colKeys, ok := strings.Cut(move, "*")
+	if !ok {
+		return fmt.Errorf("%w: %q is not a row and a column separated by *", ErrInvalidMove, move)
+	}
+	row, rowErr := strconv.Atoi(rowKeys)
+	col, colErr := strconv.Atoi(colKeys)
+	if rowErr != nil || colErr != nil || row < 1 || row > battleshipRows || col < 1 || col > battleshipCols {
+		return fmt.Errorf("%w: %q is not a field", ErrInvalidMove, move)
+	}
+	row, col = row-1, col-1
+
+	switch {
+	case !b.setupDone():
+		return fmt.Errorf("%w: the ships are not placed yet", ErrIllegalMove)
+	case b.Outcome().Done:
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	}
+
+	target := &b.boards[b.Turn().Opponent()]
+	if target.shot[row*battleshipCols+col] {
+		return fmt.Errorf("%w: field %s was already fired at", ErrIllegalMove, move)
+	}
+	target.shot[row*battleshipCols+col] = true
+
+	switch ship := target.shipAt(row, col); {
+	case ship < 0:
+		b.result = shotMiss
+	case target.sunk(ship):
+		b.result = shotSunk
+	default:
+		b.result = shotHit
+	}
+
+	b.turn = b.Turn().Opponent()
+	return nil
+}
+
+func (b *battleship) Skip() {
+	b.turn = b.Turn().Opponent()
+}
+
+func (b *battleship) Outcome() Outcome {
+	switch {
+	case b.boards[PlayerOne].allSunk():
+		return Outcome{Done: true, Winner: PlayerTwo}
+	case b.boards[PlayerTwo].allSunk():
+		return Outcome{Done: true, Winner: PlayerOne}
+	}
+	return Outcome{}
+}
+
+// State returns the state without any ships that are not sunk, see View.
+func (b *battleship) State() any {
+	return &struct {
+		PlayerOne battleshipBoardView `json:"playerOne"`
+		PlayerTwo battleshipBoardView `json:"playerTwo"`
+	}{
+		PlayerOne: b.boards[PlayerOne].view(false),
+		PlayerTwo: b.boards[PlayerTwo].view(false),
+	}
+}
+
+func (b *battleship) View(player Player) any {
+	phase := battleshipPhasePlay
+	if !b.setupDone() {
+		phase = battleshipPhaseSetup
+	}
+	return &battleshipView{
+		Phase:             phase,
+		Rows:              battleshipRows,
+		Cols:              battleshipCols,
+		Fleet:             battleshipFleet,
+		SetupDone:         b.boards[player].placed(),
+		OpponentSetupDone: b.boards[player.Opponent()].placed(),
+		Own:               b.boards[player].view(true),
+		Opponent:          b.boards[player.Opponent()].view(false),
+	}
+}
+
+// Input uses the star as separator, so the input can not be cleared and
+// must be submitted with #.
+func (b *battleship) Input() InputSpec {
+	spec := MoveInputSpec
+	spec.MaxLength = 0
+	spec.ClearKey = 0
+	return spec
+}
+
+// Setup places the ships of the player. Without data, e.g. because the player did not
+// place their ships in time, the ships are placed randomly.
+func (b *battleship) Setup(player Player, data json.RawMessage) error {
+	board := &b.boards[player]
+	if board.placed() {
+		return errors.New("the ships are already placed")
+	}
+
+	if data == nil {
+		board.placeRandomly()
+		return nil
+	}
+
+	var setup battleshipSetup
+	if err := json.Unmarshal(data, &setup); err != nil {
+		return fmt.Errorf("decode ships: %w", err)
+	}
+	if setup.Random {
+		board.placeRandomly()
+		return nil
+	}
+	return board.place(setup.Ships)
+}
+
+func (b *battleship) SetupDone(player Player) bool {
+	return b.boards[player].placed()
+}
+
+func (b *battleship) LastResult() string {
+	return b.result
+}
+
+func (b *battleship) setupDone() bool {
+	return b.boards[PlayerOne].placed() && b.boards[PlayerTwo].placed()
+}
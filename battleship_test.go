@@ -0,0 +1,167 @@
+package voipttt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// battleshipTestSetup places the fleet horizontally in the rows 1 to 5, starting at column 1.
+const battleshipTestSetup = `{"ships": [
+	{"row": 1, "col": 1, "length": 5, "horizontal": true},
+	{"row": 2, "col": 1, "length": 4, "horizontal": true},
+	{"row": 3, "col": 1, "length": 3, "horizontal": true},
+	{"row": 4, "col": 1, "length": 3, "horizontal": true},
+	{"row": 5, "col": 1, "length": 2, "horizontal": true}
+]}`
+
+// newTestBattleship returns a game in which both players placed the test setup.
+func newTestBattleship(t *testing.T) *battleship {
+	t.Helper()
+	b := newBattleship().(*battleship)
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		if err := b.Setup(player, json.RawMessage(battleshipTestSetup)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestBattleshipSetup(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup string
+		ok    bool
+	}{
+		{name: "placed", setup: battleshipTestSetup, ok: true},
+		{name: "random", setup: `{"random": true}`, ok: true},
+		{name: "missing ship", setup: `{"ships": [{"row": 1, "col": 1, "length": 5, "horizontal": true}]}`},
+		{name: "overlapping", setup: `{"ships": [
+			{"row": 1, "col": 1, "length": 5, "horizontal": true},
+			{"row": 1, "col": 1, "length": 4},
+			{"row": 3, "col": 1, "length": 3, "horizontal": true},
+			{"row": 4, "col": 1, "length": 3, "horizontal": true},
+			{"row": 5, "col": 1, "length": 2, "horizontal": true}
+		]}`},
+		{name: "off the board", setup: `{"ships": [
+			{"row": 1, "col": 7, "length": 5, "horizontal": true},
+			{"row": 2, "col": 1, "length": 4, "horizontal": true},
+			{"row": 3, "col": 1, "length": 3, "horizontal": true},
+			{"row": 4, "col": 1, "length": 3, "horizontal": true},
+			{"row": 5, "col": 1, "length": 2, "horizontal": true}
+		]}`},
+		{name: "invalid json", setup: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBattleship().(*battleship)
+			err := b.Setup(PlayerOne, json.RawMessage(tt.setup))
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want success %v", err, tt.ok)
+			}
+			if b.SetupDone(PlayerOne) != tt.ok {
+				t.Fatalf("got setup done %v, want %v", b.SetupDone(PlayerOne), tt.ok)
+			}
+		})
+	}
+}
+
+func TestBattleshipSetupWithoutData(t *testing.T) {
+	b := newBattleship().(*battleship)
+	if err := b.Play("1*1"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v before the setup", err, ErrIllegalMove)
+	}
+
+	if err := b.Setup(PlayerTwo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.boards[PlayerTwo].ships) != len(battleshipFleet) {
+		t.Fatalf("got %d randomly placed ships, want %d", len(b.boards[PlayerTwo].ships), len(battleshipFleet))
+	}
+	if err := b.Setup(PlayerTwo, nil); err == nil {
+		t.Fatal("placed the ships twice")
+	}
+	if b.Moves() != nil {
+		t.Fatal("got moves before both players placed their ships")
+	}
+}
+
+func TestBattleshipShots(t *testing.T) {
+	b := newTestBattleship(t)
+
+	tests := []struct {
+		move   string
+		result string
+	}{
+		{"5*1", shotHit},
+		{"10*10", shotMiss},
+		{"5*2", shotSunk},
+		{"9*9", shotMiss},
+		{"6*1", shotMiss},
+	}
+	for _, tt := range tests {
+		playMoves(t, b, tt.move)
+		if got := b.LastResult(); got != tt.result {
+			t.Fatalf("shot %s: got %s, want %s", tt.move, got, tt.result)
+		}
+	}
+
+	if err := b.Play("10*10"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	for _, move := range []string{"", "11", "0*1", "11*1", "1*11"} {
+		if err := b.Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+}
+
+func TestBattleshipViewHidesShips(t *testing.T) {
+	b := newTestBattleship(t)
+	playMoves(t, b, "5*1", "10*10", "5*2", "1*1")
+
+	view := b.View(PlayerOne).(*battleshipView)
+	if view.Own.Cells[0] != cellHit || view.Own.Cells[1] != cellShip || view.Own.Cells[99] != cellMiss {
+		t.Fatalf("got own cells %s, %s and %s, want a hit ship and a miss", view.Own.Cells[0], view.Own.Cells[1], view.Own.Cells[99])
+	}
+	if len(view.Own.Ships) != len(battleshipFleet) {
+		t.Fatalf("got %d own ships, want %d", len(view.Own.Ships), len(battleshipFleet))
+	}
+	if view.Opponent.Cells[0] != cellEmpty {
+		t.Fatalf("got opponent cell %s, want an unknown ship", view.Opponent.Cells[0])
+	}
+	if len(view.Opponent.Ships) != 1 || view.Opponent.Ships[0].Length != 2 {
+		t.Fatalf("got opponent ships %v, want only the sunk ship", view.Opponent.Ships)
+	}
+	if view.Opponent.Cells[40] != cellSunk {
+		t.Fatalf("got opponent cell %s, want %s", view.Opponent.Cells[40], cellSunk)
+	}
+}
+
+func TestBattleshipWin(t *testing.T) {
+	b := newTestBattleship(t)
+
+	var misses int
+	for i, length := range battleshipFleet {
+		for col := 1; col <= length; col++ {
+			if b.Outcome().Done {
+				t.Fatal("game is over before all ships are sunk")
+			}
+			playMoves(t, b, fmt.Sprintf("%d*%d", i+1, col))
+			if b.Outcome().Done {
+				break
+			}
+			playMoves(t, b, fmt.Sprintf("%d*%d", 10-misses/10, misses%10+1))
+			misses++
+		}
+	}
+
+	if outcome := b.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerOne}) {
+		t.Fatalf("got %+v, want a win of %v", outcome, PlayerOne)
+	}
+	if b.Moves() != nil {
+		t.Fatal("got moves after the game is over")
+	}
+}
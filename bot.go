@@ -0,0 +1,355 @@
+package voipttt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// BotConfig configures an external program that plays against callers, e.g. in a
+// bot competition. The program speaks the bot protocol over stdin and stdout,
+// which is described in ARCHITECTURE.md.
+type BotConfig struct {
+	// Name of the bot, which the player chooses on the website and sees as the
+	// phone number of their opponent.
+	Name string
+	// Command is the program and its arguments. A new process is started for every game.
+	Command []string
+	// MoveTimeout is the time the bot has for a single move. Defaults to ten seconds.
+	MoveTimeout time.Duration
+}
+
+// WithBot lets players choose the bot as their opponent on the website.
+// Bots with the same name replace each other.
+func WithBot(config BotConfig) ServerOption {
+	return func(s *Server) {
+		if config.MoveTimeout == 0 {
+			config.MoveTimeout = 10 * time.Second
+		}
+		s.wsManager.bots[config.Name] = config
+	}
+}
+
+const (
+	// botStartTimeout is the time a bot has to answer the handshake after it was started.
+	botStartTimeout = 10 * time.Second
+	// botQuitTimeout is the time a bot has to exit after it was told to quit.
+	botQuitTimeout = 2 * time.Second
+)
+
+// botPlayer is the call of a bot process. Moves are read from the process
+// and the events of the game are written to it.
+//
+// A bot that breaks the protocol, e.g. by answering with an illegal move, is stopped,
+// which the game treats like a caller hanging up. A bot that does not answer in time
+// is only told to stop searching and keeps playing.
+type botPlayer struct {
+	config BotConfig
+	game   Game
+	// Updated by the announcements of the game.
+	state any
+	moves []string
+	// lateMoves is the number of searches that were stopped, whose moves are ignored.
+	lateMoves int
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string   // Lines written by the bot, closed once stdout is closed.
+	done  chan struct{} // Closed once the process exited.
+	// stopping is closed once the bot is told to quit or killed, so that its lines,
+	// e.g. a late move, are no longer passed on.
+	stopping chan struct{}
+	stopOnce sync.Once
+	log      zerolog.Logger
+}
+
+// startBot starts the bot process and waits until it is ready to play the game.
+func startBot(config BotConfig, rules Game, log zerolog.Logger) (*botPlayer, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("missing command of bot")
+	}
+
+	cmd := exec.Command(config.Command[0], config.Command[1:]...)
+	cmd.Stderr = log.With().Str("stream", "stderr").Logger()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("open stdin of bot: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("open stdout of bot: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start bot: %w", err)
+	}
+
+	b := &botPlayer{
+		config:   config,
+		game:     rules,
+		cmd:      cmd,
+		stdin:    stdin,
+		lines:    make(chan string),
+		done:     make(chan struct{}),
+		stopping: make(chan struct{}),
+		log:      log,
+	}
+	go b.readLines(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), botStartTimeout)
+	defer cancel()
+	if err := b.handshake(ctx); err != nil {
+		b.kill()
+		return nil, err
+	}
+	return b, nil
+}
+
+// readLines passes the lines written by the bot on, until stdout is closed.
+func (b *botPlayer) readLines(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		b.log.Debug().Str("line", line).Msg("Received line from bot")
+		select {
+		case b.lines <- line:
+		case <-b.stopping:
+		}
+	}
+	close(b.lines)
+
+	err := b.cmd.Wait()
+	b.log.Info().Err(err).Msg("Bot exited")
+	close(b.done)
+}
+
+// handshake waits until the bot is ready.
+func (b *botPlayer) handshake(ctx context.Context) error {
+	if err := b.send("vtei"); err != nil {
+		return err
+	}
+	for {
+		line, err := b.readLine(ctx)
+		if err != nil {
+			return fmt.Errorf("bot handshake: %w", err)
+		}
+		switch {
+		case line == "vteiok":
+			return nil
+		case strings.HasPrefix(line, "id "):
+			b.log.Info().Str("id", strings.TrimPrefix(line, "id ")).Msg("Bot identified itself")
+		default:
+			b.log.Warn().Str("line", line).Msg("Ignored unknown line from bot")
+		}
+	}
+}
+
+// send writes a single line to the bot.
+func (b *botPlayer) send(line string) error {
+	b.log.Debug().Str("line", line).Msg("Send line to bot")
+	if _, err := io.WriteString(b.stdin, line+"\n"); err != nil {
+		return fmt.Errorf("send %q to bot: %w", strings.Fields(line)[0], err)
+	}
+	return nil
+}
+
+// readLine returns the next line written by the bot.
+func (b *botPlayer) readLine(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case line, ok := <-b.lines:
+		if !ok {
+			return "", errors.New("bot closed its output")
+		}
+		return line, nil
+	}
+}
+
+// kill stops the process and waits until it exited.
+func (b *botPlayer) kill() {
+	b.stopOnce.Do(func() { close(b.stopping) })
+	_ = b.cmd.Process.Kill()
+	<-b.done
+}
+
+// ReadMove sends the position to the bot and returns its best move. If the bot does
+// not answer in time, it is told to stop and its late move is ignored. If it answers
+// with a move that is not legal or breaks the protocol otherwise, it is stopped.
+func (b *botPlayer) ReadMove(ctx context.Context, _ InputSpec) (string, error) {
+	move, err := b.readMove(ctx)
+	switch {
+	case err == nil:
+		return move, nil
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		b.lateMoves++
+		if sendErr := b.send("stop"); sendErr != nil {
+			b.log.Warn().Err(sendErr).Msg("Failed to stop search of bot")
+		}
+		if ctx.Err() == nil {
+			// Only the move timeout of the bot ran out, so it lost on time
+			// like a caller who does not enter a move.
+			return "", fmt.Errorf("bot did not answer within %s: %w", b.config.MoveTimeout, &InputTimeoutError{Attempts: 1})
+		}
+		return "", err
+	default:
+		b.kill()
+		return "", err
+	}
+}
+
+func (b *botPlayer) readMove(ctx context.Context) (string, error) {
+	state, err := json.Marshal(b.state)
+	if err != nil {
+		return "", fmt.Errorf("encode state for bot: %w", err)
+	}
+	legal := b.game.Moves()
+
+	// The bot must also answer before the clock of the game runs out.
+	ctx, cancel := context.WithTimeout(ctx, b.config.MoveTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	movetime := time.Until(deadline).Milliseconds()
+
+	position := "position startpos"
+	if len(b.moves) > 0 {
+		position += " moves " + strings.Join(b.moves, " ")
+	}
+	for _, line := range []string{
+		position,
+		"state " + string(state),
+		"legal " + strings.Join(legal, " "),
+		"go movetime " + strconv.FormatInt(movetime, 10),
+	} {
+		if err := b.send(line); err != nil {
+			return "", err
+		}
+	}
+
+	for {
+		line, err := b.readLine(ctx)
+		if err != nil {
+			return "", fmt.Errorf("read move of bot: %w", err)
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "info":
+			b.log.Info().Str("info", strings.TrimPrefix(line, "info ")).Msg("Bot sent info")
+		case "bestmove":
+			if b.lateMoves > 0 {
+				b.lateMoves--
+				b.log.Info().Str("line", line).Msg("Ignored late move of bot")
+				continue
+			}
+			if len(fields) != 2 {
+				return "", fmt.Errorf("bot sent %q instead of a single move", line)
+			}
+			for _, move := range legal {
+				if move == fields[1] {
+					return move, nil
+				}
+			}
+			return "", fmt.Errorf("bot sent illegal move %q", fields[1])
+		default:
+			b.log.Warn().Str("line", line).Msg("Ignored unknown line from bot")
+		}
+	}
+}
+
+func (b *botPlayer) StartAudio(context.Context) error {
+	return nil
+}
+
+// Announce keeps track of the game and tells the bot about its start and end.
+func (b *botPlayer) Announce(_ context.Context, announcement Announcement) error {
+	switch data := announcement.Data.(type) {
+	case *dataOpponentReady:
+		b.state = data.State
+		return b.send(fmt.Sprintf("newgame %s %d", data.Game, data.Player))
+	case *dataAnnounceTurnInfo:
+		b.state = data.State
+		if data.Move == "" {
+			// The player ran out of time and the turn was skipped.
+			b.moves = append(b.moves, "skip")
+		} else {
+			b.moves = append(b.moves, data.Move)
+		}
+	case *dataGameDone:
+		result := "draw"
+		switch {
+		case data.HasWinner && data.IsPlayerWinner:
+			result = "win"
+		case data.HasWinner:
+			result = "loss"
+		}
+		return b.send("gameover " + result)
+	}
+	return nil
+}
+
+// Hangup tells the bot to quit and stops it if it does not exit in time.
+func (b *botPlayer) Hangup(context.Context) error {
+	select {
+	case <-b.done:
+		return nil
+	default:
+	}
+
+	_ = b.send("quit")
+	_ = b.stdin.Close()
+	b.stopOnce.Do(func() { close(b.stopping) })
+	select {
+	case <-b.done:
+	case <-time.After(botQuitTimeout):
+		b.log.Warn().Msg("Bot did not quit in time")
+		b.kill()
+	}
+	return nil
+}
+
+func (b *botPlayer) Done() <-chan struct{} {
+	return b.done
+}
+
+// newBotClient starts the bot and returns a client without web socket connection for it.
+func newBotClient(config BotConfig, rules Game, gameType string) (*webSocketClient, error) {
+	l := log.Logger.With().
+		Str("game", gameType).
+		Str("bot", config.Name).
+		Logger()
+	bot, err := startBot(config, rules, l)
+	if err != nil {
+		return nil, err
+	}
+	return &webSocketClient{
+		connMu:      new(sync.Mutex),
+		phoneNumber: PhoneNumber(config.Name),
+		gameType:    gameType,
+		call:        bot,
+		log:         l,
+	}, nil
+}
+
+// botNames returns the names of all bots in alphabetical order.
+func (wsm *webSocketManager) botNames() []string {
+	names := make([]string, 0, len(wsm.bots))
+	for name := range wsm.bots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,145 @@
+package voipttt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// botModeEnv selects the behavior of the test bot, which runs as a helper process
+// of the test binary, see TestBotHelperProcess.
+const botModeEnv = "VOIPTTT_TEST_BOT"
+
+// TestBotHelperProcess is not a real test, but the bot that the other tests start.
+// In mode "slow" the bot does not answer its first search until it is stopped,
+// in mode "illegal" it answers with a move that is never legal and in mode "exit"
+// it exits instead of answering the handshake.
+func TestBotHelperProcess(t *testing.T) {
+	mode := os.Getenv(botModeEnv)
+	if mode == "" {
+		t.Skip("only runs as a bot")
+	}
+
+	var legal []string
+	searches := 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch fields[0] {
+		case "vtei":
+			if mode == "exit" {
+				os.Exit(1)
+			}
+			fmt.Println("id name test bot")
+			fmt.Println("unknown line")
+			fmt.Println("vteiok")
+		case "legal":
+			legal = fields[1:]
+		case "go":
+			searches++
+			switch {
+			case mode == "illegal":
+				fmt.Println("bestmove 0")
+			case mode == "slow" && searches == 1:
+				// Waits for stop.
+			default:
+				fmt.Println("bestmove " + legal[0])
+			}
+		case "stop":
+			fmt.Println("bestmove " + legal[len(legal)-1])
+		case "quit":
+			os.Exit(0)
+		}
+	}
+	os.Exit(0)
+}
+
+func startTestBot(t *testing.T, mode string) *botPlayer {
+	t.Helper()
+	t.Setenv(botModeEnv, mode)
+	config := BotConfig{
+		Name:        "test",
+		Command:     []string{os.Args[0], "-test.run=^TestBotHelperProcess$"},
+		MoveTimeout: time.Second * 10,
+	}
+	b, err := startBot(config, new(ticTacToe), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Hangup(context.Background()) })
+	return b
+}
+
+func TestBotHandshake(t *testing.T) {
+	b := startTestBot(t, "fast")
+	select {
+	case <-b.Done():
+		t.Fatal("bot exited after the handshake")
+	default:
+	}
+
+	t.Setenv(botModeEnv, "exit")
+	config := BotConfig{Name: "test", Command: []string{os.Args[0], "-test.run=^TestBotHelperProcess$"}}
+	if _, err := startBot(config, new(ticTacToe), zerolog.Nop()); err == nil {
+		t.Fatal("started a bot that did not answer the handshake")
+	}
+}
+
+func TestBotIgnoresLateMove(t *testing.T) {
+	b := startTestBot(t, "slow")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if _, err := b.ReadMove(ctx, MoveInputSpec); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-b.Done():
+		t.Fatal("bot was stopped after the deadline")
+	default:
+	}
+
+	// The move the bot sends after stop is for the previous search.
+	move, err := b.ReadMove(context.Background(), MoveInputSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move != "1" {
+		t.Fatalf("got move %q, want 1 instead of the late move", move)
+	}
+}
+
+func TestBotMoveTimeout(t *testing.T) {
+	b := startTestBot(t, "slow")
+	b.config.MoveTimeout = time.Millisecond * 200
+
+	_, err := b.ReadMove(context.Background(), MoveInputSpec)
+	if !isInputTimeout(err) {
+		t.Fatalf("got %v, want an input timeout", err)
+	}
+	select {
+	case <-b.Done():
+		t.Fatal("bot was stopped after its move timeout")
+	default:
+	}
+}
+
+func TestBotIllegalMoveStopsBot(t *testing.T) {
+	b := startTestBot(t, "illegal")
+
+	if _, err := b.ReadMove(context.Background(), MoveInputSpec); err == nil {
+		t.Fatal("accepted an illegal move")
+	}
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("bot was not stopped after an illegal move")
+	}
+}
@@ -0,0 +1,374 @@
+package voipttt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/n9v9/voip-ttt/audio"
+)
+
+const (
+	webhookSelectDigitURL = "/calls/{callID}/digit"
+	webhookHeartbeatURL   = "/calls/{callID}/heartbeat"
+	webhookGameDoneURL    = "/calls/{callID}/done"
+	webhookGameStartURL   = "/calls/{callID}/start"
+	webhookAnnounceURL    = "/calls/{callID}/announce"
+)
+
+// Call is the telephony side of a single call, e.g. an AGI or an ARI channel.
+type Call interface {
+	// PhoneNumber returns the phone number of the caller.
+	PhoneNumber() PhoneNumber
+	// Channel returns the asterisk channel of the call, which may be empty.
+	Channel() string
+	// ReadInput waits for the caller to enter keys as described by the spec.
+	ReadInput(ctx context.Context, spec InputSpec) (string, error)
+	// StartAudio starts streaming the audio of the caller to the given web socket URL
+	// of the private API.
+	StartAudio(ctx context.Context, audioURL string) error
+	// Play plays the voice prompts to the caller one after another.
+	Play(ctx context.Context, prompts []Prompt) error
+}
+
+// callSession is a single call that is registered with the game server.
+type callSession struct {
+	id       string
+	call     Call
+	done     chan struct{}
+	doneOnce sync.Once
+	log      zerolog.Logger
+}
+
+// finish marks the session as done, which ends the call.
+func (s *callSession) finish() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+// CallClient registers calls with the private API of the game server and serves
+// the webhooks that the game server uses to communicate with each call.
+// Each method is concurrency safe.
+type CallClient struct {
+	callCounter atomic.Uint64
+
+	sessions   map[string]*callSession
+	sessionsMu *sync.Mutex
+
+	// Address the webhook server listens on.
+	webhookAddr string
+	// Address of the private API of the game server.
+	serverAddr string
+
+	// Whether callers are guided through the game by voice prompts.
+	voicePrompts bool
+
+	codeInput InputSpec
+	moveInput InputSpec
+}
+
+// CallClientOption configures optional features of a CallClient.
+type CallClientOption func(*CallClient)
+
+// WithVoicePrompts guides callers through the game with voice prompts, so that
+// the game can be played without looking at the website.
+func WithVoicePrompts() CallClientOption {
+	return func(cc *CallClient) {
+		cc.voicePrompts = true
+	}
+}
+
+// WithInputSpecs changes how the verification code and the moves are entered,
+// which default to CodeInputSpec and MoveInputSpec. The game server may override
+// the lengths, the terminator and the clear key of a move, depending on the game.
+func WithInputSpecs(code, move InputSpec) CallClientOption {
+	return func(cc *CallClient) {
+		cc.codeInput = code
+		cc.moveInput = move
+	}
+}
+
+// NewCallClient returns a client whose webhooks are reachable at webhookAddr and
+// which registers calls with the private API listening on serverAddr.
+func NewCallClient(webhookAddr, serverAddr string, opts ...CallClientOption) *CallClient {
+	cc := &CallClient{
+		sessions:    map[string]*callSession{},
+		sessionsMu:  new(sync.Mutex),
+		webhookAddr: webhookAddr,
+		serverAddr:  serverAddr,
+		codeInput:   CodeInputSpec,
+		moveInput:   MoveInputSpec,
+	}
+	for _, opt := range opts {
+		opt(cc)
+	}
+	return cc
+}
+
+// Handler returns the handler serving the webhooks of all calls.
+func (cc *CallClient) Handler() http.Handler {
+	mux := chi.NewMux()
+	RegisterHTTPMiddleware(mux)
+	mux.Get(webhookSelectDigitURL, cc.withSession(cc.handleSelectDigitWebhook))
+	mux.Get(webhookGameStartURL, cc.withSession(cc.handleGameStartWebhook))
+	mux.Get(webhookGameDoneURL, cc.withSession(handleGameDoneWebhook))
+	mux.Get(webhookHeartbeatURL, cc.withSession(handleHeartbeatWebhook))
+	mux.Post(webhookAnnounceURL, cc.withSession(handleAnnounceWebhook))
+	return mux
+}
+
+// withSession looks up the session of the webhook and passes it to the given handler.
+func (cc *CallClient) withSession(handler func(*callSession) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "callID")
+
+		cc.sessionsMu.Lock()
+		s, ok := cc.sessions[id]
+		cc.sessionsMu.Unlock()
+
+		if !ok {
+			hlog.FromRequest(r).Warn().Str("call_id", id).Msg("Received webhook for unknown call")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		handler(s)(w, r)
+	}
+}
+
+// HandleCall prompts the caller for the verification code, registers the call
+// with the game server and blocks until the game is done or the context is cancelled.
+func (cc *CallClient) HandleCall(ctx context.Context, call Call, l zerolog.Logger) error {
+	id := strconv.FormatUint(cc.callCounter.Add(1), 10)
+	s := &callSession{
+		id:   id,
+		call: call,
+		done: make(chan struct{}),
+		log:  l.With().Str("call_id", id).Logger(),
+	}
+
+	if cc.voicePrompts {
+		if err := call.Play(ctx, []Prompt{{Sound: SoundEnterCode}}); err != nil {
+			s.log.Err(err).Msg("Failed to play prompt")
+		}
+	}
+
+	s.log.Info().Msg("Waiting for verification code")
+	keys, err := call.ReadInput(ctx, cc.codeInput)
+	if err != nil {
+		return fmt.Errorf("prompt verification code: %w", err)
+	}
+	code, err := strconv.ParseUint(keys, 10, 64)
+	if err != nil {
+		return fmt.Errorf("verification code %q is not a number", keys)
+	}
+
+	cc.sessionsMu.Lock()
+	cc.sessions[id] = s
+	cc.sessionsMu.Unlock()
+
+	defer func() {
+		cc.sessionsMu.Lock()
+		delete(cc.sessions, id)
+		cc.sessionsMu.Unlock()
+	}()
+
+	req := RegisterClientRequest{
+		VerificationCode:  VerificationCode(code),
+		ClientPhoneNumber: call.PhoneNumber(),
+		SelectDigitURL:    cc.webhookURL(s, webhookSelectDigitURL),
+		HeartbeatURL:      cc.webhookURL(s, webhookHeartbeatURL),
+		GameDoneURL:       cc.webhookURL(s, webhookGameDoneURL),
+		GameStartURL:      cc.webhookURL(s, webhookGameStartURL),
+		Channel:           call.Channel(),
+	}
+	if cc.voicePrompts {
+		req.AnnounceURL = cc.webhookURL(s, webhookAnnounceURL)
+	}
+
+	s.log.Info().Msg("Calling server to register application")
+	if err := RegisterClient(ctx, cc.serverAddr, req); err != nil {
+		return fmt.Errorf("register application: %w", err)
+	}
+	s.log.Info().Msg("Application is registered")
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// webhookURL returns the URL of the given webhook route for the session.
+func (cc *CallClient) webhookURL(s *callSession, route string) WebhookURL {
+	path := strings.Replace(route, "{callID}", s.id, 1)
+	return WebhookURL(fmt.Sprintf("http://%s%s", cc.webhookAddr, path))
+}
+
+// AudioStreamURL returns the URL of the private API listening on serverAddr
+// that receives the audio stream of the caller with the given phone number.
+func AudioStreamURL(serverAddr string, phoneNumber PhoneNumber) string {
+	return fmt.Sprintf(
+		"ws://%s%s?phoneNumber=%s",
+		serverAddr,
+		RoutePrivateAPIAudio,
+		url.QueryEscape(string(phoneNumber)),
+	)
+}
+
+// SetAudioFormat returns the audioURL returned by AudioStreamURL with the given format
+// declared, which is needed if the audio is not in the format of audio.FormatTelephone.
+func SetAudioFormat(audioURL string, format audio.Format) (string, error) {
+	u, err := url.Parse(audioURL)
+	if err != nil {
+		return "", fmt.Errorf("parse audio url: %w", err)
+	}
+	q := u.Query()
+	format.AddToQuery(q)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// RegisterClient executes the registration process with the private API listening on
+// serverAddr to verify the code of the given request and hook up the necessary callbacks.
+func RegisterClient(ctx context.Context, serverAddr string, data RegisterClientRequest) error {
+	url := fmt.Sprintf("http://%s%s", serverAddr, RoutePrivateAPIRegister)
+
+	body, err := json.Marshal(&data)
+	if err != nil {
+		return fmt.Errorf("marshal register JSON: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create POST request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send POST request: %w", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected HTTP status code 200 OK, but got %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (cc *CallClient) handleSelectDigitWebhook(s *callSession) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := hlog.FromRequest(r)
+		l.Info().Msg("Received get digit request")
+
+		// The game decides how the keys of a move are entered, the client
+		// only decides about the timeouts.
+		spec, err := cc.moveInput.withKeysFromQuery(r.URL.Query())
+		if err != nil {
+			l.Err(err).Msg("Invalid move input")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		keys, err := s.call.ReadInput(r.Context(), spec)
+		var timeoutErr *InputTimeoutError
+		switch {
+		case errors.As(err, &timeoutErr):
+			l.Info().Err(err).Msg("Caller did not enter a move")
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		case errors.Is(err, ErrInvalidInput):
+			l.Info().Err(err).Msg("Caller did not enter a valid move")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		case err != nil:
+			l.Err(err).Msg("Failed to get digit")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// The game validates the move, the digit only exists for older servers.
+		data := ReceiveDigitRequest{Keys: keys}
+		data.Digit, _ = strconv.Atoi(keys)
+		if err := json.NewEncoder(w).Encode(&data); err != nil {
+			l.Err(err).
+				Str("keys", keys).
+				Interface("data", data).
+				Msg("Failed to respond with selected digit")
+			s.finish()
+		}
+	}
+}
+
+func (cc *CallClient) handleGameStartWebhook(s *callSession) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := hlog.FromRequest(r)
+		l.Info().Msg("Received game start notification. Start audio stream.")
+
+		audioURL := AudioStreamURL(cc.serverAddr, s.call.PhoneNumber())
+		if err := s.call.StartAudio(r.Context(), audioURL); err != nil {
+			l.Err(err).Msg("Failed to start audio stream")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleGameDoneWebhook(s *callSession) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hlog.FromRequest(r).Info().Msg("Received game done notification")
+		w.WriteHeader(http.StatusOK)
+		s.finish()
+	}
+}
+
+func handleAnnounceWebhook(s *callSession) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := hlog.FromRequest(r)
+
+		var announcement announcementRequest
+		if err := json.NewDecoder(r.Body).Decode(&announcement); err != nil {
+			l.Err(err).Msg("Failed to decode announcement")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		l.Info().Str("announcement", announcement.Type).Msg("Received announcement")
+
+		prompts, err := announcement.prompts()
+		if err != nil {
+			l.Err(err).Msg("Failed to create voice prompts for announcement")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// The game waits for the prompts, so that the caller does not enter
+		// their next move before they heard the announcement.
+		if err := s.call.Play(r.Context(), prompts); err != nil {
+			l.Err(err).Msg("Failed to play voice prompts")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleHeartbeatWebhook(_ *callSession) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hlog.FromRequest(r).Info().Msg("Received heartbeat check")
+		w.WriteHeader(http.StatusOK)
+	}
+}
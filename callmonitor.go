@@ -0,0 +1,175 @@
+package voipttt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/n9v9/voip-ttt/ami"
+)
+
+// AMIConfig configures the connection to the asterisk manager interface.
+type AMIConfig struct {
+	Addr     string
+	Username string
+	Secret   string
+}
+
+// callMonitor watches the calls of all registered clients through the
+// asterisk manager interface to detect when a caller hangs up.
+type callMonitor struct {
+	config    AMIConfig
+	wsManager *webSocketManager
+
+	// Caller ID of each active channel as announced by Newchannel events.
+	// Used to find the client of a channel if it did not register its channel.
+	channelPhoneNumbers   map[string]PhoneNumber
+	channelPhoneNumbersMu *sync.Mutex
+
+	// The currently connected client, nil while reconnecting.
+	client   *ami.Client
+	clientMu *sync.Mutex
+
+	log zerolog.Logger
+}
+
+func newCallMonitor(config AMIConfig, wsManager *webSocketManager) *callMonitor {
+	return &callMonitor{
+		config:                config,
+		wsManager:             wsManager,
+		channelPhoneNumbers:   map[string]PhoneNumber{},
+		channelPhoneNumbersMu: new(sync.Mutex),
+		clientMu:              new(sync.Mutex),
+		log:                   log.Logger.With().Str("ami_addr", config.Addr).Logger(),
+	}
+}
+
+// run connects to the asterisk manager interface and handles its events.
+// If the connection is lost, it reconnects until the context is cancelled.
+func (cm *callMonitor) run(ctx context.Context) {
+	cm.log.Info().Msg("Started AMI call monitor")
+	defer cm.log.Info().Msg("Stopped AMI call monitor")
+
+	const reconnectDelay = time.Second * 5
+
+	for {
+		if err := cm.connect(ctx); err != nil {
+			cm.log.Err(err).Dur("reconnect_delay", reconnectDelay).Msg("AMI connection failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// connect logs in and blocks until either the connection is lost or the context is cancelled.
+func (cm *callMonitor) connect(ctx context.Context) error {
+	client, err := ami.Dial(ctx, cm.config.Addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	client.Subscribe(cm.handleNewchannel, ami.EventNewchannel)
+	client.Subscribe(cm.handleHangup, ami.EventHangup)
+	client.Subscribe(cm.handleDTMF, ami.EventDTMFEnd)
+
+	if err := client.Login(ctx, cm.config.Username, cm.config.Secret, "call,dtmf"); err != nil {
+		return err
+	}
+	cm.log.Info().Msg("Logged in to AMI")
+
+	cm.clientMu.Lock()
+	cm.client = client
+	cm.clientMu.Unlock()
+
+	defer func() {
+		cm.clientMu.Lock()
+		cm.client = nil
+		cm.clientMu.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		logoffCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = client.Logoff(logoffCtx)
+		return nil
+	case <-client.Done():
+		return client.Err()
+	}
+}
+
+// hangup hangs up the given channel, which is used in case a client could not
+// be notified through its webhook that the game is done.
+func (cm *callMonitor) hangup(ctx context.Context, channel string) error {
+	cm.clientMu.Lock()
+	client := cm.client
+	cm.clientMu.Unlock()
+
+	if client == nil {
+		return ami.ErrClosed
+	}
+	return client.Hangup(ctx, channel)
+}
+
+func (cm *callMonitor) handleNewchannel(event ami.Event) {
+	channel := event.Get("Channel")
+	phoneNumber := PhoneNumber(event.Get("CallerIDNum"))
+
+	cm.log.Debug().
+		Str("channel", channel).
+		Str("phone_number", string(phoneNumber)).
+		Msg("New channel")
+
+	cm.channelPhoneNumbersMu.Lock()
+	cm.channelPhoneNumbers[channel] = phoneNumber
+	cm.channelPhoneNumbersMu.Unlock()
+}
+
+func (cm *callMonitor) handleHangup(event ami.Event) {
+	channel := event.Get("Channel")
+
+	cm.channelPhoneNumbersMu.Lock()
+	phoneNumber, ok := cm.channelPhoneNumbers[channel]
+	delete(cm.channelPhoneNumbers, channel)
+	cm.channelPhoneNumbersMu.Unlock()
+
+	if !ok {
+		phoneNumber = PhoneNumber(event.Get("CallerIDNum"))
+	}
+
+	cm.log.Info().
+		Str("channel", channel).
+		Str("phone_number", string(phoneNumber)).
+		Str("cause", event.Get("Cause-txt")).
+		Msg("Channel hung up")
+
+	cm.wsManager.hangup(channel, phoneNumber)
+}
+
+// handleDTMF logs the digits of a channel together with the phone number of its caller.
+// The digits of a move are still read by the client of the call.
+func (cm *callMonitor) handleDTMF(event ami.Event) {
+	channel := event.Get("Channel")
+
+	cm.channelPhoneNumbersMu.Lock()
+	phoneNumber, ok := cm.channelPhoneNumbers[channel]
+	cm.channelPhoneNumbersMu.Unlock()
+
+	if !ok {
+		phoneNumber = PhoneNumber(event.Get("CallerIDNum"))
+	}
+
+	cm.log.Debug().
+		Str("channel", channel).
+		Str("phone_number", string(phoneNumber)).
+		Str("digit", event.Get("Digit")).
+		Msg("Received DTMF")
+}
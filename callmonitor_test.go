@@ -0,0 +1,127 @@
+package voipttt
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeAMI accepts a single AMI connection, accepts the login and then replays the given events.
+func fakeAMI(t *testing.T, events ...string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		_, _ = conn.Write([]byte("Asterisk Call Manager/5.0.2\r\n"))
+
+		var actionID string
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			if key, id, _ := strings.Cut(line, ": "); key == "ActionID" {
+				actionID = id
+			}
+		}
+		_, _ = conn.Write([]byte("Response: Success\r\nActionID: " + actionID + "\r\nMessage: Authentication accepted\r\n\r\n"))
+		for _, event := range events {
+			_, _ = conn.Write([]byte(event + "\r\n\r\n"))
+		}
+		// Keep the connection open until the test ends.
+		_, _ = reader.ReadString(0)
+	}()
+	return l.Addr().String()
+}
+
+func TestCallMonitorForfeitsGameOfHungUpChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string // Channel registered by the client.
+	}{
+		{name: "registered channel", channel: "SIP/100-00000001"},
+		{name: "caller id of new channel", channel: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeAMI(t,
+				"Event: Newchannel\r\nChannel: SIP/200-00000002\r\nCallerIDNum: 200",
+				"Event: Newchannel\r\nChannel: SIP/100-00000001\r\nCallerIDNum: 100",
+				"Event: DTMFEnd\r\nChannel: SIP/100-00000001\r\nDigit: 5",
+				"Event: Hangup\r\nChannel: SIP/100-00000001\r\nCause-txt: Normal Clearing",
+			)
+
+			// The webhook of the call waits for a digit until the request is cancelled.
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}))
+			defer webhook.Close()
+
+			wsm := newManager("123")
+			cm := newCallMonitor(AMIConfig{Addr: addr}, wsm)
+			wsm.callMonitor = cm
+			call := newWebhookCall(RegisterClientRequest{
+				ClientPhoneNumber: "100",
+				SelectDigitURL:    WebhookURL(webhook.URL),
+				Channel:           tt.channel,
+			}, cm, zerolog.Nop())
+			wsm.trackCall(call)
+
+			playerOne, _, _ := newTestClient(t, "100", call)
+			opponentCall := newTestCall(nil)
+			playerTwo, _, _ := newTestClient(t, "200", opponentCall)
+			g := &game{
+				playerOne:   playerOne,
+				playerTwo:   playerTwo,
+				game:        new(ticTacToe),
+				invalidMove: defaultInvalidMoveConfig,
+				log:         zerolog.Nop(),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			go cm.run(ctx)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				g.run(ctx)
+			}()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				t.Fatal("game did not end after the hangup")
+			}
+
+			gameDone := opponentCall.announced(string(messageGameDone))
+			if len(gameDone) != 1 {
+				t.Fatalf("opponent got %d GAME_DONE announcements", len(gameDone))
+			}
+			if data := gameDone[0].(*dataGameDone); data.Reason != gameDoneHangup || !data.IsPlayerWinner {
+				t.Fatalf("opponent got %+v, want a win because of the hangup", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package voipttt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// CallSession is the telephony side of a player, i.e. their phone call,
+// which the game uses to read moves and to notify the caller.
+// New telephony backends are added by implementing this interface.
+type CallSession interface {
+	// ReadMove waits for the player to enter their next move as described by the spec
+	// of the game and returns the entered keys without the terminator.
+	ReadMove(ctx context.Context, spec InputSpec) (string, error)
+	// StartAudio requests the call to stream its audio to the private API.
+	StartAudio(ctx context.Context) error
+	// Announce notifies the caller about an event of the game.
+	Announce(ctx context.Context, announcement Announcement) error
+	// Hangup ends the call because the game is done.
+	Hangup(ctx context.Context) error
+	// Done returns a channel that is closed when the caller hung up.
+	Done() <-chan struct{}
+}
+
+// Announcement is an event of the game that is announced to the caller.
+// Most announcements carry the same type and data as the web socket message the player's
+// browser receives, others only exist for callers that play without the browser.
+type Announcement struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// webhookCall is the CallSession of a client that registered itself
+// through the private API, e.g. vt-client or vt-ari, and is controlled through webhooks.
+type webhookCall struct {
+	phoneNumber  PhoneNumber
+	channel      string // Asterisk channel of the call, may be empty.
+	getDigitURL  WebhookURL
+	heartbeatURL WebhookURL
+	gameDoneURL  WebhookURL
+	gameStartURL WebhookURL
+	announceURL  WebhookURL // May be empty.
+
+	hungUp     chan struct{}
+	hungUpOnce *sync.Once
+
+	// Used to hang up calls that could not be notified that the game is done.
+	// Nil if the server is not connected to the asterisk manager interface.
+	callMonitor *callMonitor
+	// Called once the call is over, either because the game is done or the caller hung up.
+	release func()
+
+	log zerolog.Logger
+}
+
+func newWebhookCall(req RegisterClientRequest, callMonitor *callMonitor, log zerolog.Logger) *webhookCall {
+	return &webhookCall{
+		phoneNumber:  req.ClientPhoneNumber,
+		channel:      req.Channel,
+		getDigitURL:  req.SelectDigitURL,
+		heartbeatURL: req.HeartbeatURL,
+		gameDoneURL:  req.GameDoneURL,
+		gameStartURL: req.GameStartURL,
+		announceURL:  req.AnnounceURL,
+		hungUp:       make(chan struct{}),
+		hungUpOnce:   new(sync.Once),
+		callMonitor:  callMonitor,
+		release:      func() {},
+		log:          log,
+	}
+}
+
+// markHungUp is called when the caller hung up.
+func (wc *webhookCall) markHungUp() {
+	wc.hungUpOnce.Do(func() {
+		close(wc.hungUp)
+		wc.release()
+	})
+}
+
+func (wc *webhookCall) Done() <-chan struct{} {
+	return wc.hungUp
+}
+
+// ReadMove tells the client how the move is entered through the query of the webhook.
+func (wc *webhookCall) ReadMove(ctx context.Context, spec InputSpec) (string, error) {
+	u, err := url.Parse(string(wc.getDigitURL))
+	if err != nil {
+		return "", fmt.Errorf("parse webhook url: %w", err)
+	}
+	q := u.Query()
+	spec.addKeysToQuery(q)
+	u.RawQuery = q.Encode()
+
+	resp, err := wc.callWebhook(ctx, WebhookURL(u.String()))
+	var statusErr *webhookStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.statusCode == http.StatusRequestTimeout:
+		return "", &InputTimeoutError{}
+	case errors.As(err, &statusErr) && statusErr.statusCode == http.StatusUnprocessableEntity:
+		return "", fmt.Errorf("%w: the input of the caller is too short", ErrInvalidInput)
+	case err != nil:
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var data ReceiveDigitRequest
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("decode JSON response from webhook: %w", err)
+	}
+
+	// Clients that only support single digits do not send the keys.
+	if data.Keys == "" {
+		return strconv.Itoa(data.Digit), nil
+	}
+	return data.Keys, nil
+}
+
+func (wc *webhookCall) StartAudio(ctx context.Context) error {
+	resp, err := wc.callWebhook(ctx, wc.gameStartURL)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Announce sends the announcement to the announce webhook, if the client registered one.
+func (wc *webhookCall) Announce(ctx context.Context, announcement Announcement) error {
+	if wc.announceURL == "" {
+		return nil
+	}
+	resp, err := wc.sendWebhook(ctx, http.MethodPost, wc.announceURL, announcement)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (wc *webhookCall) Hangup(ctx context.Context) error {
+	defer wc.release()
+
+	select {
+	case <-wc.hungUp:
+		return nil
+	default:
+	}
+
+	resp, err := wc.callWebhook(ctx, wc.gameDoneURL)
+	if err == nil {
+		_ = resp.Body.Close()
+		return nil
+	}
+
+	// Make sure that the call does not stay open forever.
+	if wc.callMonitor != nil && wc.channel != "" {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		if amiErr := wc.callMonitor.hangup(ctx, wc.channel); amiErr != nil {
+			return fmt.Errorf("%w, hang up channel %s through AMI: %v", err, wc.channel, amiErr)
+		}
+		return nil
+	}
+	return err
+}
+
+// callWebhook sends a GET request to the given webhook.
+// The caller is responsible for closing the body of the returned response.
+func (wc *webhookCall) callWebhook(ctx context.Context, url WebhookURL) (*http.Response, error) {
+	return wc.sendWebhook(ctx, http.MethodGet, url, nil)
+}
+
+// sendWebhook sends a request with the given JSON body, if not nil, to the given webhook.
+// The caller is responsible for closing the body of the returned response.
+func (wc *webhookCall) sendWebhook(ctx context.Context, method string, url WebhookURL, body any) (*http.Response, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return nil, fmt.Errorf("encode JSON body for webhook %s: %w", url, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, string(url), &reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP request for webhook %s: %w", url, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP %s request to webhook %s: %w", method, url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, &webhookStatusError{url: url, statusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// webhookStatusError is returned when a webhook responds with another status code than 200 OK.
+type webhookStatusError struct {
+	url        WebhookURL
+	statusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("expected HTTP status code 200 OK from webhook %s, but got %d", e.url, e.statusCode)
+}
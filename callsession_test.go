@@ -0,0 +1,331 @@
+package voipttt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// testCall is a CallSession whose keys are scripted by the test.
+type testCall struct {
+	// keys returns the keys of the next read. Reads block until the context
+	// is done if it is nil.
+	keys func(ctx context.Context, spec InputSpec) (string, error)
+	// onAnnounce, if set, is called with each announcement before it is recorded.
+	onAnnounce func(announcement Announcement)
+
+	mu            sync.Mutex
+	announcements []Announcement
+
+	done       chan struct{}
+	hangupOnce sync.Once
+}
+
+func newTestCall(keys func(ctx context.Context, spec InputSpec) (string, error)) *testCall {
+	return &testCall{keys: keys, done: make(chan struct{})}
+}
+
+// scriptedKeys returns the given keys one after another for moves and answers alike.
+// Once all keys are used up, reads block until the context is done.
+func scriptedKeys(keys ...string) func(context.Context, InputSpec) (string, error) {
+	var mu sync.Mutex
+	return func(ctx context.Context, _ InputSpec) (string, error) {
+		mu.Lock()
+		if len(keys) > 0 {
+			key := keys[0]
+			keys = keys[1:]
+			mu.Unlock()
+			return key, nil
+		}
+		mu.Unlock()
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+}
+
+func (c *testCall) ReadMove(ctx context.Context, spec InputSpec) (string, error) {
+	if c.keys == nil {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return c.keys(ctx, spec)
+}
+
+func (c *testCall) StartAudio(context.Context) error {
+	return nil
+}
+
+func (c *testCall) Announce(_ context.Context, announcement Announcement) error {
+	if c.onAnnounce != nil {
+		c.onAnnounce(announcement)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.announcements = append(c.announcements, announcement)
+	return nil
+}
+
+func (c *testCall) Hangup(context.Context) error {
+	return nil
+}
+
+func (c *testCall) Done() <-chan struct{} {
+	return c.done
+}
+
+// hangUp simulates that the caller hung up.
+func (c *testCall) hangUp() {
+	c.hangupOnce.Do(func() { close(c.done) })
+}
+
+// announced returns the data of all announcements of the given type.
+func (c *testCall) announced(announcementType string) []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var data []any
+	for _, a := range c.announcements {
+		if a.Type == announcementType {
+			data = append(data, a.Data)
+		}
+	}
+	return data
+}
+
+// newTestClient returns a client with a web socket connection, like a caller with a browser.
+// The returned channel receives the messages the browser receives, the connection
+// of the browser is closed at the end of the test.
+func newTestClient(t *testing.T, phoneNumber PhoneNumber, call CallSession) (*webSocketClient, *websocket.Conn, <-chan webSocketRequest) {
+	t.Helper()
+	conn, browser := newTestWebSocket(t)
+
+	messages := make(chan webSocketRequest, 256)
+	go func() {
+		defer close(messages)
+		for {
+			var msg webSocketRequest
+			if err := browser.ReadJSON(&msg); err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}()
+
+	return &webSocketClient{
+		conn:        conn,
+		connMu:      new(sync.Mutex),
+		phoneNumber: phoneNumber,
+		gameType:    GameTicTacToe,
+		call:        call,
+		log:         zerolog.Nop(),
+	}, browser, messages
+}
+
+// newTestWebSocket returns both ends of a web socket connection between the server
+// and a browser. The connection of the browser is closed at the end of the test.
+func newTestWebSocket(t *testing.T) (conn, browser *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade web socket: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	browser, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = browser.Close() })
+	return <-conns, browser
+}
+
+func TestWebhookCallReadMoveErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		check  func(error) bool
+	}{
+		{status: http.StatusRequestTimeout, check: func(err error) bool {
+			var timeoutErr *InputTimeoutError
+			return errors.As(err, &timeoutErr)
+		}},
+		{status: http.StatusUnprocessableEntity, check: func(err error) bool {
+			return errors.Is(err, ErrInvalidInput)
+		}},
+		{status: http.StatusInternalServerError, check: func(err error) bool {
+			return err != nil && !isInputTimeout(err)
+		}},
+	}
+
+	for _, tt := range tests {
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		call := newWebhookCall(RegisterClientRequest{SelectDigitURL: WebhookURL(webhook.URL)}, nil, zerolog.Nop())
+		_, err := call.ReadMove(context.Background(), MoveInputSpec)
+		webhook.Close()
+		if !tt.check(err) {
+			t.Errorf("status %d: got unexpected error %v", tt.status, err)
+		}
+	}
+}
+
+// webhookRequest is a request received by the webhooks of newTestWebhooks.
+type webhookRequest struct {
+	method string
+	path   string
+	query  url.Values
+	body   []byte
+}
+
+// newTestWebhooks returns a client registration whose webhooks all point to a test server.
+// The returned channel receives the requests to the webhooks, the digit webhook
+// answers with the given response.
+func newTestWebhooks(t *testing.T, digitResponse string) (RegisterClientRequest, <-chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query(), body: body}
+		if r.URL.Path == "/digit" {
+			_, _ = w.Write([]byte(digitResponse))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return RegisterClientRequest{
+		ClientPhoneNumber: "100",
+		SelectDigitURL:    WebhookURL(server.URL + "/digit"),
+		GameStartURL:      WebhookURL(server.URL + "/start"),
+		GameDoneURL:       WebhookURL(server.URL + "/done"),
+		AnnounceURL:       WebhookURL(server.URL + "/announce"),
+	}, requests
+}
+
+func TestWebhookCallReadMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{name: "keys", response: `{"digit": 0, "keys": "12"}`, want: "12"},
+		{name: "single digit", response: `{"digit": 7}`, want: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, requests := newTestWebhooks(t, tt.response)
+			call := newWebhookCall(req, nil, zerolog.Nop())
+
+			spec := InputSpec{MinLength: 1, MaxLength: 2, Terminator: '#'}
+			move, err := call.ReadMove(context.Background(), spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if move != tt.want {
+				t.Fatalf("got move %q, want %q", move, tt.want)
+			}
+
+			// The client learns from the query how the move is entered.
+			r := <-requests
+			got, err := MoveInputSpec.withKeysFromQuery(r.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.MinLength != spec.MinLength || got.MaxLength != spec.MaxLength || got.Terminator != spec.Terminator {
+				t.Fatalf("got spec %+v from query %v, want the keys of %+v", got, r.query, spec)
+			}
+		})
+	}
+}
+
+func TestWebhookCallStartAudioAndAnnounce(t *testing.T) {
+	req, requests := newTestWebhooks(t, "")
+	call := newWebhookCall(req, nil, zerolog.Nop())
+
+	if err := call.StartAudio(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-requests; r.method != http.MethodGet || r.path != "/start" {
+		t.Fatalf("got %s %s, want the game start webhook", r.method, r.path)
+	}
+
+	announcement := Announcement{Type: string(messageGameDone), Data: map[string]any{"reason": "WIN"}}
+	if err := call.Announce(context.Background(), announcement); err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if r.method != http.MethodPost || r.path != "/announce" {
+		t.Fatalf("got %s %s, want the announce webhook", r.method, r.path)
+	}
+	var got Announcement
+	if err := json.Unmarshal(r.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, announcement) {
+		t.Fatalf("got announcement %+v, want %+v", got, announcement)
+	}
+
+	// Clients without an announce webhook are not announced anything.
+	req.AnnounceURL = ""
+	call = newWebhookCall(req, nil, zerolog.Nop())
+	if err := call.Announce(context.Background(), announcement); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-requests:
+		t.Fatalf("got %s %s without an announce webhook", r.method, r.path)
+	default:
+	}
+}
+
+func TestWebhookCallHangup(t *testing.T) {
+	req, requests := newTestWebhooks(t, "")
+	call := newWebhookCall(req, nil, zerolog.Nop())
+	var released int
+	call.release = func() { released++ }
+
+	if err := call.Hangup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-requests; r.path != "/done" {
+		t.Fatalf("got %s %s, want the game done webhook", r.method, r.path)
+	}
+	if released != 1 {
+		t.Fatalf("released the call %d times, want once", released)
+	}
+
+	// A caller who hung up is not called again.
+	call = newWebhookCall(req, nil, zerolog.Nop())
+	call.release = func() { released++ }
+	call.markHungUp()
+	call.markHungUp()
+	select {
+	case <-call.Done():
+	default:
+		t.Fatal("call is not done after the caller hung up")
+	}
+	if err := call.Hangup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-requests:
+		t.Fatalf("got %s %s after the caller hung up", r.method, r.path)
+	default:
+	}
+}
@@ -0,0 +1,131 @@
+package voipttt
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeUpPolicy is what happens when a player runs out of time.
+type TimeUpPolicy string
+
+const (
+	// TimeUpRandomMove makes a random move for the player.
+	TimeUpRandomMove TimeUpPolicy = "random"
+	// TimeUpForfeit ends the game, the player loses.
+	TimeUpForfeit TimeUpPolicy = "forfeit"
+	// TimeUpSkipTurn gives the turn to the opponent. Games that do not implement
+	// skipGame make a random move instead.
+	TimeUpSkipTurn TimeUpPolicy = "skip"
+)
+
+// ParseTimeUpPolicy returns the policy of the given name.
+func ParseTimeUpPolicy(name string) (TimeUpPolicy, error) {
+	switch p := TimeUpPolicy(name); p {
+	case TimeUpRandomMove, TimeUpForfeit, TimeUpSkipTurn:
+		return p, nil
+	}
+	return "", fmt.Errorf(
+		"unknown policy %q, expected %s, %s or %s",
+		name,
+		TimeUpRandomMove,
+		TimeUpForfeit,
+		TimeUpSkipTurn,
+	)
+}
+
+// ClockConfig configures the time players have for their moves.
+// Only the time in which the game waits for a move counts, not announcements.
+type ClockConfig struct {
+	// TurnTime is the time a player has for a single move, unlimited if zero.
+	TurnTime time.Duration
+	// TotalTime is the time a player has for all their moves, unlimited if zero.
+	TotalTime time.Duration
+	// OnTimeUp is what happens when a player runs out of time.
+	OnTimeUp TimeUpPolicy
+}
+
+// WithClock limits the time players have for their moves.
+func WithClock(config ClockConfig) ServerOption {
+	return func(s *Server) {
+		s.wsManager.clock = &config
+	}
+}
+
+// moveClock keeps track of the time the players of a game have left.
+// A nil clock does not limit the time.
+type moveClock struct {
+	config ClockConfig
+	total  [3]time.Duration // Total time left, indexed by player.
+	// turn is the time used for the current turn, which spans several reads
+	// if the player listens to the board or enters an invalid move.
+	turn time.Duration
+}
+
+func newMoveClock(config ClockConfig) *moveClock {
+	return &moveClock{
+		config: config,
+		total:  [3]time.Duration{0, config.TotalTime, config.TotalTime},
+	}
+}
+
+// turnTime returns the time the player has left for the current turn and false if it is unlimited.
+func (c *moveClock) turnTime(player Player) (time.Duration, bool) {
+	if c == nil || (c.config.TurnTime == 0 && c.config.TotalTime == 0) {
+		return 0, false
+	}
+	left := c.config.TurnTime - c.turn
+	if c.config.TurnTime == 0 || (c.config.TotalTime != 0 && c.total[player] < left) {
+		left = c.total[player]
+	}
+	if left < 0 {
+		return 0, true
+	}
+	return left, true
+}
+
+// turnContext returns a context that expires once the player ran out of time for the current turn.
+func (c *moveClock) turnContext(ctx context.Context, player Player) (context.Context, context.CancelFunc) {
+	d, ok := c.turnTime(player)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// use adds the time the player took to the current turn and subtracts it from their total time.
+func (c *moveClock) use(player Player, d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.turn += d
+	if c.config.TotalTime != 0 {
+		c.total[player] -= d
+		if c.total[player] < 0 {
+			c.total[player] = 0
+		}
+	}
+}
+
+// endTurn starts the next turn with the full turn time.
+func (c *moveClock) endTurn() {
+	if c != nil {
+		c.turn = 0
+	}
+}
+
+// data returns the CLOCK message for the given player while it is the turn of current.
+func (c *moveClock) data(player, current Player) *dataClock {
+	turn, _ := c.turnTime(current)
+	data := &dataClock{
+		IsPlayer: player == current,
+		TurnMs:   turn.Milliseconds(),
+	}
+	if c.config.TotalTime != 0 {
+		data.Total = &dataClockTotal{
+			PlayerMs:   c.total[player].Milliseconds(),
+			OpponentMs: c.total[player.Opponent()].Milliseconds(),
+		}
+	}
+	return data
+}
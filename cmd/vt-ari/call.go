@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/ari"
+	"github.com/n9v9/voip-ttt/audio"
+	"github.com/n9v9/voip-ttt/rtp"
+)
+
+// errHungUp is returned when the caller hung up while we were waiting for input.
+var errHungUp = errors.New("caller hung up")
+
+// call is a single channel that entered the Stasis application.
+type call struct {
+	client  *ari.Client
+	channel ari.Channel
+	// Host that asterisk can reach us at, used to receive the RTP audio stream.
+	rtpHost string
+
+	digits     chan rune
+	hungUp     chan struct{}
+	hungUpOnce sync.Once
+
+	// IDs of the playbacks that asterisk finished. Play waits for the playbacks
+	// of its prompts, playbackDone is signalled whenever one of them finished.
+	playbackMu        sync.Mutex
+	finishedPlaybacks map[string]bool
+	playbackDone      chan struct{}
+
+	// Resources that are created when the audio stream is started.
+	mediaMu        sync.Mutex
+	bridgeID       string
+	mediaChannelID string
+	rtpConn        *net.UDPConn
+
+	log zerolog.Logger
+}
+
+func newCall(client *ari.Client, channel ari.Channel, rtpHost string, l zerolog.Logger) *call {
+	return &call{
+		client:  client,
+		channel: channel,
+		rtpHost: rtpHost,
+		digits:  make(chan rune, 32),
+		hungUp:  make(chan struct{}),
+
+		finishedPlaybacks: map[string]bool{},
+		playbackDone:      make(chan struct{}, 1),
+
+		log: l.With().
+			Str("channel_id", channel.ID).
+			Str("channel", channel.Name).
+			Logger(),
+	}
+}
+
+func (c *call) PhoneNumber() voipttt.PhoneNumber {
+	return voipttt.PhoneNumber(c.channel.Caller.Number)
+}
+
+func (c *call) Channel() string {
+	return c.channel.Name
+}
+
+// receivedDigit passes a DTMF digit received by an event to the waiting reader.
+func (c *call) receivedDigit(digit string) {
+	if digit == "" {
+		return
+	}
+	select {
+	case c.digits <- rune(digit[0]):
+	default:
+		c.log.Warn().Str("digit", digit).Msg("Dropped DTMF digit because nobody is reading")
+	}
+}
+
+// playbackFinished records that asterisk finished the given playback, either
+// because it was played completely or because it failed.
+func (c *call) playbackFinished(id string) {
+	c.playbackMu.Lock()
+	c.finishedPlaybacks[id] = true
+	c.playbackMu.Unlock()
+
+	select {
+	case c.playbackDone <- struct{}{}:
+	default:
+	}
+}
+
+// hangup marks the call as hung up.
+func (c *call) hangup() {
+	c.hungUpOnce.Do(func() { close(c.hungUp) })
+}
+
+func (c *call) ReadInput(ctx context.Context, spec voipttt.InputSpec) (string, error) {
+	keys, err := spec.Read(func(timeout time.Duration) (rune, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-c.hungUp:
+			return 0, errHungUp
+		case <-time.After(timeout):
+			return 0, nil
+		case digit := <-c.digits:
+			c.log.Debug().Str("digit", string(digit)).Msg("Received single digit")
+			return digit, nil
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	c.log.Info().Str("digits", keys).Msg("Received final digits")
+	return keys, nil
+}
+
+// StartAudio creates an external media channel that sends the audio of the caller
+// as RTP stream to us, which we then forward to the web socket at audioURL.
+func (c *call) StartAudio(ctx context.Context, audioURL string) error {
+	c.mediaMu.Lock()
+	defer c.mediaMu.Unlock()
+
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(c.rtpHost)})
+	if err != nil {
+		return fmt.Errorf("listen udp for rtp: %w", err)
+	}
+	c.rtpConn = rtpConn
+
+	media, err := c.client.ExternalMedia(ctx, ari.ExternalMedia{
+		ExternalHost: rtpConn.LocalAddr().String(),
+		// Signed linear 16 bit at 16 kHz, wideband if the caller supports it.
+		Format: "slin16",
+	})
+	if err != nil {
+		return fmt.Errorf("create external media channel: %w", err)
+	}
+	c.mediaChannelID = media.ID
+
+	bridge, err := c.client.CreateBridge(ctx, "mixing")
+	if err != nil {
+		return fmt.Errorf("create bridge: %w", err)
+	}
+	c.bridgeID = bridge.ID
+
+	if err := c.client.AddChannels(ctx, bridge.ID, c.channel.ID, media.ID); err != nil {
+		return fmt.Errorf("add channels to bridge: %w", err)
+	}
+
+	audioURL, err = voipttt.SetAudioFormat(audioURL, audio.Format{
+		Encoding:   audio.EncodingLinear16,
+		SampleRate: 16000,
+		Channels:   1,
+	})
+	if err != nil {
+		return err
+	}
+
+	audioConn, _, err := websocket.DefaultDialer.DialContext(ctx, audioURL, nil)
+	if err != nil {
+		return fmt.Errorf("connect to audio web socket: %w", err)
+	}
+
+	go c.forwardAudio(rtpConn, audioConn)
+
+	c.log.Info().
+		Str("rtp_addr", rtpConn.LocalAddr().String()).
+		Str("bridge_id", bridge.ID).
+		Msg("Started audio stream")
+	return nil
+}
+
+// forwardAudio forwards the payload of all received RTP packets to the web socket.
+func (c *call) forwardAudio(rtpConn *net.UDPConn, audioConn *websocket.Conn) {
+	defer audioConn.Close()
+
+	buf := make([]byte, 1500)
+	var packet rtp.Packet
+	for {
+		n, err := rtpConn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.log.Err(err).Msg("Failed to read RTP packet")
+			}
+			return
+		}
+		if err := packet.Unmarshal(buf[:n]); err != nil {
+			c.log.Warn().Err(err).Msg("Dropped invalid RTP packet")
+			continue
+		}
+
+		// RTP carries signed linear audio in network byte order,
+		// but the private API expects little endian.
+		payload := make([]byte, len(packet.Payload)&^1)
+		for i := 0; i < len(payload); i += 2 {
+			payload[i], payload[i+1] = packet.Payload[i+1], packet.Payload[i]
+		}
+
+		if err := audioConn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+			c.log.Err(err).Msg("Failed to forward audio to web socket")
+			return
+		}
+	}
+}
+
+// close hangs up the call and releases all resources of the audio stream.
+func (c *call) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c.mediaMu.Lock()
+	defer c.mediaMu.Unlock()
+
+	if c.rtpConn != nil {
+		_ = c.rtpConn.Close()
+	}
+	if c.bridgeID != "" {
+		if err := c.client.DestroyBridge(ctx, c.bridgeID); err != nil {
+			c.log.Err(err).Msg("Failed to destroy bridge")
+		}
+	}
+	if c.mediaChannelID != "" {
+		if err := c.client.Hangup(ctx, c.mediaChannelID); err != nil {
+			c.log.Err(err).Msg("Failed to hang up external media channel")
+		}
+	}
+
+	select {
+	case <-c.hungUp:
+	default:
+		if err := c.client.Hangup(ctx, c.channel.ID); err != nil {
+			c.log.Err(err).Msg("Failed to hang up channel")
+		}
+	}
+}
+
+// Play queues the prompts on the channel, which asterisk plays one after another.
+// It blocks until all prompts are played, the context is done or the caller hung up.
+func (c *call) Play(ctx context.Context, prompts []voipttt.Prompt) error {
+	playbackIDs := make([]string, 0, len(prompts))
+	for _, prompt := range prompts {
+		media := "sound:" + prompt.Sound
+		if prompt.Sound == "" {
+			media = "digits:" + prompt.Digits
+		}
+		playback, err := c.client.Play(ctx, c.channel.ID, media)
+		if err != nil {
+			return fmt.Errorf("play %s: %w", media, err)
+		}
+		playbackIDs = append(playbackIDs, playback.ID)
+	}
+
+	for !c.playbacksFinished(playbackIDs) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.hungUp:
+			return errHungUp
+		case <-c.playbackDone:
+		}
+	}
+	return nil
+}
+
+// playbacksFinished reports whether all given playbacks are finished and forgets them if so.
+func (c *call) playbacksFinished(ids []string) bool {
+	c.playbackMu.Lock()
+	defer c.playbackMu.Unlock()
+	for _, id := range ids {
+		if !c.finishedPlaybacks[id] {
+			return false
+		}
+	}
+	for _, id := range ids {
+		delete(c.finishedPlaybacks, id)
+	}
+	return true
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/ari"
+)
+
+var (
+	addr         string
+	serverAddr   string
+	voicePrompts bool
+	ariURL       string
+	ariApp       string
+	ariUsername  string
+	ariPassword  string
+	rtpHost      string
+	codeInput    string
+	moveInput    string
+)
+
+func main() {
+	rootCmd().Execute()
+}
+
+func rootCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "vt-ari",
+		Short: "vt-ari connects calls of an asterisk Stasis application to the vt-server to play Tic-Tac-Toe over VoIP",
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+			if err := run(); err != nil {
+				log.Logger.Err(err).Msg("ARI program failed")
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&addr,
+		"addr",
+		"",
+		"Address and port to listen on to receive webhooks",
+	)
+	cmd.Flags().StringVar(
+		&serverAddr,
+		"server-addr",
+		"",
+		"Address and port of the game server",
+	)
+	cmd.Flags().StringVar(
+		&ariURL,
+		"ari-url",
+		"http://localhost:8088",
+		"URL of the asterisk HTTP server serving ARI",
+	)
+	cmd.Flags().StringVar(
+		&ariApp,
+		"ari-app",
+		"voipttt",
+		"Name of the Stasis application that the dialplan sends calls to",
+	)
+	cmd.Flags().StringVar(
+		&ariUsername,
+		"ari-username",
+		"",
+		"Username to authenticate with ARI",
+	)
+	cmd.Flags().StringVar(
+		&ariPassword,
+		"ari-password",
+		"",
+		"Password to authenticate with ARI",
+	)
+	cmd.Flags().StringVar(
+		&rtpHost,
+		"rtp-host",
+		"127.0.0.1",
+		"IP address that asterisk sends the RTP audio streams to",
+	)
+	cmd.Flags().BoolVar(
+		&voicePrompts,
+		"voice-prompts",
+		false,
+		"Guide callers through the game with voice prompts, so that they can play without the website",
+	)
+	cmd.Flags().StringVar(
+		&codeInput,
+		"code-input",
+		"",
+		"How callers enter the verification code, given as <name>=<value> pairs, e.g. digit-timeout=10s,retries=3. "+
+			"The names are timeout, digit-timeout, min, max, retries, terminator, clear and command",
+	)
+	cmd.Flags().StringVar(
+		&moveInput,
+		"move-input",
+		"",
+		"How callers enter a move, given like --code-input. The game server may change the lengths and keys of a move",
+	)
+
+	cmd.MarkFlagRequired("addr")
+	cmd.MarkFlagRequired("server-addr")
+
+	return cmd
+}
+
+func run() error {
+	codeSpec, err := voipttt.ParseInputSpec(codeInput, voipttt.CodeInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --code-input: %w", err)
+	}
+	moveSpec, err := voipttt.ParseInputSpec(moveInput, voipttt.MoveInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --move-input: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", err)
+	}
+
+	// See vt-client, the listener may have been assigned a random port.
+	addr = listener.Addr().String()
+	l := log.Logger.With().Str("listen_addr", addr).Logger()
+
+	opts := []voipttt.CallClientOption{voipttt.WithInputSpecs(codeSpec, moveSpec)}
+	if voicePrompts {
+		opts = append(opts, voipttt.WithVoicePrompts())
+	}
+	callClient := voipttt.NewCallClient(addr, serverAddr, opts...)
+	webhookServer := http.Server{Handler: callClient.Handler()}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := webhookServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Err(err).Msg("Failed to serve webhooks")
+		}
+	}()
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = webhookServer.Shutdown(ctx)
+	}()
+
+	app := &stasisApp{
+		client:     ari.NewClient(ariURL, ariApp, ariUsername, ariPassword),
+		callClient: callClient,
+		calls:      map[string]*call{},
+		log:        l.With().Str("ari_app", ariApp).Logger(),
+	}
+	app.run(ctx)
+	return nil
+}
+
+// stasisApp dispatches the events of the Stasis application to the active calls.
+type stasisApp struct {
+	client     *ari.Client
+	callClient *voipttt.CallClient
+
+	calls   map[string]*call
+	callsMu sync.Mutex
+	wg      sync.WaitGroup
+
+	log zerolog.Logger
+}
+
+// run handles all events and reconnects if the connection to ARI is lost.
+// It blocks until the context is cancelled and all calls are done.
+func (sa *stasisApp) run(ctx context.Context) {
+	defer sa.wg.Wait()
+
+	const reconnectDelay = time.Second * 5
+
+	for {
+		events, err := sa.client.Events(ctx)
+		if err != nil {
+			sa.log.Err(err).Dur("reconnect_delay", reconnectDelay).Msg("Failed to connect to ARI")
+		} else {
+			sa.log.Info().Msg("Connected to ARI")
+			for event := range events {
+				sa.handleEvent(ctx, event)
+			}
+			sa.log.Warn().Msg("Lost connection to ARI")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (sa *stasisApp) handleEvent(ctx context.Context, event ari.Event) {
+	// Playback events only reference their channel by the URI of the target.
+	if event.Type == ari.EventPlaybackFinished && event.Playback != nil {
+		if scheme, id, _ := strings.Cut(event.Playback.TargetURI, ":"); scheme == "channel" {
+			if c, ok := sa.call(id); ok {
+				c.playbackFinished(event.Playback.ID)
+			}
+		}
+		return
+	}
+	if event.Channel == nil {
+		return
+	}
+	id := event.Channel.ID
+
+	switch event.Type {
+	case ari.EventStasisStart:
+		// External media channels enter the application as well, but are managed by their call.
+		if strings.HasPrefix(event.Channel.Name, "UnicastRTP/") {
+			return
+		}
+		c := newCall(sa.client, *event.Channel, rtpHost, sa.log)
+
+		sa.callsMu.Lock()
+		sa.calls[id] = c
+		sa.callsMu.Unlock()
+
+		sa.wg.Add(1)
+		go func() {
+			defer sa.wg.Done()
+			sa.handleCall(ctx, c)
+
+			sa.callsMu.Lock()
+			delete(sa.calls, id)
+			sa.callsMu.Unlock()
+		}()
+
+	case ari.EventChannelDtmfReceived:
+		if c, ok := sa.call(id); ok {
+			c.receivedDigit(event.Digit)
+		}
+
+	case ari.EventStasisEnd, ari.EventChannelDestroyed:
+		if c, ok := sa.call(id); ok {
+			c.log.Info().Msg("Caller hung up")
+			c.hangup()
+		}
+	}
+}
+
+func (sa *stasisApp) call(channelID string) (*call, bool) {
+	sa.callsMu.Lock()
+	defer sa.callsMu.Unlock()
+	c, ok := sa.calls[channelID]
+	return c, ok
+}
+
+// handleCall answers the call and plays the game until it is done or the caller hangs up.
+func (sa *stasisApp) handleCall(ctx context.Context, c *call) {
+	defer c.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.hungUp:
+			cancel()
+		}
+	}()
+
+	c.log.Info().Str("phone_number", string(c.PhoneNumber())).Msg("Handle new call")
+
+	if err := sa.client.Answer(ctx, c.channel.ID); err != nil {
+		c.log.Err(err).Msg("Failed to answer call")
+		return
+	}
+
+	// Signal the caller that they can enter their verification code.
+	if _, err := sa.client.Play(ctx, c.channel.ID, "sound:beep"); err != nil {
+		c.log.Err(err).Msg("Failed to play prompt")
+	}
+
+	if err := sa.callClient.HandleCall(ctx, c, c.log); err != nil {
+		c.log.Err(err).Msg("Failed to handle call")
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/ari"
+)
+
+// ariStub is a minimal ARI server that records the requests to channels and bridges
+// and pushes events to the connected event web socket.
+type ariStub struct {
+	events chan ari.Event
+
+	mu        sync.Mutex
+	requests  []string
+	playbacks int
+	changed   chan struct{}
+}
+
+func newARIStub(t *testing.T) (*ariStub, *ari.Client) {
+	t.Helper()
+	s := &ariStub{events: make(chan ari.Event), changed: make(chan struct{}, 100)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ari/events", func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			select {
+			case event := <-s.events:
+				if err := conn.WriteJSON(event); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ari/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/play") {
+			s.playbacks++
+		}
+		playback := s.playbacks
+		s.mu.Unlock()
+		s.changed <- struct{}{}
+
+		if strings.HasSuffix(r.URL.Path, "/play") {
+			_, _ = fmt.Fprintf(w, `{"id":"playback-%d","state":"queued"}`, playback)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return s, ari.NewClient(server.URL, "voipttt", "user", "secret")
+}
+
+// waitForRequest waits until the stub received the given request.
+func (s *ariStub) waitForRequest(t *testing.T, request string) {
+	t.Helper()
+	timeout := time.After(time.Second * 5)
+	for {
+		s.mu.Lock()
+		for _, r := range s.requests {
+			if r == request {
+				s.mu.Unlock()
+				return
+			}
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.changed:
+		case <-timeout:
+			t.Fatalf("did not receive request %s", request)
+		}
+	}
+}
+
+func (s *ariStub) received(request string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStasisApp(t *testing.T) {
+	tests := []struct {
+		name string
+		// Status code of the game server when the call registers itself.
+		registerStatus int
+		// Whether the channel is hung up by the application instead of the caller.
+		wantHangup bool
+	}{
+		{name: "caller hangs up", registerStatus: http.StatusOK, wantHangup: false},
+		{name: "registration fails", registerStatus: http.StatusBadRequest, wantHangup: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, client := newARIStub(t)
+
+			registered := make(chan voipttt.RegisterClientRequest, 1)
+			gameServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req voipttt.RegisterClientRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decode register request: %v", err)
+				}
+				registered <- req
+				w.WriteHeader(tt.registerStatus)
+			}))
+			defer gameServer.Close()
+
+			app := &stasisApp{
+				client:     client,
+				callClient: voipttt.NewCallClient("127.0.0.1:0", strings.TrimPrefix(gameServer.URL, "http://")),
+				calls:      map[string]*call{},
+				log:        zerolog.Nop(),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				app.run(ctx)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			channel := &ari.Channel{ID: "1", Name: "PJSIP/100-00000001", Caller: ari.CallerID{Number: "100"}}
+			stub.events <- ari.Event{Type: ari.EventStasisStart, Channel: channel}
+			stub.waitForRequest(t, "POST /ari/channels/1/answer")
+
+			// Enter the verification code, correcting a typo with the clear key.
+			for _, digit := range "9*42#" {
+				stub.events <- ari.Event{Type: ari.EventChannelDtmfReceived, Channel: channel, Digit: string(digit)}
+			}
+
+			select {
+			case req := <-registered:
+				if req.VerificationCode != 42 || req.ClientPhoneNumber != "100" || req.Channel != channel.Name {
+					t.Fatalf("got register request %+v", req)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("call was not registered")
+			}
+
+			if tt.wantHangup {
+				stub.waitForRequest(t, "DELETE /ari/channels/1")
+				return
+			}
+
+			stub.events <- ari.Event{Type: ari.EventStasisEnd, Channel: channel}
+			deadline := time.Now().Add(time.Second * 5)
+			for {
+				app.callsMu.Lock()
+				n := len(app.calls)
+				app.callsMu.Unlock()
+				if n == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("call was not removed after the caller hung up")
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+			if stub.received("DELETE /ari/channels/1") {
+				t.Fatal("hung up channel of a caller who already hung up")
+			}
+		})
+	}
+}
+
+func TestCallPlayWaitsForPlaybacks(t *testing.T) {
+	stub, client := newARIStub(t)
+	app := &stasisApp{client: client, calls: map[string]*call{}, log: zerolog.Nop()}
+	channel := ari.Channel{ID: "1", Name: "PJSIP/100-00000001"}
+	c := newCall(client, channel, "127.0.0.1", zerolog.Nop())
+	app.calls[channel.ID] = c
+
+	finish := func(playbackID string) {
+		app.handleEvent(context.Background(), ari.Event{
+			Type:     ari.EventPlaybackFinished,
+			Playback: &ari.Playback{ID: playbackID, TargetURI: "channel:" + channel.ID, State: "done"},
+		})
+	}
+
+	played := make(chan error, 1)
+	go func() {
+		played <- c.Play(context.Background(), []voipttt.Prompt{
+			{Sound: voipttt.SoundYourTurn},
+			{Digits: "5"},
+		})
+	}()
+	stub.waitForRequest(t, "POST /ari/channels/1/play")
+
+	// Playbacks of other channels and the first prompt alone do not end the announcement.
+	app.handleEvent(context.Background(), ari.Event{
+		Type:     ari.EventPlaybackFinished,
+		Playback: &ari.Playback{ID: "playback-9", TargetURI: "channel:2", State: "done"},
+	})
+	finish("playback-1")
+	select {
+	case err := <-played:
+		t.Fatalf("play returned with %v before all prompts were played", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	finish("playback-2")
+	select {
+	case err := <-played:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("play did not return after all prompts were played")
+	}
+
+	// Play returns when the caller hangs up during the prompts.
+	go func() {
+		played <- c.Play(context.Background(), []voipttt.Prompt{{Sound: voipttt.SoundYourTurn}})
+	}()
+	c.hangup()
+	select {
+	case err := <-played:
+		if !errors.Is(err, errHungUp) {
+			t.Fatalf("got %v, want %v", err, errHungUp)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("play did not return after the caller hung up")
+	}
+}
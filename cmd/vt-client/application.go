@@ -1,60 +1,126 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	voipttt "github.com/n9v9/voip-ttt"
 )
 
+// digitPollInterval is how long a single WAIT FOR DIGIT waits for the caller, so that
+// other commands, e.g. announcements, can run between the polls and a cancelled read
+// is noticed.
+const digitPollInterval = time.Millisecond * 250
+
+// application is a single call that is controlled through AGI.
+// Each method is concurrency safe, as webhooks may be called concurrently.
 type application struct {
-	agi              *voipttt.AGI
-	hasReadVariables bool
+	agi   *voipttt.AGI
+	agiMu sync.Mutex
+
+	// Audio of the caller if the application was started through EAGI, otherwise nil.
+	eagiAudio io.Reader
+
+	log zerolog.Logger
 }
 
-func newApplication(log zerolog.Logger) *application {
-	return &application{
-		agi:              voipttt.NewAGI(log),
-		hasReadVariables: false,
-	}
+// newApplication returns an application for the given agi instance
+// whose variables must already be read.
+func newApplication(agi *voipttt.AGI, l zerolog.Logger) *application {
+	return &application{agi: agi, log: l}
 }
 
-func (aa *application) promptVerificationCode() (voipttt.VerificationCode, error) {
-	if err := aa.readVariables(); err != nil {
-		return 0, fmt.Errorf("agi read variables: %w", err)
-	}
+// newEAGIApplication returns an application that streams the audio of the caller
+// from the EAGI audio file descriptor instead of using asterisk-audio-fork.
+func newEAGIApplication(agi *voipttt.AGI, eagiAudio io.Reader, l zerolog.Logger) *application {
+	return &application{agi: agi, eagiAudio: eagiAudio, log: l}
+}
 
-	digit, err := aa.agi.ReadDigit()
-	if err != nil {
-		return 0, fmt.Errorf("agi read digit: %w", err)
-	}
+func (aa *application) PhoneNumber() voipttt.PhoneNumber {
+	return voipttt.PhoneNumber(aa.agi.Get("agi_callerid"))
+}
 
-	return voipttt.VerificationCode(digit), nil
+func (aa *application) Channel() string {
+	return aa.agi.Get("agi_channel")
 }
 
-func (aa *application) promptPhoneNumber() (voipttt.PhoneNumber, error) {
-	if err := aa.readVariables(); err != nil {
-		return "", fmt.Errorf("agi read variables: %w", err)
+// ReadInput polls for the keys with short WAIT FOR DIGIT commands and only holds the
+// AGI connection during each poll, so that it does not block other commands and
+// returns once the context is done.
+func (aa *application) ReadInput(ctx context.Context, spec voipttt.InputSpec) (string, error) {
+	keys, err := spec.Read(func(timeout time.Duration) (rune, error) {
+		deadline := time.Now().Add(timeout)
+		for {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil
+			}
+			if wait > digitPollInterval {
+				wait = digitPollInterval
+			}
+
+			digit, err := aa.waitForDigit(wait)
+			if err != nil {
+				return 0, err
+			}
+			if digit != 0 {
+				aa.log.Debug().Str("digit", string(digit)).Msg("Received single digit")
+				return digit, nil
+			}
+		}
+	})
+	if err != nil {
+		return "", err
 	}
-	return voipttt.PhoneNumber(aa.agi.Get("agi_callerid")), nil
+	aa.log.Info().Str("digits", keys).Msg("Received final digits")
+	return keys, nil
 }
 
-func (aa *application) promptDigit() (int, error) {
-	if err := aa.readVariables(); err != nil {
-		return 0, fmt.Errorf("agi read variables: %w", err)
-	}
+func (aa *application) waitForDigit(timeout time.Duration) (rune, error) {
+	aa.agiMu.Lock()
+	defer aa.agiMu.Unlock()
 
-	return aa.agi.ReadDigit()
+	return aa.agi.WaitForDigit(timeout)
 }
 
-func (aa *application) readVariables() error {
-	if aa.hasReadVariables {
+func (aa *application) StartAudio(_ context.Context, audioURL string) error {
+	if aa.eagiAudio != nil {
+		// The stream ends when asterisk closes the file descriptor as the call is over.
+		go func() {
+			if err := voipttt.StreamAudio(context.Background(), aa.eagiAudio, audioURL, aa.log); err != nil {
+				aa.log.Err(err).Msg("Failed to stream EAGI audio")
+			}
+		}()
 		return nil
 	}
-	aa.hasReadVariables = true
-	if err := aa.agi.ReadVariables(); err != nil {
-		return fmt.Errorf("agi read variables: %w", err)
+
+	aa.agiMu.Lock()
+	defer aa.agiMu.Unlock()
+
+	return aa.agi.StartAudioFork(audioURL)
+}
+
+func (aa *application) Play(_ context.Context, prompts []voipttt.Prompt) error {
+	aa.agiMu.Lock()
+	defer aa.agiMu.Unlock()
+
+	for _, prompt := range prompts {
+		var err error
+		if prompt.Sound != "" {
+			_, err = aa.agi.StreamFile(prompt.Sound, "")
+		} else {
+			_, err = aa.agi.SayDigits(prompt.Digits, "")
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	voipttt "github.com/n9v9/voip-ttt"
+)
+
+// fakeAsterisk answers the AGI commands of an application. WAIT FOR DIGIT returns
+// the queued digits, all other commands succeed.
+type fakeAsterisk struct {
+	digits chan rune
+
+	mu    sync.Mutex
+	waits []time.Duration // Timeouts of all WAIT FOR DIGIT commands.
+	other []string        // All other commands.
+}
+
+func newTestApplication(t *testing.T) (*application, *fakeAsterisk) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	fake := &fakeAsterisk{digits: make(chan rune, 8)}
+	go fake.serve(server)
+	return newApplication(voipttt.NewAGIConn(client, zerolog.Nop()), zerolog.Nop()), fake
+}
+
+func (f *fakeAsterisk) serve(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command := scanner.Text()
+		result := 0
+		if strings.HasPrefix(command, "WAIT FOR DIGIT ") {
+			timeout, _ := strconv.Atoi(strings.TrimPrefix(command, "WAIT FOR DIGIT "))
+			f.mu.Lock()
+			f.waits = append(f.waits, time.Duration(timeout)*time.Millisecond)
+			f.mu.Unlock()
+
+			select {
+			case digit := <-f.digits:
+				result = int(digit)
+			case <-time.After(time.Millisecond * 10):
+			}
+		} else {
+			f.mu.Lock()
+			f.other = append(f.other, command)
+			f.mu.Unlock()
+		}
+		if _, err := fmt.Fprintf(conn, "200 result=%d\n", result); err != nil {
+			return
+		}
+	}
+}
+
+func TestApplicationReadInputPolls(t *testing.T) {
+	aa, fake := newTestApplication(t)
+
+	// The digit arrives after a few polls.
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		fake.digits <- '5'
+	}()
+
+	keys, err := aa.ReadInput(context.Background(), voipttt.MoveInputSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != "5" {
+		t.Fatalf("got keys %q, want 5", keys)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.waits) < 2 {
+		t.Fatalf("got %d WAIT FOR DIGIT commands, want several polls", len(fake.waits))
+	}
+	for _, wait := range fake.waits {
+		if wait > digitPollInterval {
+			t.Fatalf("got a wait of %s, want at most %s", wait, digitPollInterval)
+		}
+	}
+}
+
+func TestApplicationReadInputReturnsWhenContextDone(t *testing.T) {
+	aa, fake := newTestApplication(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := aa.ReadInput(ctx, voipttt.MoveInputSpec)
+		errs <- err
+	}()
+
+	// Prompts are played between the polls of the pending read.
+	if err := aa.Play(context.Background(), []voipttt.Prompt{{Sound: voipttt.SoundYourTurn}}); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	played := len(fake.other)
+	fake.mu.Unlock()
+	if played != 1 {
+		t.Fatalf("got %d other commands, want the prompt", played)
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(digitPollInterval * 4):
+		t.Fatal("read did not return after the context was cancelled")
+	}
+}
@@ -1,32 +1,31 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"time"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	voipttt "github.com/n9v9/voip-ttt"
 )
 
-const (
-	webhookSelectDigitURL = "/digit"
-	webhookHeartbeatURL   = "/heartbeat"
-	webhookGameDoneURL    = "/done"
-	webhookGameStart      = "/start"
-)
-
 var (
-	addr       string
-	serverAddr string
+	addr         string
+	serverAddr   string
+	voicePrompts bool
+	fastAGIAddr  string
+	eagi         bool
+	codeInput    string
+	moveInput    string
 )
 
 func main() {
@@ -58,6 +57,39 @@ func rootCmd() *cobra.Command {
 		"",
 		"Address and port of the game server",
 	)
+	cmd.Flags().StringVar(
+		&fastAGIAddr,
+		"fastagi-addr",
+		"",
+		"Address and port to serve FastAGI on, e.g. "+voipttt.FastAGIDefaultAddr+". "+
+			"If empty, a single call is handled through AGI over stdin and stdout",
+	)
+	cmd.Flags().BoolVar(
+		&eagi,
+		"eagi",
+		false,
+		"Read the audio of the caller from file descriptor 3, which requires asterisk to start "+
+			"the client with EAGI instead of AGI. Not supported with --fastagi-addr",
+	)
+	cmd.Flags().BoolVar(
+		&voicePrompts,
+		"voice-prompts",
+		false,
+		"Guide callers through the game with voice prompts, so that they can play without the website",
+	)
+	cmd.Flags().StringVar(
+		&codeInput,
+		"code-input",
+		"",
+		"How callers enter the verification code, given as <name>=<value> pairs, e.g. digit-timeout=10s,retries=3. "+
+			"The names are timeout, digit-timeout, min, max, retries, terminator, clear and command",
+	)
+	cmd.Flags().StringVar(
+		&moveInput,
+		"move-input",
+		"",
+		"How callers enter a move, given like --code-input. The game server may change the lengths and keys of a move",
+	)
 
 	cmd.MarkFlagRequired("addr")
 	cmd.MarkFlagRequired("server-addr")
@@ -66,139 +98,80 @@ func rootCmd() *cobra.Command {
 }
 
 func run() error {
+	if eagi && fastAGIAddr != "" {
+		return errors.New("EAGI is not supported by FastAGI")
+	}
+
+	codeSpec, err := voipttt.ParseInputSpec(codeInput, voipttt.CodeInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --code-input: %w", err)
+	}
+	moveSpec, err := voipttt.ParseInputSpec(moveInput, voipttt.MoveInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --move-input: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("listen tcp: %w", err)
 	}
-	defer listener.Close()
 
 	// Important because are most likely using ":0" to get an available port
 	// from the OS. This line then gets the concrete port we got from the OS.
 	addr = listener.Addr().String()
 	l := log.Logger.With().Str("listen_addr", addr).Logger()
 
-	app := newApplication(l)
-
-	l.Info().Msg("Waiting for verification code")
-	verificationCode, err := app.promptVerificationCode()
-	if err != nil {
-		return fmt.Errorf("prompt verification code: %w", err)
-	}
-
-	l.Info().Msg("Waiting for phone number")
-	phoneNumber, err := app.promptPhoneNumber()
-	if err != nil {
-		return fmt.Errorf("prompt phone number: %w", err)
-	}
-
-	mux := chi.NewMux()
-	voipttt.RegisterHTTPMiddleware(mux)
-	mux.Get(webhookSelectDigitURL, handleSelectDigitWebhook(app))
-	mux.Get(webhookGameStart, handleGameStartWebhook(app, phoneNumber))
-	mux.Get(webhookGameDoneURL, handleGameDoneWebhook())
-	mux.Get(webhookHeartbeatURL, handleHeartbeatWebhook())
-
-	l.Info().Msg("Calling server to register application")
-	if err := register(verificationCode, phoneNumber); err != nil {
-		return fmt.Errorf("register application: %w", err)
+	opts := []voipttt.CallClientOption{voipttt.WithInputSpecs(codeSpec, moveSpec)}
+	if voicePrompts {
+		opts = append(opts, voipttt.WithVoicePrompts())
 	}
-	l.Info().Msg("Application is registered")
+	callClient := voipttt.NewCallClient(addr, serverAddr, opts...)
+	webhookServer := http.Server{Handler: callClient.Handler()}
 
-	return http.Serve(listener, mux)
-}
+	var wg sync.WaitGroup
+	defer wg.Wait()
 
-func handleSelectDigitWebhook(app *application) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		l := hlog.FromRequest(r)
-		l.Info().Msg("Received get digit request")
-
-		var (
-			digit int
-			err   error
-		)
-
-		for {
-			digit, err = app.promptDigit()
-			if err != nil {
-				l.Err(err).Msg("Failed to get digit")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			if digit < 1 || digit > 9 {
-				l.Warn().Int("digit", digit).Msg("Invalid digit, digit must be between 1 and 9")
-				continue
-			}
-			break
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := webhookServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Err(err).Msg("Failed to serve webhooks")
 		}
-
-		data := voipttt.ReceiveDigitRequest{Digit: digit}
-		if err := json.NewEncoder(w).Encode(&data); err != nil {
-			l.Err(err).
-				Int("digit", digit).
-				Interface("data", data).
-				Msg("Failed to respond with selected digit")
-			os.Exit(1)
+	}()
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = webhookServer.Shutdown(ctx)
+	}()
+
+	if fastAGIAddr == "" {
+		agi := voipttt.NewAGI(l)
+		if err := agi.ReadVariables(); err != nil {
+			return fmt.Errorf("agi read variables: %w", err)
 		}
-	}
-}
-
-func handleGameStartWebhook(app *application, phoneNumber voipttt.PhoneNumber) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		l := hlog.FromRequest(r)
-		l.Info().Msg("Received game start notification. Start audio fork.")
-
-		if err := app.agi.StartAudioFork(phoneNumber); err != nil {
-			l.Err(err).Msg("Failed to start audio fork")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		if !eagi {
+			return callClient.HandleCall(ctx, newApplication(agi, l), l)
 		}
-
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-}
-
-func handleGameDoneWebhook() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		hlog.FromRequest(r).Info().Msg("Received game done notification")
-		w.WriteHeader(http.StatusOK)
-		os.Exit(0)
-	}
-}
-
-func handleHeartbeatWebhook() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		hlog.FromRequest(r).Info().Msg("Received heartbeat check")
-		w.WriteHeader(http.StatusOK)
-	}
-}
-
-// register executes the registration process to verify the given code and hook up
-// the necessary callbacks.
-func register(verificationCode voipttt.VerificationCode, phoneNumber voipttt.PhoneNumber) error {
-	url := fmt.Sprintf("http://%s%s", serverAddr, voipttt.RoutePrivateAPIRegister)
-	data := voipttt.RegisterClientRequest{
-		VerificationCode:  verificationCode,
-		ClientPhoneNumber: phoneNumber,
-		SelectDigitURL:    voipttt.WebhookURL(fmt.Sprintf("http://%s%s", addr, webhookSelectDigitURL)),
-		HeartbeatURL:      voipttt.WebhookURL(fmt.Sprintf("http://%s%s", addr, webhookHeartbeatURL)),
-		GameDoneURL:       voipttt.WebhookURL(fmt.Sprintf("http://%s%s", addr, webhookGameDoneURL)),
-		GameStartURL:      voipttt.WebhookURL(fmt.Sprintf("http://%s%s", addr, webhookGameStart)),
-	}
-
-	body, err := json.Marshal(&data)
-	if err != nil {
-		return fmt.Errorf("marshal register JSON: %w", err)
+		audio, err := voipttt.OpenEAGIAudio()
+		if err != nil {
+			return err
+		}
+		defer audio.Close()
+		return callClient.HandleCall(ctx, newEAGIApplication(agi, audio, l), l)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	fastAGIListener, err := net.Listen("tcp", fastAGIAddr)
 	if err != nil {
-		return fmt.Errorf("send POST request: %w", err)
+		return fmt.Errorf("listen tcp: %w", err)
 	}
-	_ = resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("expected HTTP status code 200 OK, but got %d", resp.StatusCode)
-	}
-	return nil
+	return voipttt.ServeFastAGI(ctx, fastAGIListener, func(ctx context.Context, agi *voipttt.AGI) {
+		if err := callClient.HandleCall(ctx, newApplication(agi, l), l); err != nil {
+			l.Err(err).Msg("Failed to handle call")
+		}
+	})
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/audio"
+	"github.com/n9v9/voip-ttt/esl"
+)
+
+// errHungUp is returned when the caller hung up while we were waiting for input.
+var errHungUp = errors.New("caller hung up")
+
+// call is a single channel that FreeSWITCH connected to the event socket server.
+type call struct {
+	conn *esl.Conn
+	// Unique ID of the channel, used for api commands.
+	uuid string
+
+	digits     chan rune
+	hungUp     chan struct{}
+	hungUpOnce sync.Once
+
+	log zerolog.Logger
+}
+
+func newCall(conn *esl.Conn, l zerolog.Logger) *call {
+	uuid := conn.ChannelData().Get("Unique-ID")
+	return &call{
+		conn:   conn,
+		uuid:   uuid,
+		digits: make(chan rune, 32),
+		hungUp: make(chan struct{}),
+		log: l.With().
+			Str("channel_uuid", uuid).
+			Str("channel", conn.ChannelData().Get("Channel-Name")).
+			Logger(),
+	}
+}
+
+func (c *call) PhoneNumber() voipttt.PhoneNumber {
+	return voipttt.PhoneNumber(c.conn.ChannelData().Get("Caller-Caller-ID-Number"))
+}
+
+func (c *call) Channel() string {
+	return c.conn.ChannelData().Get("Channel-Name")
+}
+
+// receiveEvents passes DTMF digits to the waiting reader and marks the call as hung up
+// once FreeSWITCH reports the hangup or closes the connection.
+func (c *call) receiveEvents() {
+	defer c.hangup()
+
+	for event := range c.conn.Events() {
+		switch event.Name() {
+		case esl.EventDTMF:
+			digit := event.Get("DTMF-Digit")
+			if digit == "" {
+				continue
+			}
+			select {
+			case c.digits <- rune(digit[0]):
+			default:
+				c.log.Warn().Str("digit", digit).Msg("Dropped DTMF digit because nobody is reading")
+			}
+		case esl.EventChannelHangup:
+			c.log.Info().Str("cause", event.Get("Hangup-Cause")).Msg("Caller hung up")
+			c.hangup()
+		}
+	}
+}
+
+// hangup marks the call as hung up.
+func (c *call) hangup() {
+	c.hungUpOnce.Do(func() { close(c.hungUp) })
+}
+
+func (c *call) ReadInput(ctx context.Context, spec voipttt.InputSpec) (string, error) {
+	keys, err := spec.Read(func(timeout time.Duration) (rune, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-c.hungUp:
+			return 0, errHungUp
+		case <-time.After(timeout):
+			return 0, nil
+		case digit := <-c.digits:
+			c.log.Debug().Str("digit", string(digit)).Msg("Received single digit")
+			return digit, nil
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	c.log.Info().Str("digits", keys).Msg("Received final digits")
+	return keys, nil
+}
+
+// StartAudio forks the audio of the caller to the web socket at audioURL
+// through mod_audio_fork, which sends signed linear 16 bit audio at 16 kHz.
+func (c *call) StartAudio(ctx context.Context, audioURL string) error {
+	audioURL, err := voipttt.SetAudioFormat(audioURL, audio.Format{
+		Encoding:   audio.EncodingLinear16,
+		SampleRate: 16000,
+		Channels:   1,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.API(ctx, fmt.Sprintf("uuid_audio_fork %s start %s mono 16k", c.uuid, audioURL)); err != nil {
+		return fmt.Errorf("start audio fork: %w", err)
+	}
+	c.log.Info().Msg("Started audio stream")
+	return nil
+}
+
+// close hangs up the call if the caller is still connected.
+func (c *call) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	select {
+	case <-c.hungUp:
+	default:
+		if err := c.conn.Hangup(ctx, "NORMAL_CLEARING"); err != nil {
+			c.log.Err(err).Msg("Failed to hang up channel")
+		}
+	}
+}
+
+// Play queues the prompts on the channel. FreeSWITCH plays them one after another.
+func (c *call) Play(ctx context.Context, prompts []voipttt.Prompt) error {
+	for _, prompt := range prompts {
+		var err error
+		if prompt.Sound != "" {
+			err = c.conn.Execute(ctx, "playback", prompt.Sound+".wav")
+		} else {
+			err = c.conn.Execute(ctx, "say", "en number iterated "+prompt.Digits)
+		}
+		if err != nil {
+			return fmt.Errorf("play prompt: %w", err)
+		}
+	}
+	return nil
+}
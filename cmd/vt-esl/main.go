@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/esl"
+)
+
+var (
+	addr         string
+	serverAddr   string
+	voicePrompts bool
+	eslAddr      string
+	codeInput    string
+	moveInput    string
+)
+
+func main() {
+	rootCmd().Execute()
+}
+
+func rootCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "vt-esl",
+		Short: "vt-esl connects FreeSWITCH calls to the vt-server to play Tic-Tac-Toe over VoIP",
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+			if err := run(); err != nil {
+				log.Logger.Err(err).Msg("ESL program failed")
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&addr,
+		"addr",
+		"",
+		"Address and port to listen on to receive webhooks",
+	)
+	cmd.Flags().StringVar(
+		&serverAddr,
+		"server-addr",
+		"",
+		"Address and port of the game server",
+	)
+	cmd.Flags().StringVar(
+		&eslAddr,
+		"esl-addr",
+		":8084",
+		"Address and port that the `socket` dialplan application of FreeSWITCH connects to",
+	)
+	cmd.Flags().BoolVar(
+		&voicePrompts,
+		"voice-prompts",
+		false,
+		"Guide callers through the game with voice prompts, so that they can play without the website",
+	)
+	cmd.Flags().StringVar(
+		&codeInput,
+		"code-input",
+		"",
+		"How callers enter the verification code, given as <name>=<value> pairs, e.g. digit-timeout=10s,retries=3. "+
+			"The names are timeout, digit-timeout, min, max, retries, terminator, clear and command",
+	)
+	cmd.Flags().StringVar(
+		&moveInput,
+		"move-input",
+		"",
+		"How callers enter a move, given like --code-input. The game server may change the lengths and keys of a move",
+	)
+
+	cmd.MarkFlagRequired("addr")
+	cmd.MarkFlagRequired("server-addr")
+
+	return cmd
+}
+
+func run() error {
+	codeSpec, err := voipttt.ParseInputSpec(codeInput, voipttt.CodeInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --code-input: %w", err)
+	}
+	moveSpec, err := voipttt.ParseInputSpec(moveInput, voipttt.MoveInputSpec)
+	if err != nil {
+		return fmt.Errorf("parse --move-input: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", err)
+	}
+
+	// See vt-client, the listener may have been assigned a random port.
+	addr = listener.Addr().String()
+	l := log.Logger.With().Str("listen_addr", addr).Logger()
+
+	opts := []voipttt.CallClientOption{voipttt.WithInputSpecs(codeSpec, moveSpec)}
+	if voicePrompts {
+		opts = append(opts, voipttt.WithVoicePrompts())
+	}
+	callClient := voipttt.NewCallClient(addr, serverAddr, opts...)
+	webhookServer := http.Server{Handler: callClient.Handler()}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := webhookServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Err(err).Msg("Failed to serve webhooks")
+		}
+	}()
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = webhookServer.Shutdown(ctx)
+	}()
+
+	eslListener, err := net.Listen("tcp", eslAddr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", err)
+	}
+
+	return esl.Serve(ctx, eslListener, func(ctx context.Context, conn *esl.Conn) {
+		handleCall(ctx, callClient, newCall(conn, l))
+	}, l)
+}
+
+// handleCall answers the call and plays the game until it is done or the caller hangs up.
+func handleCall(ctx context.Context, callClient *voipttt.CallClient, c *call) {
+	defer c.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.hungUp:
+			cancel()
+		}
+	}()
+
+	c.log.Info().Str("phone_number", string(c.PhoneNumber())).Msg("Handle new call")
+
+	if err := c.conn.MyEvents(ctx); err != nil {
+		c.log.Err(err).Msg("Failed to subscribe to channel events")
+		return
+	}
+	go c.receiveEvents()
+
+	if err := c.conn.Execute(ctx, "answer", ""); err != nil {
+		c.log.Err(err).Msg("Failed to answer call")
+		return
+	}
+
+	// Signal the caller that they can enter their verification code.
+	if err := c.conn.Execute(ctx, "playback", "tone_stream://%(200,0,800)"); err != nil {
+		c.log.Err(err).Msg("Failed to play prompt")
+	}
+
+	if err := callClient.HandleCall(ctx, c, c.log); err != nil {
+		c.log.Err(err).Msg("Failed to handle call")
+	}
+}
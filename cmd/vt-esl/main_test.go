@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	voipttt "github.com/n9v9/voip-ttt"
+	"github.com/n9v9/voip-ttt/esl"
+)
+
+// fakeFreeSWITCH is the FreeSWITCH side of an outbound event socket connection.
+// It replies to every command with +OK.
+type fakeFreeSWITCH struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (f *fakeFreeSWITCH) write(s string) {
+	f.t.Helper()
+	if _, err := f.conn.Write([]byte(s)); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// expect reads the next command, fails if it is not the given one and replies with +OK.
+func (f *fakeFreeSWITCH) expect(command string) {
+	f.t.Helper()
+	_ = f.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var lines []string
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err != nil {
+			f.t.Fatalf("did not receive command %q: %v", command, err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if got := strings.Join(lines, "\n"); got != command {
+		f.t.Fatalf("got command %q, want %q", got, command)
+	}
+	if command == "connect" {
+		f.write("Content-Type: command/reply\nReply-Text: +OK\n" +
+			"Unique-ID: 1234\nChannel-Name: sofia/internal/100%40127.0.0.1\nCaller-Caller-ID-Number: 100\n\n")
+		return
+	}
+	f.write("Content-Type: command/reply\nReply-Text: +OK\n\n")
+}
+
+// event sends a plain event with the given URL encoded headers.
+func (f *fakeFreeSWITCH) event(headers ...string) {
+	f.t.Helper()
+	body := strings.Join(headers, "\n") + "\n\n"
+	f.write(fmt.Sprintf("Content-Type: text/event-plain\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+func TestHandleCall(t *testing.T) {
+	tests := []struct {
+		name string
+		// Status code of the game server when the call registers itself.
+		registerStatus int
+	}{
+		{name: "caller hangs up", registerStatus: http.StatusOK},
+		{name: "registration fails", registerStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registered := make(chan voipttt.RegisterClientRequest, 1)
+			gameServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req voipttt.RegisterClientRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decode register request: %v", err)
+				}
+				registered <- req
+				w.WriteHeader(tt.registerStatus)
+			}))
+			defer gameServer.Close()
+			callClient := voipttt.NewCallClient("127.0.0.1:0", strings.TrimPrefix(gameServer.URL, "http://"))
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			handled := make(chan struct{})
+			served := make(chan struct{})
+			go func() {
+				defer close(served)
+				_ = esl.Serve(ctx, listener, func(ctx context.Context, conn *esl.Conn) {
+					defer close(handled)
+					handleCall(ctx, callClient, newCall(conn, zerolog.Nop()))
+				}, zerolog.Nop())
+			}()
+			defer func() {
+				cancel()
+				<-served
+			}()
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			fs := &fakeFreeSWITCH{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+			fs.expect("connect")
+			fs.expect("myevents plain")
+			fs.expect("linger")
+			fs.expect("sendmsg\ncall-command: execute\nexecute-app-name: answer")
+			fs.expect("sendmsg\ncall-command: execute\nexecute-app-name: playback\nexecute-app-arg: tone_stream://%(200,0,800)")
+
+			// Enter the verification code, correcting a typo with the clear key.
+			for _, digit := range []string{"9", "*", "4", "2", "%23"} {
+				fs.event("Event-Name: DTMF", "DTMF-Digit: "+digit)
+			}
+			select {
+			case req := <-registered:
+				if req.VerificationCode != 42 || req.ClientPhoneNumber != "100" || req.Channel != "sofia/internal/100@127.0.0.1" {
+					t.Fatalf("got register request %+v", req)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("call was not registered")
+			}
+
+			if tt.registerStatus != http.StatusOK {
+				fs.expect("sendmsg\ncall-command: hangup\nhangup-cause: NORMAL_CLEARING")
+			} else {
+				fs.event("Event-Name: CHANNEL_HANGUP", "Hangup-Cause: NORMAL_CLEARING")
+			}
+			select {
+			case <-handled:
+			case <-time.After(time.Second * 5):
+				t.Fatal("call was not handled to the end")
+			}
+
+			// The connection is closed without hanging up a caller who already hung up.
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			if rest, err := fs.reader.ReadString('\n'); err == nil {
+				t.Fatalf("received %q after the call was handled", rest)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -13,7 +16,33 @@ import (
 	voipttt "github.com/n9v9/voip-ttt"
 )
 
-var callPhoneNumber string
+var (
+	callPhoneNumber string
+	amiAddr         string
+	amiUsername     string
+	amiSecret       string
+	sipAddr         string
+	sipPublicIP     string
+	sipSounds       string
+	mnkGames        []string
+
+	computerWait        time.Duration
+	computerDifficulty  string
+	computerBlunderRate float64
+	computerThinkTime   time.Duration
+
+	bots           []string
+	botMoveTimeout time.Duration
+
+	turnTime  time.Duration
+	totalTime time.Duration
+	onTimeUp  string
+
+	invalidMoves []string
+
+	bestOf  int
+	rematch bool
+)
 
 func main() {
 	rootCmd().Execute()
@@ -35,6 +64,129 @@ func rootCmd() *cobra.Command {
 		"Phone number that is displayed on the website",
 	)
 
+	cmd.Flags().StringVar(
+		&amiAddr,
+		"ami-addr",
+		"",
+		"Address and port of the asterisk manager interface used to detect hangups. Disabled if empty",
+	)
+	cmd.Flags().StringVar(
+		&amiUsername,
+		"ami-username",
+		"",
+		"Username to log in to the asterisk manager interface",
+	)
+	cmd.Flags().StringVar(
+		&amiSecret,
+		"ami-secret",
+		"",
+		"Secret to log in to the asterisk manager interface",
+	)
+
+	cmd.Flags().StringVar(
+		&sipAddr,
+		"sip-addr",
+		"",
+		"UDP address to accept SIP calls on directly, e.g. :5060. Disabled if empty",
+	)
+	cmd.Flags().StringVar(
+		&sipPublicIP,
+		"sip-public-ip",
+		"",
+		"IP address announced to SIP callers. Detected automatically if empty",
+	)
+	cmd.Flags().StringVar(
+		&sipSounds,
+		"sip-sounds",
+		"",
+		"Directory of the WAV voice prompts played to SIP callers. Callers hear no prompts if empty",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&mnkGames,
+		"mnk-game",
+		nil,
+		"Additional m,n,k-game given as <columns>x<rows>x<in a row>, e.g. 9x9x4. Can be repeated",
+	)
+
+	cmd.Flags().DurationVar(
+		&computerWait,
+		"computer-wait",
+		0,
+		"Time a caller waits for an opponent before playing against the computer, e.g. 30s. Disabled if zero",
+	)
+	cmd.Flags().StringVar(
+		&computerDifficulty,
+		"computer-difficulty",
+		string(voipttt.DifficultyPerfect),
+		"Difficulty of the computer opponent: random, greedy or perfect",
+	)
+	cmd.Flags().Float64Var(
+		&computerBlunderRate,
+		"computer-blunder-rate",
+		0,
+		"Probability from 0 to 1 that the computer opponent makes a random move",
+	)
+	cmd.Flags().DurationVar(
+		&computerThinkTime,
+		"computer-think-time",
+		time.Second*2,
+		"Time the computer opponent searches for a perfect move",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&bots,
+		"bot",
+		nil,
+		"Program that players can choose as opponent, given as <name>=<command with arguments>. Can be repeated",
+	)
+	cmd.Flags().DurationVar(
+		&botMoveTimeout,
+		"bot-move-timeout",
+		time.Second*10,
+		"Time a bot has for a single move before it forfeits the game",
+	)
+
+	cmd.Flags().DurationVar(
+		&turnTime,
+		"turn-time",
+		0,
+		"Time a player has for a single move, e.g. 30s. Unlimited if zero",
+	)
+	cmd.Flags().DurationVar(
+		&totalTime,
+		"total-time",
+		0,
+		"Time a player has for all their moves of a game, e.g. 5m. Unlimited if zero",
+	)
+	cmd.Flags().StringVar(
+		&onTimeUp,
+		"on-time-up",
+		string(voipttt.TimeUpRandomMove),
+		"What happens when a player runs out of time: random, forfeit or skip",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&invalidMoves,
+		"invalid-move",
+		nil,
+		"How a game handles invalid moves, given as <game>=reprompt:<times>, <game>=random or <game>=forfeit. "+
+			"Defaults to reprompt:3. Can be repeated",
+	)
+
+	cmd.Flags().IntVar(
+		&bestOf,
+		"best-of",
+		1,
+		"Number of games two callers play in a series, e.g. 3. The players switch sides after each game",
+	)
+	cmd.Flags().BoolVar(
+		&rematch,
+		"rematch",
+		false,
+		"Let two callers vote for another series against each other once a series is over",
+	)
+
 	cmd.MarkFlagRequired("call-phone-number")
 
 	return cmd
@@ -52,6 +204,109 @@ func run() {
 		cancel()
 	}()
 
-	server := voipttt.NewServer(voipttt.PhoneNumber(callPhoneNumber), ":8080", ":8081")
+	for _, game := range mnkGames {
+		var m, n, k int
+		if _, err := fmt.Sscanf(game, "%dx%dx%d", &m, &n, &k); err != nil || m < 1 || n < 1 || k < 1 {
+			log.Fatal().Str("mnk_game", game).Msg("Invalid m,n,k-game, expected <columns>x<rows>x<in a row>")
+		}
+		voipttt.RegisterGame("mnk-"+game, voipttt.NewMNKGame(m, n, k))
+	}
+
+	var opts []voipttt.ServerOption
+	if amiAddr != "" {
+		opts = append(opts, voipttt.WithAMI(voipttt.AMIConfig{
+			Addr:     amiAddr,
+			Username: amiUsername,
+			Secret:   amiSecret,
+		}))
+	}
+
+	if sipAddr != "" {
+		if sipSounds != "" {
+			if info, err := os.Stat(sipSounds); err != nil || !info.IsDir() {
+				log.Fatal().Str("sip_sounds", sipSounds).Msg("The sounds directory of SIP callers does not exist")
+			}
+		}
+		opts = append(opts, voipttt.WithSIP(voipttt.SIPConfig{
+			Addr:      sipAddr,
+			PublicIP:  sipPublicIP,
+			SoundsDir: sipSounds,
+		}))
+	}
+
+	if computerWait > 0 {
+		difficulty, err := voipttt.ParseDifficulty(computerDifficulty)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid computer difficulty")
+		}
+		if computerBlunderRate < 0 || computerBlunderRate > 1 {
+			log.Fatal().Float64("computer_blunder_rate", computerBlunderRate).Msg("Blunder rate must be between 0 and 1")
+		}
+		opts = append(opts, voipttt.WithComputerOpponent(voipttt.ComputerConfig{
+			Wait:        computerWait,
+			Difficulty:  difficulty,
+			BlunderRate: computerBlunderRate,
+			ThinkTime:   computerThinkTime,
+		}))
+	}
+
+	for _, bot := range bots {
+		name, command, ok := strings.Cut(bot, "=")
+		if !ok || name == "" || len(strings.Fields(command)) == 0 {
+			log.Fatal().Str("bot", bot).Msg("Invalid bot, expected <name>=<command with arguments>")
+		}
+		opts = append(opts, voipttt.WithBot(voipttt.BotConfig{
+			Name:        name,
+			Command:     strings.Fields(command),
+			MoveTimeout: botMoveTimeout,
+		}))
+	}
+
+	if turnTime > 0 || totalTime > 0 {
+		policy, err := voipttt.ParseTimeUpPolicy(onTimeUp)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid time up policy")
+		}
+		opts = append(opts, voipttt.WithClock(voipttt.ClockConfig{
+			TurnTime:  turnTime,
+			TotalTime: totalTime,
+			OnTimeUp:  policy,
+		}))
+	}
+
+	for _, invalidMove := range invalidMoves {
+		game, policy, _ := strings.Cut(invalidMove, "=")
+		known := false
+		for _, name := range voipttt.GameTypes() {
+			known = known || name == game
+		}
+		if !known {
+			log.Fatal().Str("invalid_move", invalidMove).Msg("Unknown game")
+		}
+		policy, reprompts, hasReprompts := strings.Cut(policy, ":")
+		config := voipttt.InvalidMoveConfig{}
+		var err error
+		if config.Policy, err = voipttt.ParseInvalidMovePolicy(policy); err != nil {
+			log.Fatal().Err(err).Str("invalid_move", invalidMove).Msg("Invalid policy for invalid moves")
+		}
+		if hasReprompts {
+			if config.Reprompts, err = strconv.Atoi(reprompts); err != nil || config.Reprompts < 0 {
+				log.Fatal().Str("invalid_move", invalidMove).Msg("Invalid number of reprompts")
+			}
+		}
+		opts = append(opts, voipttt.WithInvalidMovePolicy(game, config))
+	}
+
+	if bestOf < 1 {
+		log.Fatal().Int("best_of", bestOf).Msg("A series must have at least one game")
+	}
+	if bestOf > 1 || rematch {
+		opts = append(opts, voipttt.WithSeries(voipttt.SeriesConfig{
+			BestOf:  bestOf,
+			Rematch: rematch,
+		}))
+	}
+
+	server := voipttt.NewServer(voipttt.PhoneNumber(callPhoneNumber), ":8080", ":8081", opts...)
 	server.Run(ctx, time.Second*5)
 }
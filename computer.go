@@ -0,0 +1,299 @@
+package voipttt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Difficulty is how well the computer opponent plays.
+type Difficulty string
+
+const (
+	// DifficultyRandom makes random legal moves.
+	DifficultyRandom Difficulty = "random"
+	// DifficultyGreedy wins if it can win with the next move and otherwise avoids
+	// moves after which the opponent can win with their next move.
+	DifficultyGreedy Difficulty = "greedy"
+	// DifficultyPerfect searches the game tree with minimax and alpha-beta pruning.
+	// Small games like Tic-Tac-Toe are searched completely, larger games as deep
+	// as the think time allows.
+	DifficultyPerfect Difficulty = "perfect"
+)
+
+// ParseDifficulty returns the difficulty of the given name.
+func ParseDifficulty(name string) (Difficulty, error) {
+	switch d := Difficulty(name); d {
+	case DifficultyRandom, DifficultyGreedy, DifficultyPerfect:
+		return d, nil
+	}
+	return "", fmt.Errorf(
+		"unknown difficulty %q, expected %s, %s or %s",
+		name,
+		DifficultyRandom,
+		DifficultyGreedy,
+		DifficultyPerfect,
+	)
+}
+
+// ComputerConfig configures the computer opponent.
+type ComputerConfig struct {
+	// Wait is the time a caller waits for a human opponent before they play against the computer.
+	Wait       time.Duration
+	Difficulty Difficulty
+	// BlunderRate is the probability from 0 to 1 that the computer makes a random move
+	// instead of the move of its difficulty.
+	BlunderRate float64
+	// ThinkTime limits the search for a perfect move. Defaults to two seconds.
+	ThinkTime time.Duration
+}
+
+// WithComputerOpponent lets callers play against the computer if no other
+// caller wants to play the same game within the configured time.
+//
+// Games that do not implement cloneGame, e.g. because of hidden information,
+// are always played with random moves.
+func WithComputerOpponent(config ComputerConfig) ServerOption {
+	return func(s *Server) {
+		if config.ThinkTime == 0 {
+			config.ThinkTime = 2 * time.Second
+		}
+		s.wsManager.computer = &config
+	}
+}
+
+// computerPhoneNumber is shown to the opponent of the computer.
+const computerPhoneNumber PhoneNumber = "Computer"
+
+// computerPlayer is the call of a computer opponent. It makes its moves itself
+// instead of reading them from a caller and ignores all announcements.
+type computerPlayer struct {
+	game   Game
+	config ComputerConfig
+	// done is never closed, because the computer does not hang up.
+	done chan struct{}
+}
+
+// newComputerClient returns a client without web socket connection, whose moves
+// are made by the computer.
+func newComputerClient(rules Game, gameType string, config ComputerConfig) *webSocketClient {
+	return &webSocketClient{
+		connMu:      new(sync.Mutex),
+		phoneNumber: computerPhoneNumber,
+		gameType:    gameType,
+		call: &computerPlayer{
+			game:   rules,
+			config: config,
+			done:   make(chan struct{}),
+		},
+		log: log.Logger.With().
+			Str("game", gameType).
+			Str("difficulty", string(config.Difficulty)).
+			Logger(),
+	}
+}
+
+// ReadMove returns the move of the computer. The input spec is ignored,
+// because the move is not entered with keys.
+func (c *computerPlayer) ReadMove(ctx context.Context, _ InputSpec) (string, error) {
+	moves := c.game.Moves()
+	if len(moves) == 0 {
+		return "", errors.New("no legal moves left")
+	}
+
+	if _, canLookAhead := c.game.(cloneGame); !canLookAhead || rand.Float64() < c.config.BlunderRate {
+		return moves[rand.Intn(len(moves))], nil
+	}
+
+	// Equally good moves are chosen randomly.
+	rand.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+
+	switch c.config.Difficulty {
+	case DifficultyGreedy:
+		return greedyMove(c.game, moves), nil
+	case DifficultyPerfect:
+		ctx, cancel := context.WithTimeout(ctx, c.config.ThinkTime)
+		defer cancel()
+		return searchMove(ctx, c.game, moves), nil
+	default:
+		return moves[0], nil
+	}
+}
+
+func (c *computerPlayer) StartAudio(context.Context) error {
+	return nil
+}
+
+func (c *computerPlayer) Announce(context.Context, Announcement) error {
+	return nil
+}
+
+func (c *computerPlayer) Hangup(context.Context) error {
+	return nil
+}
+
+func (c *computerPlayer) Done() <-chan struct{} {
+	return c.done
+}
+
+// play returns a copy of the game after the move. The game must implement cloneGame.
+func play(game Game, move string) Game {
+	next := game.(cloneGame).Clone()
+	if err := next.Play(move); err != nil {
+		// Moves only returns legal moves.
+		panic(err)
+	}
+	return next
+}
+
+// greedyMove returns a move that wins the game, otherwise the first move after which
+// the opponent can not win with their next move, otherwise the first move.
+func greedyMove(game Game, moves []string) string {
+	me := game.Turn()
+	safe := ""
+	for _, move := range moves {
+		next := play(game, move)
+		outcome := next.Outcome()
+		if outcome.Winner == me {
+			return move
+		}
+		if safe == "" && !outcome.Done && !canWinNext(next, me.Opponent()) {
+			safe = move
+		}
+	}
+	if safe != "" {
+		return safe
+	}
+	return moves[0]
+}
+
+// canWinNext returns whether the player can win with the next move.
+func canWinNext(game Game, player Player) bool {
+	if game.Turn() != player {
+		return false
+	}
+	for _, move := range game.Moves() {
+		if play(game, move).Outcome().Winner == player {
+			return true
+		}
+	}
+	return false
+}
+
+// Values of a position for the searching player. Wins in fewer moves are valued higher.
+const (
+	searchWin  = 1000
+	searchLoss = -searchWin
+)
+
+// searcher searches the game tree with minimax and alpha-beta pruning.
+type searcher struct {
+	ctx context.Context
+	me  Player
+	// cutoff is set if the depth limit stopped the search before the game was done.
+	cutoff bool
+}
+
+// searchMove returns the best move it finds until the context is done. It searches
+// with increasing depth and returns the best move of the deepest completed search.
+func searchMove(ctx context.Context, game Game, moves []string) string {
+	s := &searcher{ctx: ctx, me: game.Turn()}
+	best := moves[0]
+	for depth := 1; ; depth++ {
+		move, value, ok := s.searchRoot(game, moves, depth)
+		if !ok {
+			return best
+		}
+		best = move
+		if !s.cutoff || value >= searchWin-depth {
+			// The whole game tree was searched or a win is certain.
+			return best
+		}
+	}
+}
+
+// searchRoot returns the best move with its value, searching depth moves ahead.
+// It returns false if the context was done before the search was completed.
+func (s *searcher) searchRoot(game Game, moves []string, depth int) (string, int, bool) {
+	s.cutoff = false
+	best, bestValue := moves[0], searchLoss-1
+	alpha := searchLoss - 1
+	for _, move := range moves {
+		value, ok := s.minimax(play(game, move), depth-1, 1, alpha, searchWin+1)
+		if !ok {
+			return "", 0, false
+		}
+		if value > bestValue {
+			best, bestValue = move, value
+		}
+		if value > alpha {
+			alpha = value
+		}
+	}
+
+	// The best move is searched first at the next depth, to prune more.
+	for i, move := range moves {
+		if move == best {
+			moves[0], moves[i] = moves[i], moves[0]
+		}
+	}
+	return best, bestValue, true
+}
+
+// minimax returns the value of the game for the searching player, looking at most
+// depth moves ahead. ply is the number of moves made since the root of the search.
+// It returns false if the context was done before the search was completed.
+func (s *searcher) minimax(game Game, depth, ply, alpha, beta int) (int, bool) {
+	if s.ctx.Err() != nil {
+		return 0, false
+	}
+
+	switch outcome := game.Outcome(); {
+	case outcome.Done && outcome.Winner == s.me:
+		return searchWin - ply, true
+	case outcome.Done && outcome.Winner == s.me.Opponent():
+		return searchLoss + ply, true
+	case outcome.Done:
+		return 0, true
+	case depth == 0:
+		s.cutoff = true
+		return 0, true
+	}
+
+	// The turn decides who moves, because not all games alternate every move.
+	maximize := game.Turn() == s.me
+	best := searchWin + 1
+	if maximize {
+		best = searchLoss - 1
+	}
+	for _, move := range game.Moves() {
+		value, ok := s.minimax(play(game, move), depth-1, ply+1, alpha, beta)
+		if !ok {
+			return 0, false
+		}
+		if maximize {
+			if value > best {
+				best = value
+			}
+			if best > alpha {
+				alpha = best
+			}
+		} else {
+			if value < best {
+				best = value
+			}
+			if best < beta {
+				beta = best
+			}
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,75 @@
+package voipttt
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// playPerfectAgainstAll plays the perfect move for the computer and every possible move
+// for its opponent. It fails the test if the opponent wins any of the games.
+func playPerfectAgainstAll(t *testing.T, game Game, computer Player) {
+	t.Helper()
+	outcome := game.Outcome()
+	if outcome.Done {
+		if outcome.Winner == computer.Opponent() {
+			t.Fatalf("computer as %v lost the game %v", computer, game.(*ticTacToe).history)
+		}
+		return
+	}
+
+	if game.Turn() == computer {
+		playPerfectAgainstAll(t, play(game, searchMove(context.Background(), game, game.Moves())), computer)
+		return
+	}
+	for _, move := range game.Moves() {
+		playPerfectAgainstAll(t, play(game, move), computer)
+	}
+}
+
+func TestPerfectNeverLosesTicTacToe(t *testing.T) {
+	for _, computer := range []Player{PlayerOne, PlayerTwo} {
+		playPerfectAgainstAll(t, new(ticTacToe), computer)
+	}
+}
+
+func TestPerfectAgainstPerfectDraws(t *testing.T) {
+	game := Game(new(ticTacToe))
+	for !game.Outcome().Done {
+		game = play(game, searchMove(context.Background(), game, game.Moves()))
+	}
+	if outcome := game.Outcome(); outcome.Winner != PlayerNone {
+		t.Fatalf("got %+v, want a draw", outcome)
+	}
+}
+
+func TestGreedyMove(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []string
+		want  string
+	}{
+		// Player one has 1 and 2, player two has 4 and 5.
+		{name: "win", moves: []string{"1", "4", "2", "5"}, want: "3"},
+		// Player one has 1 and 2, player two has 5.
+		{name: "block", moves: []string{"1", "5", "2"}, want: "3"},
+		// Player two can complete 4, 5, 6 instead of blocking 1, 2, 3.
+		{name: "win before block", moves: []string{"1", "4", "2", "5", "7"}, want: "6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := new(ticTacToe)
+			playMoves(t, game, tt.moves...)
+
+			// The result must not depend on the order of the moves.
+			for i := 0; i < 10; i++ {
+				moves := game.Moves()
+				rand.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+				if got := greedyMove(game, moves); got != tt.want {
+					t.Fatalf("got %s with moves %v, want %s", got, moves, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package voipttt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GameConnectFour is the name of Connect Four.
+const GameConnectFour = "connect-four"
+
+const (
+	connectFourRows    = 6
+	connectFourColumns = 7
+	connectFourToWin   = 4
+)
+
+// connectFour is a game of Connect Four. A move is the column from 1 to 7,
+// into which the disc of the player is dropped.
+type connectFour struct {
+	grid   grid
+	turn   Player
+	winner Player
+	// Zero based row and column of the latest disc, row is -1 before the first move.
+	lastRow, lastCol int
+	// history are the zero based columns of all moves, -1 for a skipped turn.
+	history []int
+}
+
+func newConnectFour() Game {
+	return &connectFour{
+		grid:    newGrid(connectFourRows, connectFourColumns),
+		lastRow: -1,
+	}
+}
+
+// connectFourState is the state of the game as it is shown on the website.
+type connectFourState struct {
+	gridState
+	// LastColumn is the column of the latest disc from 1 to 7, 0 before the first move.
+	LastColumn int `json:"lastColumn"`
+	// LandingRow is the row the latest disc landed in, counted from 1 at the bottom,
+	// 0 before the first move.
+	LandingRow int `json:"landingRow"`
+}
+
+func (c *connectFour) Turn() Player {
+	if c.turn == PlayerNone {
+		return PlayerOne
+	}
+	return c.turn
+}
+
+// Moves returns the columns that are not full yet.
+func (c *connectFour) Moves() []string {
+	if c.Outcome().Done {
+		return nil
+	}
+	var moves []string
+	for col := 0; col < c.grid.cols; col++ {
+		if c.grid.at(0, col) == PlayerNone {
+			moves = append(moves, strconv.Itoa(col+1))
+		}
+	}
+	return moves
+}
+
+func (c *connectFour) Play(move string) error {
+	col, err := strconv.Atoi(move)
+	if err != nil || col < 1 || col > c.grid.cols {
+		return fmt.Errorf("%w: %q is not a column", ErrInvalidMove, move)
+	}
+	col--
+
+	if c.Outcome().Done {
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	}
+
+	row := c.landingRow(col)
+	if row < 0 {
+		return fmt.Errorf("%w: column %d is full", ErrIllegalMove, col+1)
+	}
+
+	player := c.Turn()
+	c.grid.set(row, col, player)
+	c.lastRow, c.lastCol = row, col
+	if c.grid.inRow(row, col, connectFourToWin) {
+		c.winner = player
+	}
+	c.turn = player.Opponent()
+	c.history = append(c.history, col)
+	return nil
+}
+
+func (c *connectFour) Skip() {
+	c.turn = c.Turn().Opponent()
+	c.history = append(c.history, -1)
+}
+
+// Undo removes the topmost disc of the column of the latest move.
+func (c *connectFour) Undo() bool {
+	if len(c.history) == 0 {
+		return false
+	}
+	col := c.history[len(c.history)-1]
+	c.history = c.history[:len(c.history)-1]
+	c.turn = c.Turn().Opponent()
+	if col < 0 {
+		return true
+	}
+
+	// The game can not go on after a win, so the latest move was not won before.
+	c.grid.set(c.landingRow(col)+1, col, PlayerNone)
+	c.winner = PlayerNone
+	c.lastRow = -1
+	for i := len(c.history) - 1; i >= 0; i-- {
+		if c.history[i] >= 0 {
+			c.lastRow, c.lastCol = c.landingRow(c.history[i])+1, c.history[i]
+			break
+		}
+	}
+	return true
+}
+
+func (c *connectFour) Outcome() Outcome {
+	return Outcome{
+		Done:   c.winner != PlayerNone || c.grid.full(),
+		Winner: c.winner,
+	}
+}
+
+func (c *connectFour) State() any {
+	state := &connectFourState{
+		gridState: c.grid.state(),
+	}
+	state.Labels = make([]string, len(state.Fields))
+	for i := range state.Labels {
+		state.Labels[i] = strconv.Itoa(i%c.grid.cols + 1)
+	}
+	if c.lastRow >= 0 {
+		state.LastColumn = c.lastCol + 1
+		state.LandingRow = c.grid.rows - c.lastRow
+	}
+	return state
+}
+
+func (c *connectFour) Input() InputSpec {
+	return MoveInputSpec
+}
+
+// Fields returns the topmost disc of each column.
+func (c *connectFour) Fields() []field {
+	fields := make([]field, c.grid.cols)
+	for col := range fields {
+		fields[col].Move = strconv.Itoa(col + 1)
+		if row := c.landingRow(col) + 1; row < c.grid.rows {
+			fields[col].Owner = c.grid.at(row, col)
+		}
+	}
+	return fields
+}
+
+func (c *connectFour) Clone() Game {
+	clone := *c
+	clone.grid = c.grid.clone()
+	clone.history = append([]int(nil), c.history...)
+	return &clone
+}
+
+// landingRow returns the zero based row a disc dropped into the given column lands in,
+// -1 if the column is full.
+func (c *connectFour) landingRow(col int) int {
+	for row := c.grid.rows - 1; row >= 0; row-- {
+		if c.grid.at(row, col) == PlayerNone {
+			return row
+		}
+	}
+	return -1
+}
@@ -0,0 +1,103 @@
+package voipttt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectFourGravity(t *testing.T) {
+	c := newConnectFour().(*connectFour)
+	playMoves(t, c, "4", "4", "3")
+
+	for _, tt := range []struct {
+		row, col int
+		want     Player
+	}{
+		{5, 3, PlayerOne},
+		{4, 3, PlayerTwo},
+		{3, 3, PlayerNone},
+		{5, 2, PlayerOne},
+	} {
+		if got := c.grid.at(tt.row, tt.col); got != tt.want {
+			t.Errorf("got %v at row %d and column %d, want %v", got, tt.row, tt.col, tt.want)
+		}
+	}
+
+	state := c.State().(*connectFourState)
+	if state.LastColumn != 3 || state.LandingRow != 1 {
+		t.Fatalf("got column %d and row %d of the latest disc, want column 3 and row 1", state.LastColumn, state.LandingRow)
+	}
+}
+
+func TestConnectFourWin(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []string
+	}{
+		{name: "horizontal", moves: []string{"1", "1", "2", "2", "3", "3", "4"}},
+		{name: "vertical", moves: []string{"1", "2", "1", "2", "1", "2", "1"}},
+		{name: "diagonal", moves: []string{"1", "2", "2", "3", "3", "4", "3", "4", "4", "7", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConnectFour()
+			playMoves(t, c, tt.moves[:len(tt.moves)-1]...)
+			if c.Outcome().Done {
+				t.Fatal("game is over before the winning move")
+			}
+
+			playMoves(t, c, tt.moves[len(tt.moves)-1])
+			if outcome := c.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerOne}) {
+				t.Fatalf("got %+v, want a win of %v", outcome, PlayerOne)
+			}
+			if err := c.Play("5"); !errors.Is(err, ErrIllegalMove) {
+				t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+			}
+		})
+	}
+}
+
+func TestConnectFourFullColumn(t *testing.T) {
+	c := newConnectFour()
+	playMoves(t, c, "1", "1", "1", "1", "1", "1")
+
+	if err := c.Play("1"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	for _, move := range c.Moves() {
+		if move == "1" {
+			t.Fatal("full column is a legal move")
+		}
+	}
+	for _, move := range []string{"", "0", "8", "a"} {
+		if err := c.Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+}
+
+func TestConnectFourUndo(t *testing.T) {
+	c := newConnectFour().(*connectFour)
+	playMoves(t, c, "1", "2", "1", "2", "1", "2", "1")
+	c.Skip()
+
+	if !c.Undo() || c.Turn() != PlayerTwo || c.Outcome() != (Outcome{Done: true, Winner: PlayerOne}) {
+		t.Fatalf("got turn %v and %+v after undoing the skip", c.Turn(), c.Outcome())
+	}
+	if !c.Undo() || c.Turn() != PlayerOne || c.Outcome().Done {
+		t.Fatalf("got turn %v and %+v after undoing the winning move", c.Turn(), c.Outcome())
+	}
+	if c.grid.at(2, 0) != PlayerNone || c.grid.at(3, 0) != PlayerOne {
+		t.Fatal("undo did not remove the topmost disc")
+	}
+	if c.lastRow != 3 || c.lastCol != 1 {
+		t.Fatalf("got latest disc at row %d and column %d, want row 3 and column 1", c.lastRow, c.lastCol)
+	}
+
+	for c.Undo() {
+	}
+	if c.lastRow != -1 || c.Turn() != PlayerOne {
+		t.Fatalf("got latest row %d and turn %v after undoing all moves", c.lastRow, c.Turn())
+	}
+}
@@ -0,0 +1,104 @@
+package voipttt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// EAGIAudioFD is the file descriptor on which asterisk writes the audio of the caller
+// when the client is started with the EAGI instead of the AGI application.
+const EAGIAudioFD = 3
+
+const (
+	// eagiFrameSize is the size of a single frame that is sent to the private API,
+	// 20 ms of signed linear 16 bit audio at 8 kHz.
+	eagiFrameSize = 320
+	// eagiBufferedFrames is the number of frames that are buffered while the
+	// web socket is too slow, before new frames are dropped.
+	eagiBufferedFrames = 50
+	// eagiWriteTimeout is the time a single frame may take to be sent.
+	eagiWriteTimeout = time.Second * 5
+)
+
+// OpenEAGIAudio returns the audio of the caller that asterisk writes to EAGIAudioFD,
+// which is signed linear 16 bit at 8 kHz in the byte order of the host.
+func OpenEAGIAudio() (io.ReadCloser, error) {
+	f := os.NewFile(EAGIAudioFD, "eagi-audio")
+	if f == nil {
+		return nil, errors.New("eagi audio file descriptor is not open")
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("eagi audio file descriptor is not open: %w", err)
+	}
+	return f, nil
+}
+
+// StreamAudio sends the audio read from r to the web socket at audioURL of the private API,
+// split into frames of 20 ms. It blocks until r is exhausted or the context is cancelled.
+//
+// Frames are buffered if the web socket is too slow and dropped once the buffer is full.
+// Reading continues even if the web socket fails, because asterisk must be able to keep
+// writing the audio of the call.
+func StreamAudio(ctx context.Context, r io.Reader, audioURL string, log zerolog.Logger) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, audioURL, nil)
+	if err != nil {
+		return fmt.Errorf("connect to audio web socket: %w", err)
+	}
+	defer conn.Close()
+
+	frames := make(chan []byte, eagiBufferedFrames)
+	writeDone := make(chan struct{})
+
+	go func() {
+		defer close(writeDone)
+		for frame := range frames {
+			_ = conn.SetWriteDeadline(time.Now().Add(eagiWriteTimeout))
+			if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+				log.Err(err).Msg("Failed to send audio to web socket")
+				// Drain the remaining frames, so that reading never blocks.
+				for range frames {
+				}
+				return
+			}
+		}
+	}()
+
+	// Sample logs because frames are dropped many times per second.
+	sampleLog := log.Sample(&zerolog.BurstSampler{
+		Burst:  1,
+		Period: time.Second * 5,
+	})
+
+	var dropped uint64
+	for ctx.Err() == nil {
+		frame := make([]byte, eagiFrameSize)
+		n, err := io.ReadFull(r, frame)
+		if n > 0 {
+			select {
+			case frames <- frame[:n]:
+			default:
+				dropped++
+				sampleLog.Warn().Uint64("dropped_frames", dropped).Msg("Dropped audio because the web socket is too slow")
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrClosed) {
+				break
+			}
+			close(frames)
+			<-writeDone
+			return fmt.Errorf("read audio: %w", err)
+		}
+	}
+
+	close(frames)
+	<-writeDone
+	return ctx.Err()
+}
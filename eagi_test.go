@@ -0,0 +1,159 @@
+package voipttt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// eagiURLEnv is the audio web socket that the EAGI helper process streams to,
+// see TestEAGIHelperProcess.
+const eagiURLEnv = "VOIPTTT_TEST_EAGI_URL"
+
+// TestEAGIHelperProcess is not a real test, but a client started by EAGI that streams
+// the audio on its file descriptor 3 to the audio web socket.
+func TestEAGIHelperProcess(t *testing.T) {
+	audioURL := os.Getenv(eagiURLEnv)
+	if audioURL == "" {
+		t.Skip("only runs as an EAGI client")
+	}
+
+	audio, err := OpenEAGIAudio()
+	if err != nil {
+		os.Exit(2)
+	}
+	if err := StreamAudio(context.Background(), audio, audioURL, zerolog.Nop()); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// newTestAudioServer returns the URL of an audio web socket that sends the size of all
+// received frames on the returned channel. The connection is read once release is closed.
+func newTestAudioServer(t *testing.T, release <-chan struct{}) (string, <-chan int) {
+	t.Helper()
+	frames := make(chan int, 100000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade web socket: %v", err)
+			return
+		}
+		defer conn.Close()
+		defer close(frames)
+
+		<-release
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- len(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), frames
+}
+
+func TestStreamEAGIAudio(t *testing.T) {
+	released := make(chan struct{})
+	close(released)
+	audioURL, frames := newTestAudioServer(t, released)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestEAGIHelperProcess$")
+	cmd.Env = append(os.Environ(), eagiURLEnv+"="+audioURL)
+	// The first extra file is the file descriptor 3 of the process, as with EAGI.
+	cmd.ExtraFiles = []*os.File{r}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	// Three frames of 20 ms and the rest of the call.
+	if _, err := w.Write(make([]byte, eagiFrameSize*3+40)); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("EAGI client failed: %v", err)
+	}
+
+	var sizes []int
+	for size := range frames {
+		sizes = append(sizes, size)
+	}
+	want := []int{eagiFrameSize, eagiFrameSize, eagiFrameSize, 40}
+	if len(sizes) != len(want) {
+		t.Fatalf("got frames of %v bytes, want %v", sizes, want)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Fatalf("got frames of %v bytes, want %v", sizes, want)
+		}
+	}
+}
+
+// eofReader signals when the reader is exhausted.
+type eofReader struct {
+	io.Reader
+	eof chan struct{}
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		select {
+		case <-r.eof:
+		default:
+			close(r.eof)
+		}
+	}
+	return n, err
+}
+
+func TestStreamAudioDropsFramesOfSlowWebSocket(t *testing.T) {
+	release := make(chan struct{})
+	audioURL, frames := newTestAudioServer(t, release)
+
+	// Far more audio than fits into the buffers of the connection.
+	const total = 50000
+	audio := &eofReader{Reader: bytes.NewReader(make([]byte, eagiFrameSize*total)), eof: make(chan struct{})}
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- StreamAudio(context.Background(), audio, audioURL, zerolog.Nop())
+	}()
+
+	// Reading must not wait for the web socket, which does not read yet.
+	select {
+	case <-audio.eof:
+	case <-time.After(eagiWriteTimeout / 2):
+		t.Fatal("reading the audio blocked while the web socket was too slow")
+	}
+	close(release)
+
+	if err := <-streamed; err != nil {
+		t.Fatal(err)
+	}
+	var received int
+	for range frames {
+		received++
+	}
+	if received < eagiBufferedFrames || received >= total {
+		t.Fatalf("got %d of %d frames, want the buffered frames and the rest to be dropped", received, total)
+	}
+}
@@ -0,0 +1,204 @@
+package voipttt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Player is one of the two players of a game.
+type Player int
+
+const (
+	PlayerNone Player = 0 // No player, e.g. a free field or the winner of a draw.
+	PlayerOne  Player = 1 // The player who has the first turn.
+	PlayerTwo  Player = 2
+)
+
+// Opponent returns the other player.
+func (p Player) Opponent() Player {
+	switch p {
+	case PlayerOne:
+		return PlayerTwo
+	case PlayerTwo:
+		return PlayerOne
+	default:
+		return PlayerNone
+	}
+}
+
+// Outcome is the result of a game.
+type Outcome struct {
+	// Done is set once the game is over.
+	Done bool `json:"done"`
+	// Winner is the player who won the game, PlayerNone if the game is not done yet
+	// or ended in a draw.
+	Winner Player `json:"winner"`
+}
+
+var (
+	// ErrInvalidMove is returned by Game.Play for keys that do not describe a move of the game.
+	ErrInvalidMove = errors.New("invalid move")
+	// ErrIllegalMove is returned by Game.Play for a move that the rules do not allow
+	// in the current state, e.g. because the field is already taken.
+	ErrIllegalMove = errors.New("illegal move")
+)
+
+// Game is the engine of a turn based game between two players.
+// Moves are the keys a caller enters on their phone, e.g. "5" for the center field
+// of Tic-Tac-Toe, so the game decides how they are entered and what they mean.
+//
+// A game is not concurrency safe.
+type Game interface {
+	// Turn returns the player who makes the next move.
+	Turn() Player
+	// Moves returns all legal moves of the player whose turn it is.
+	Moves() []string
+	// Play makes the move for the player whose turn it is.
+	// It returns an error that wraps ErrInvalidMove or ErrIllegalMove if the move is not possible.
+	Play(move string) error
+	// Outcome returns the outcome of the game.
+	Outcome() Outcome
+	// State returns the state of the game as it is shown on the website.
+	// It must be serializable as JSON.
+	State() any
+	// Input returns how the keys of a single move are entered.
+	Input() InputSpec
+}
+
+// fieldGame is implemented by games whose board can be announced field by field.
+type fieldGame interface {
+	// Fields returns the fields that are announced when the player asks for the board.
+	Fields() []field
+}
+
+// field is a single field of a board.
+type field struct {
+	// Move is the move that selects the field.
+	Move  string
+	Owner Player
+	// Marked is set for taken fields that belong to neither player,
+	// e.g. the X that both players place in Notakto.
+	Marked bool
+}
+
+// variantGame is implemented by games that can be played with different rules.
+type variantGame interface {
+	// Variant returns the variant of the rules, empty for the standard rules.
+	Variant() string
+}
+
+// hiddenGame is implemented by games in which the players must not see the whole
+// state, e.g. the ships of their opponent.
+type hiddenGame interface {
+	// View returns the state of the game as it is shown to the given player.
+	// It replaces State for the players and must be serializable as JSON.
+	View(player Player) any
+}
+
+// setupGame is implemented by games in which each player secretly prepares their
+// board on the website before the first move, e.g. by placing their ships.
+type setupGame interface {
+	// Setup applies the setup the player sent from the website. Without data the
+	// game makes a random setup for the player, e.g. because they ran out of time.
+	// It returns an error that can be shown to the player if the setup is not possible.
+	Setup(player Player, data json.RawMessage) error
+	// SetupDone returns whether the player has finished their setup.
+	SetupDone(player Player) bool
+}
+
+// resultGame is implemented by games whose moves have a result that is announced
+// to both players, e.g. whether a shot hit a ship.
+type resultGame interface {
+	// LastResult returns the result of the latest move.
+	LastResult() string
+}
+
+// skipGame is implemented by games in which a player can lose their turn,
+// e.g. because they ran out of time.
+type skipGame interface {
+	// Skip gives the turn to the opponent without making a move.
+	Skip()
+}
+
+// undoGame is implemented by games whose moves can be taken back.
+type undoGame interface {
+	// Undo takes back the latest move or skipped turn, so that it is the turn of
+	// the player who made it again. It returns false if nothing was played yet.
+	Undo() bool
+}
+
+// cloneGame is implemented by games that can be copied, so that the computer
+// opponent can look ahead. Games with hidden information do not implement it,
+// because a copy reveals what the computer must not know.
+type cloneGame interface {
+	// Clone returns a copy of the game that does not share any state with it.
+	Clone() Game
+}
+
+// gridState is the state of games that are played on a grid of fields,
+// which the website renders without knowing the rules of the game.
+type gridState struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+	// Fields are the owners of all fields, row by row.
+	Fields []Player `json:"fields"`
+	// Labels are the moves that select each field, if they are not numbered from 1.
+	Labels []string `json:"labels,omitempty"`
+}
+
+// NewGameFunc returns a game in its initial state.
+type NewGameFunc func() Game
+
+// GameTicTacToe is the name of the classic game, which is played if the player does not choose a game.
+const GameTicTacToe = "tic-tac-toe"
+
+var (
+	gameTypes = map[string]NewGameFunc{
+		GameTicTacToe:         func() Game { return new(ticTacToe) },
+		GameUltimateTicTacToe: newUltimateTicTacToe,
+		GameConnectFour:       newConnectFour,
+		GameGomoku:            NewMNKGame(15, 15, 5),
+		GameMisereTicTacToe:   func() Game { return &ticTacToe{variant: variantMisere} },
+		GameNotakto:           newNotakto,
+		GameQuantumTicTacToe:  newQuantumTicTacToe,
+		GameBattleship:        newBattleship,
+	}
+	gameTypesMu sync.RWMutex
+)
+
+// RegisterGame makes a game available under the given name, which players choose when
+// they open the website. Players are only matched with players that chose the same game.
+// Registering an existing name replaces the game.
+func RegisterGame(name string, newGame NewGameFunc) {
+	gameTypesMu.Lock()
+	defer gameTypesMu.Unlock()
+	gameTypes[name] = newGame
+}
+
+// GameTypes returns the names of all registered games in alphabetical order.
+func GameTypes() []string {
+	gameTypesMu.RLock()
+	defer gameTypesMu.RUnlock()
+
+	names := make([]string, 0, len(gameTypes))
+	for name := range gameTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newGame returns a new game of the registered game type.
+func newGame(name string) (Game, error) {
+	gameTypesMu.RLock()
+	defer gameTypesMu.RUnlock()
+
+	newGame, ok := gameTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown game %q", name)
+	}
+	return newGame(), nil
+}
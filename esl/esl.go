@@ -0,0 +1,335 @@
+// Package esl implements the outbound mode of the FreeSWITCH Event Socket Library
+// (ESL), in which FreeSWITCH connects to us for each call that the dialplan sends
+// to the `socket` application.
+package esl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned for commands that could not complete because
+// the connection to FreeSWITCH was closed.
+var ErrClosed = errors.New("esl connection closed")
+
+// Content types of the messages that FreeSWITCH sends.
+const (
+	contentTypeCommandReply     = "command/reply"
+	contentTypeAPIResponse      = "api/response"
+	contentTypeEventPlain       = "text/event-plain"
+	contentTypeDisconnectNotice = "text/disconnect-notice"
+)
+
+// Names of the events that are used by this project.
+const (
+	EventDTMF                   = "DTMF"
+	EventChannelHangup          = "CHANNEL_HANGUP"
+	EventChannelExecuteComplete = "CHANNEL_EXECUTE_COMPLETE"
+)
+
+// Message is a single ESL message or event, consisting of its headers.
+// Values are already URL decoded.
+type Message map[string]string
+
+// Get returns the value of the given key, ignoring the case of the key.
+func (m Message) Get(key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Event is a message that FreeSWITCH sends on its own, e.g. when a DTMF key was pressed.
+type Event Message
+
+// Name returns the name of the event, e.g. `DTMF`.
+func (e Event) Name() string {
+	return Message(e).Get("Event-Name")
+}
+
+// Get returns the value of the given key, ignoring the case of the key.
+func (e Event) Get(key string) string {
+	return Message(e).Get(key)
+}
+
+// CommandError is returned when FreeSWITCH replies to a command with an error.
+type CommandError struct {
+	Command string
+	Reply   string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("esl command %s failed: %s", e.Command, e.Reply)
+}
+
+// reply is the response to a command, including the body of api responses.
+type reply struct {
+	msg  Message
+	body string
+}
+
+// Conn is an outbound event socket connection for a single call.
+// Each method is concurrency safe.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// Commands are answered in the order they were sent, so only a single
+	// command is in flight at any time.
+	commandMu sync.Mutex
+	replies   chan reply
+
+	channelData Message
+	events      chan Event
+
+	done    chan struct{}
+	readErr error
+}
+
+// NewConn sends the `connect` command over a connection that FreeSWITCH established
+// and reads the data of the channel. It then starts receiving messages.
+func NewConn(conn net.Conn) (*Conn, error) {
+	c := &Conn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		replies: make(chan reply, 1),
+		events:  make(chan Event, 256),
+		done:    make(chan struct{}),
+	}
+
+	if _, err := io.WriteString(conn, "connect\n\n"); err != nil {
+		return nil, fmt.Errorf("send esl connect: %w", err)
+	}
+	data, _, err := c.readMessage()
+	if err != nil {
+		return nil, fmt.Errorf("read esl channel data: %w", err)
+	}
+	c.channelData = data
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+// ChannelData returns the variables of the channel that were sent on connect,
+// e.g. `Unique-ID` and `Caller-Caller-ID-Number`.
+func (c *Conn) ChannelData() Message {
+	return c.channelData
+}
+
+// Command sends the command and waits for its reply.
+// If FreeSWITCH replies with an error, the returned error is of type *CommandError.
+func (c *Conn) Command(ctx context.Context, command string) (Message, error) {
+	r, err := c.command(ctx, command)
+	return r.msg, err
+}
+
+// API runs the api command and returns its output.
+func (c *Conn) API(ctx context.Context, command string) (string, error) {
+	r, err := c.command(ctx, "api "+command)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(r.body, "-ERR") {
+		return r.body, &CommandError{Command: "api " + command, Reply: strings.TrimSpace(r.body)}
+	}
+	return r.body, nil
+}
+
+// MyEvents subscribes to all events of the channel in plain format
+// and keeps the connection open after the channel hung up, so that its
+// final events are still received.
+func (c *Conn) MyEvents(ctx context.Context) error {
+	if _, err := c.Command(ctx, "myevents plain"); err != nil {
+		return err
+	}
+	_, err := c.Command(ctx, "linger")
+	return err
+}
+
+// Execute queues the dialplan application with the given argument on the channel,
+// e.g. `playback` to play a sound file.
+func (c *Conn) Execute(ctx context.Context, app, arg string) error {
+	var sb strings.Builder
+	sb.WriteString("sendmsg\n")
+	sb.WriteString("call-command: execute\n")
+	fmt.Fprintf(&sb, "execute-app-name: %s\n", app)
+	if arg != "" {
+		fmt.Fprintf(&sb, "execute-app-arg: %s\n", arg)
+	}
+	_, err := c.Command(ctx, sb.String())
+	return err
+}
+
+// Hangup hangs up the channel with the given cause, e.g. `NORMAL_CLEARING`.
+func (c *Conn) Hangup(ctx context.Context, cause string) error {
+	_, err := c.Command(ctx, "sendmsg\ncall-command: hangup\nhangup-cause: "+cause+"\n")
+	return err
+}
+
+// Events returns the channel receiving all subscribed events.
+// It is closed when the connection is lost.
+func (c *Conn) Events() <-chan Event {
+	return c.events
+}
+
+// Done returns a channel that is closed when the connection to FreeSWITCH is lost.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason why the connection was lost, once Done is closed.
+func (c *Conn) Err() error {
+	<-c.done
+	return c.readErr
+}
+
+// Close closes the connection to FreeSWITCH.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) command(ctx context.Context, command string) (reply, error) {
+	c.commandMu.Lock()
+	defer c.commandMu.Unlock()
+
+	name, _, _ := strings.Cut(command, "\n")
+
+	select {
+	case <-c.done:
+		return reply{}, fmt.Errorf("esl command %s: %w", name, ErrClosed)
+	default:
+	}
+
+	if _, err := io.WriteString(c.conn, strings.TrimRight(command, "\n")+"\n\n"); err != nil {
+		return reply{}, fmt.Errorf("send esl command %s: %w", name, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		// The reply would be mistaken for the reply of the next command.
+		_ = c.conn.Close()
+		return reply{}, ctx.Err()
+	case <-c.done:
+		return reply{}, fmt.Errorf("esl command %s: %w", name, ErrClosed)
+	case r := <-c.replies:
+		if text := r.msg.Get("Reply-Text"); strings.HasPrefix(text, "-ERR") {
+			return r, &CommandError{Command: name, Reply: text}
+		}
+		return r, nil
+	}
+}
+
+// readLoop reads all incoming messages and routes them to the waiting command
+// or the events channel.
+func (c *Conn) readLoop() {
+	defer close(c.events)
+	defer close(c.done)
+
+	for {
+		msg, body, err := c.readMessage()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+
+		switch msg.Get("Content-Type") {
+		case contentTypeCommandReply, contentTypeAPIResponse:
+			select {
+			case c.replies <- reply{msg: msg, body: body}:
+			default:
+				// Nobody is waiting anymore, the command was cancelled.
+			}
+		case contentTypeEventPlain:
+			event, err := parseHeaders(body)
+			if err != nil {
+				continue
+			}
+			select {
+			case c.events <- Event(event):
+			default:
+				// Drop events instead of blocking replies if nobody reads them.
+			}
+		case contentTypeDisconnectNotice:
+			c.readErr = fmt.Errorf("read esl message: %w", ErrClosed)
+			return
+		}
+	}
+}
+
+// readMessage reads the headers of a message, which are terminated by an empty line,
+// and its body if it has a Content-Length.
+func (c *Conn) readMessage() (Message, string, error) {
+	var head strings.Builder
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, "", fmt.Errorf("read esl message: %w", err)
+		}
+		if strings.TrimRight(line, "\r\n") == "" {
+			if head.Len() == 0 {
+				// Tolerate superfluous empty lines between messages.
+				continue
+			}
+			break
+		}
+		head.WriteString(line)
+	}
+
+	msg, err := parseHeaders(head.String())
+	if err != nil {
+		return nil, "", err
+	}
+
+	length := msg.Get("Content-Length")
+	if length == "" {
+		return msg, "", nil
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 0 {
+		return nil, "", fmt.Errorf("invalid esl Content-Length %q", length)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, "", fmt.Errorf("read esl message body: %w", err)
+	}
+	return msg, string(body), nil
+}
+
+// parseHeaders parses `Key: Value` lines with URL encoded values.
+// Parsing stops at the first empty line.
+func parseHeaders(s string) (Message, error) {
+	msg := Message{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			if len(msg) == 0 {
+				continue
+			}
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed esl header %q", line)
+		}
+		value = strings.TrimSpace(value)
+		if decoded, err := url.PathUnescape(value); err == nil {
+			value = decoded
+		}
+		msg[strings.TrimSpace(key)] = value
+	}
+	return msg, nil
+}
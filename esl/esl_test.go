@@ -0,0 +1,223 @@
+package esl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeFreeSWITCH is the FreeSWITCH side of an outbound event socket connection.
+type fakeFreeSWITCH struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialFreeSWITCH connects to the event socket server like FreeSWITCH does for a new call.
+func dialFreeSWITCH(t *testing.T, addr string) *fakeFreeSWITCH {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &fakeFreeSWITCH{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// readCommand reads the next command, which is terminated by an empty line.
+func (f *fakeFreeSWITCH) readCommand() string {
+	f.t.Helper()
+	_ = f.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var lines []string
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err != nil {
+			f.t.Fatalf("read command: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
+
+// expect reads the next command and fails if it is not the given one.
+func (f *fakeFreeSWITCH) expect(command string) {
+	f.t.Helper()
+	if got := f.readCommand(); got != command {
+		f.t.Fatalf("got command %q, want %q", got, command)
+	}
+}
+
+func (f *fakeFreeSWITCH) write(s string) {
+	f.t.Helper()
+	if _, err := f.conn.Write([]byte(s)); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// reply answers the last command with the given reply text.
+func (f *fakeFreeSWITCH) reply(text string) {
+	f.t.Helper()
+	f.write("Content-Type: command/reply\nReply-Text: " + text + "\n\n")
+}
+
+// apiResponse answers the last api command with the given output.
+func (f *fakeFreeSWITCH) apiResponse(body string) {
+	f.t.Helper()
+	f.write(fmt.Sprintf("Content-Type: api/response\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+// event sends a plain event with the given URL encoded headers.
+func (f *fakeFreeSWITCH) event(headers ...string) {
+	f.t.Helper()
+	body := strings.Join(headers, "\n") + "\n\n"
+	f.write(fmt.Sprintf("Content-Type: text/event-plain\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+// connect answers the connect command with the data of the channel.
+func (f *fakeFreeSWITCH) connect() {
+	f.t.Helper()
+	f.expect("connect")
+	f.write("Content-Type: command/reply\nReply-Text: +OK\n" +
+		"Unique-ID: 1234\nChannel-Name: sofia/internal/100%40127.0.0.1\nCaller-Caller-ID-Number: 100\n\n")
+}
+
+// serve starts the event socket server and returns the connection of the first call.
+func serve(t *testing.T) (addr string, conns <-chan *Conn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *Conn, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = Serve(ctx, listener, func(ctx context.Context, conn *Conn) {
+			ch <- conn
+			<-conn.Done()
+		}, zerolog.Nop())
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return listener.Addr().String(), ch
+}
+
+func acceptConn(t *testing.T, conns <-chan *Conn) *Conn {
+	t.Helper()
+	select {
+	case conn := <-conns:
+		return conn
+	case <-time.After(time.Second * 5):
+		t.Fatal("handler was not called")
+		return nil
+	}
+}
+
+func TestConnCommands(t *testing.T) {
+	addr, conns := serve(t)
+	fs := dialFreeSWITCH(t, addr)
+	fs.connect()
+	conn := acceptConn(t, conns)
+
+	data := conn.ChannelData()
+	if data.Get("unique-id") != "1234" || data.Get("Channel-Name") != "sofia/internal/100@127.0.0.1" {
+		t.Fatalf("got channel data %v", data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	errs := make(chan error, 1)
+
+	go func() { errs <- conn.MyEvents(ctx) }()
+	fs.expect("myevents plain")
+	fs.reply("+OK Events Enabled")
+	fs.expect("linger")
+	fs.reply("+OK will linger")
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { errs <- conn.Execute(ctx, "playback", "enter_code.wav") }()
+	fs.expect("sendmsg\ncall-command: execute\nexecute-app-name: playback\nexecute-app-arg: enter_code.wav")
+	fs.reply("+OK")
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { errs <- conn.Hangup(ctx, "NORMAL_CLEARING") }()
+	fs.expect("sendmsg\ncall-command: hangup\nhangup-cause: NORMAL_CLEARING")
+	fs.reply("-ERR no reply")
+	var cerr *CommandError
+	if err := <-errs; !errors.As(err, &cerr) || cerr.Command != "sendmsg" {
+		t.Fatalf("got error %v, want command error", err)
+	}
+
+	output := make(chan string, 1)
+	go func() {
+		out, err := conn.API(ctx, "uuid_audio_fork 1234 stop")
+		output <- out
+		errs <- err
+	}()
+	fs.expect("api uuid_audio_fork 1234 stop")
+	// Events may arrive while waiting for a reply.
+	fs.event("Event-Name: HEARTBEAT")
+	fs.apiResponse("+OK Success\n")
+	if out := <-output; out != "+OK Success\n" {
+		t.Fatalf("got api output %q", out)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, err := conn.API(ctx, "uuid_audio_fork 1234 start")
+		errs <- err
+	}()
+	fs.readCommand()
+	fs.apiResponse("-ERR no such channel\n")
+	if err := <-errs; !errors.As(err, &cerr) || cerr.Reply != "-ERR no such channel" {
+		t.Fatalf("got error %v, want command error", err)
+	}
+}
+
+func TestConnEvents(t *testing.T) {
+	addr, conns := serve(t)
+	fs := dialFreeSWITCH(t, addr)
+	fs.connect()
+	conn := acceptConn(t, conns)
+
+	fs.event("Event-Name: DTMF", "DTMF-Digit: 5", "Unique-ID: 1234")
+	fs.event("Event-Name: DTMF", "DTMF-Digit: %23", "Unique-ID: 1234")
+	fs.event("Event-Name: CHANNEL_HANGUP", "Hangup-Cause: NORMAL_CLEARING")
+	fs.write("Content-Type: text/disconnect-notice\nContent-Length: 0\n\n")
+
+	var got []string
+	for event := range conn.Events() {
+		got = append(got, event.Name()+" "+event.Get("DTMF-Digit")+event.Get("hangup-cause"))
+	}
+	want := []string{"DTMF 5", "DTMF #", "CHANNEL_HANGUP NORMAL_CLEARING"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got events %q, want %q", got, want)
+	}
+	if err := conn.Err(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got error %v, want %v", err, ErrClosed)
+	}
+
+	// Commands fail once FreeSWITCH disconnected.
+	if _, err := conn.Command(context.Background(), "linger"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got error %v, want %v", err, ErrClosed)
+	}
+}
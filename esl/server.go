@@ -0,0 +1,59 @@
+package esl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Handler handles a single call that FreeSWITCH connected to the server.
+// The connection is closed as soon as the handler returns.
+type Handler func(ctx context.Context, conn *Conn)
+
+// Serve accepts outbound event socket connections from FreeSWITCH on the given
+// listener and handles each call in its own goroutine.
+// It blocks until the context is cancelled, then closes the listener and waits
+// for all running handlers to return.
+func Serve(ctx context.Context, listener net.Listener, handler Handler, log zerolog.Logger) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	l := log.With().Str("esl_addr", listener.Addr().String()).Logger()
+	l.Info().Msg("Start event socket server")
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				l.Info().Msg("Stopped event socket server")
+				return nil
+			}
+			return fmt.Errorf("accept event socket connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer netConn.Close()
+
+			cl := l.With().Str("freeswitch_addr", netConn.RemoteAddr().String()).Logger()
+
+			conn, err := NewConn(netConn)
+			if err != nil {
+				cl.Err(err).Msg("Failed to connect to channel")
+				return
+			}
+
+			handler(ctx, conn)
+		}()
+	}
+}
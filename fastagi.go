@@ -0,0 +1,71 @@
+package voipttt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// FastAGIDefaultAddr is the address asterisk connects to when the dialplan
+// uses an `agi://host` URL without a port.
+const FastAGIDefaultAddr = ":4573"
+
+// FastAGIHandler handles a single call that asterisk forwarded to the FastAGI server.
+// The AGI variables have already been read when the handler is called.
+// The connection to asterisk is closed as soon as the handler returns.
+type FastAGIHandler func(ctx context.Context, agi *AGI)
+
+// ServeFastAGI accepts FastAGI connections from asterisk on the given listener
+// and handles each call in its own goroutine.
+// It blocks until the context is cancelled, then closes the listener and waits
+// for all running handlers to return.
+func ServeFastAGI(ctx context.Context, listener net.Listener, handler FastAGIHandler) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	l := log.With().Str("fastagi_addr", listener.Addr().String()).Logger()
+	l.Info().Msg("Start FastAGI server")
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				l.Info().Msg("Stopped FastAGI server")
+				return nil
+			}
+			return fmt.Errorf("accept FastAGI connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			cl := l.With().Str("asterisk_addr", conn.RemoteAddr().String()).Logger()
+			agi := NewAGIConn(conn, cl)
+
+			if err := agi.ReadVariables(); err != nil {
+				cl.Err(err).Msg("Failed to read AGI variables of FastAGI connection")
+				return
+			}
+
+			cl.Info().
+				Str("channel", agi.Get("agi_channel")).
+				Str("caller_id", agi.Get("agi_callerid")).
+				Msg("Handle FastAGI call")
+
+			handler(ctx, agi)
+
+			cl.Info().Msg("Finished FastAGI call")
+		}()
+	}
+}
@@ -0,0 +1,74 @@
+package voipttt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServeFastAGI(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type call struct {
+		channel string
+		err     error
+	}
+	calls := make(chan call, 1)
+	handler := func(ctx context.Context, agi *AGI) {
+		calls <- call{channel: agi.Get("agi_channel"), err: agi.Answer()}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeFastAGI(ctx, listener, handler)
+	}()
+
+	// Asterisk sends the AGI variables, then waits for the commands of the session.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 5))
+	fmt.Fprint(conn, "agi_network: yes\nagi_channel: PJSIP/100-00000001\nagi_callerid: 100\n\n")
+
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != "ANSWER\n" {
+		t.Fatalf("got command %q, want ANSWER", command)
+	}
+	fmt.Fprint(conn, "200 result=0\n")
+
+	got := <-calls
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if got.channel != "PJSIP/100-00000001" {
+		t.Fatalf("got channel %q", got.channel)
+	}
+	// The connection is closed once the handler returns.
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("got %v, want the connection to be closed", err)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("server did not stop after the context was cancelled")
+	}
+}
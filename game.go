@@ -1,165 +1,915 @@
 package voipttt
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"math/rand"
-	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/audio"
 )
 
+// announceTimeout is the time a call has to play an announcement to the caller.
+const announceTimeout = time.Minute
+
+// setupTimeout is the time players have to prepare their boards on the website,
+// before the game makes a random setup for them.
+const setupTimeout = 3 * time.Minute
+
+// answerTimeout is the time a player has to answer a request of the opponent,
+// e.g. a draw offer, before it is declined.
+const answerTimeout = 30 * time.Second
+
+// answerInputSpec collects the answer to a request of the opponent, a single key.
+var answerInputSpec = InputSpec{
+	InterDigitTimeout: answerTimeout,
+	MinLength:         1,
+	MaxLength:         1,
+	Terminator:        '#',
+}
+
 // game represents an ongoing game between two clients.
 type game struct {
-	playerOne *webSocketClient
-	playerTwo *webSocketClient
-	log       zerolog.Logger
-}
-
-// sendOpponentReadyMessage notifies the given web socket, that
-// it's opponent is ready and the game can transition to the playing state.
-func (g *game) sendOpponentReadyMessage(
-	client *webSocketClient,
-	opponentPhoneNumber PhoneNumber,
-	hasFirstTurn bool,
-) bool {
-	if err := client.sendOpponentReady(opponentPhoneNumber, hasFirstTurn); err != nil {
-		// log.Printf(
-		// 	"Failed to notify client %s that opponent is ready: %v\n",
-		// 	client.conn.RemoteAddr(),
-		// 	err,
-		// )
-		return false
+	playerOne   *webSocketClient // The client playing as PlayerOne.
+	playerTwo   *webSocketClient // The client playing as PlayerTwo.
+	game        Game
+	clock       *moveClock // Nil if the time of the players is not limited.
+	invalidMove InvalidMoveConfig
+	series      *series // Nil if only a single game is played.
+	// movers are the players who made each move or skipped their turn.
+	movers []Player
+	log    zerolog.Logger
+}
+
+// clientMessage is a message sent by a client.
+type clientMessage struct {
+	client *webSocketClient
+	webSocketRequest
+}
+
+// newGameSession returns a game between the two clients, who are randomly
+// assigned to the players of the game.
+func newGameSession(first, second *webSocketClient, rules Game, log zerolog.Logger) *game {
+	if rand.Intn(2) == 1 {
+		first, second = second, first
+	}
+	return &game{
+		playerOne:   first,
+		playerTwo:   second,
+		game:        rules,
+		invalidMove: defaultInvalidMoveConfig,
+		log:         log,
+	}
+}
+
+// client returns the client that plays as the given player.
+func (g *game) client(player Player) *webSocketClient {
+	if player == PlayerOne {
+		return g.playerOne
+	}
+	return g.playerTwo
+}
+
+// player returns the player the client plays as.
+func (g *game) player(client *webSocketClient) Player {
+	if client == g.playerOne {
+		return PlayerOne
+	}
+	return PlayerTwo
+}
+
+// state returns the state of the game as it is shown to the given player.
+func (g *game) state(player Player) any {
+	if hg, ok := g.game.(hiddenGame); ok {
+		return hg.View(player)
+	}
+	return g.game.State()
+}
+
+// sendOpponentReadyMessages notifies the clients of both players, that their
+// opponent is ready and the game can transition to the playing state.
+func (g *game) sendOpponentReadyMessages() bool {
+	data := map[Player]*dataOpponentReady{}
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		if data[player] = g.sendOpponentReadyMessage(player); data[player] == nil {
+			return false
+		}
+	}
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageOpponentReady), func(player Player) any {
+		return data[player]
+	})
+	return true
+}
+
+// sendOpponentReadyMessage notifies the client of the given player, that it's opponent
+// is ready. It returns the sent data, which is nil if the client could not be notified.
+func (g *game) sendOpponentReadyMessage(player Player) *dataOpponentReady {
+	client := g.client(player)
+	opponent := g.client(player.Opponent())
+	opponentPhoneNumber := opponent.phoneNumber.Anonymized()
+	if opponent.isBot() {
+		opponentPhoneNumber = AnonymizedPhoneNumber(opponent.phoneNumber)
+	}
+	data := &dataOpponentReady{
+		OpponentPhoneNumber: opponentPhoneNumber,
+		PlayerHasFirstTurn:  g.game.Turn() == player,
+		Game:                client.gameType,
+		Player:              player,
+		State:               g.state(player),
+	}
+	if vg, ok := g.game.(variantGame); ok {
+		data.Variant = vg.Variant()
+	}
+	if _, ok := g.game.(setupGame); ok {
+		data.NeedsSetup = true
+	}
+	data.Series = g.series.data(client, opponent)
+	if err := client.sendOpponentReady(data); err != nil {
+		client.log.Err(err).Msg("Failed to notify client that opponent is ready")
+		return nil
+	}
+	return data
+}
+
+// sendTurnInfo sends information about the latest move of mover to the clients of both players.
+// timeUp determines whether the move was made for mover because they ran out of time.
+func (g *game) sendTurnInfo(mover Player, move string, timeUp bool) bool {
+	data := map[Player]*dataTurnInfo{}
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		if data[player] = g.sendTurnInfoTo(player, mover, move, timeUp); data[player] == nil {
+			return false
+		}
 	}
+	done := g.game.Outcome().Done
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageTurnInfo), func(player Player) any {
+		return &dataAnnounceTurnInfo{dataTurnInfo: *data[player], IsGameDone: done}
+	})
 	return true
 }
 
-// sendTurnInfo sends information about the latest turn to the given client.
-// isPlayer determines whether the client is the one who executed the turn.
-func (g *game) sendTurnInfo(client *webSocketClient, selectedDigit int, isPlayer bool) bool {
-	if err := client.sendTurnInfo(selectedDigit, isPlayer); err != nil {
+// sendTurnInfoTo sends the latest move to the client of the given player. It returns the
+// sent data, which is nil if the client could not be notified.
+func (g *game) sendTurnInfoTo(player, mover Player, move string, timeUp bool) *dataTurnInfo {
+	client := g.client(player)
+	data := dataTurnInfo{
+		Move:     move,
+		IsPlayer: player == mover,
+		TimeUp:   timeUp,
+		State:    g.state(player),
+	}
+	// A skipped turn has no result.
+	if rg, ok := g.game.(resultGame); ok && move != "" {
+		data.Result = rg.LastResult()
+	}
+	if err := client.sendTurnInfo(&data); err != nil {
 		client.log.Err(err).Msg("Failed to send turn info")
+		return nil
+	}
+	return &data
+}
+
+// sendBoardState sends the current state of the game to the client of the given player.
+func (g *game) sendBoardState(player Player) bool {
+	client := g.client(player)
+	if err := client.sendBoardState(g.state(player)); err != nil {
+		client.log.Err(err).Msg("Failed to send board state")
 		return false
 	}
 	return true
 }
 
-func (g *game) sendGameDone(client *webSocketClient, hasWinner, isPlayerWinner bool) {
-	if err := client.sendGameDone(hasWinner, isPlayerWinner); err != nil {
-		client.log.Err(err).Msg("Failed to send game done info")
+// sendClock sends the time left to the clients of both players at the start of the player's turn.
+func (g *game) sendClock(player Player) {
+	if g.clock == nil {
+		return
+	}
+	for _, p := range []Player{PlayerOne, PlayerTwo} {
+		client := g.client(p)
+		if err := client.sendClock(g.clock.data(p, player)); err != nil {
+			client.log.Err(err).Msg("Failed to send clock")
+		}
 	}
 }
 
-func (g *game) getDigitFromClient(client *webSocketClient) (int, bool) {
-	l := client.log.With().
-		Str("webhook", string(client.getDigitURL)).
-		Str("http_method", "GET").
-		Logger()
+// end ends the game in favor of the winner, PlayerNone for a draw, and notifies the
+// clients of both players.
+func (g *game) end(winner Player, reason gameDoneReason) {
+	if winner == PlayerNone {
+		g.series.record(nil)
+	} else {
+		g.series.record(g.client(winner))
+	}
 
-	resp, err := http.Get(string(client.getDigitURL))
-	if err != nil {
-		l.Err(err).Msg("Failed HTTP request to get digit from webhook")
-		return 0, false
+	data := map[Player]*dataGameDone{}
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		client := g.client(player)
+		data[player] = &dataGameDone{
+			HasWinner:      winner != PlayerNone,
+			IsPlayerWinner: winner == player,
+			Reason:         reason,
+			Series:         g.series.data(client, g.client(player.Opponent())),
+		}
+		if err := client.sendGameDone(data[player]); err != nil {
+			client.log.Err(err).Msg("Failed to send game done info")
+		}
 	}
-	defer resp.Body.Close()
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageGameDone), func(player Player) any {
+		return data[player]
+	})
+}
 
-	var data ReceiveDigitRequest
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		l.Err(err).Msg("Failed to decode JSON response from webhook")
-		return 0, false
+// announceBoard announces the owner of each field to the client of the given player,
+// if the board of the game consists of fields.
+func (g *game) announceBoard(player Player) {
+	client := g.client(player)
+	fg, ok := g.game.(fieldGame)
+	if !ok {
+		client.log.Info().Msg("Board of the game can not be announced")
+		return
 	}
 
-	return data.Digit, true
+	var data dataAnnounceBoard
+	for _, f := range fg.Fields() {
+		field := dataAnnounceField{Move: f.Move}
+		switch {
+		case f.Marked:
+			field.Owner = boardFieldMarked
+		case f.Owner == PlayerNone:
+			field.Owner = boardFieldEmpty
+		case f.Owner == player:
+			field.Owner = boardFieldPlayer
+		default:
+			field.Owner = boardFieldOpponent
+		}
+		data.Fields = append(data.Fields, field)
+	}
+	g.announce(client, announceBoard, &data)
+}
+
+// announce notifies the call of the given client about an event of the game.
+// Failures are only logged, because the same information is shown on the website.
+func (g *game) announce(client *webSocketClient, announcementType string, data any) {
+	if client.hasHungUp() {
+		return
+	}
+
+	// Not bound to the game's context, so that the end of the game can still
+	// be announced after the opponent hung up.
+	ctx, cancel := context.WithTimeout(context.Background(), announceTimeout)
+	defer cancel()
+
+	if err := client.call.Announce(ctx, Announcement{Type: announcementType, Data: data}); err != nil {
+		client.log.Err(err).Str("announcement", announcementType).Msg("Failed to announce event to caller")
+	}
+}
+
+// announceEach announces the event to the calls of the given players at the same time,
+// so that no caller waits for the prompts of another. data returns the data of the
+// announcement for each player. It returns once all announcements are done.
+func (g *game) announceEach(players []Player, announcementType string, data func(player Player) any) {
+	var wg sync.WaitGroup
+	for _, player := range players {
+		player := player
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.announce(g.client(player), announcementType, data(player))
+		}()
+	}
+	wg.Wait()
+}
+
+// getMoveFromClient reads the next move from the call of the given client.
+func (g *game) getMoveFromClient(ctx context.Context, client *webSocketClient) (string, error) {
+	move, err := client.call.ReadMove(ctx, g.game.Input())
+	if err != nil {
+		client.log.Err(err).Msg("Failed to read move from call")
+		return "", err
+	}
+	return move, nil
 }
 
-func (g *game) callGameDoneWebHook() {
+// playRandomMove makes a random legal move for the player whose turn it is.
+func (g *game) playRandomMove() string {
+	moves := g.game.Moves()
+	move := moves[rand.Intn(len(moves))]
+	if err := g.game.Play(move); err != nil {
+		// Moves only returns legal moves.
+		panic(err)
+	}
+	return move
+}
+
+// hangupCalls notifies the calls of both clients that the game is done.
+func (g *game) hangupCalls() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
 	send := func(client *webSocketClient) {
-		if _, err := http.Get(string(client.gameDoneURL)); err != nil {
-			client.log.Err(err).
-				Str("webhook", string(client.gameDoneURL)).
-				Str("http_method", "GET").
-				Msg("Failed HTTP request to game done webhook")
+		if err := client.call.Hangup(ctx); err != nil {
+			client.log.Err(err).Msg("Failed to hang up call")
 		}
 	}
 	send(g.playerOne)
 	send(g.playerTwo)
 }
 
-// runGame runs the game between the two web socket clients.
-func (g *game) run() {
+// endOnHangup returns a context that is cancelled as soon as one of the players hangs up.
+func (g *game) endOnHangup(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	// The players switch sides between the games of a series, see next.
+	doneOne, doneTwo := g.playerOne.call.Done(), g.playerTwo.call.Done()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-doneOne:
+			cancel()
+		case <-doneTwo:
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// timeUp applies the policy of the clock after the player ran out of time.
+// It returns false if the game ended.
+func (g *game) timeUp(player Player) bool {
+	policy := g.clock.config.OnTimeUp
+	g.log.Info().
+		Str("current_turn_addr", g.client(player).remoteAddr()).
+		Str("policy", string(policy)).
+		Msg("Client ran out of time")
+
+	switch sg, canSkip := g.game.(skipGame); {
+	case policy == TimeUpForfeit:
+		g.end(player.Opponent(), gameDoneTimeout)
+		return false
+	case policy == TimeUpSkipTurn && canSkip:
+		sg.Skip()
+		g.movers = append(g.movers, player)
+		return g.sendTurnInfo(player, "", true)
+	default:
+		move := g.playRandomMove()
+		g.movers = append(g.movers, player)
+		return g.sendTurnInfo(player, move, true)
+	}
+}
+
+// rejectMove tells the player why their move is not possible and returns what
+// happens next, depending on the number of invalid moves in the current turn.
+// The game is already done if the player forfeits.
+func (g *game) rejectMove(player Player, move string, err error, invalidMoves int) InvalidMovePolicy {
+	client := g.client(player)
+	data := &dataInvalidMove{
+		Move:   move,
+		Reason: err.Error(),
+		Action: g.invalidMove.action(invalidMoves),
+	}
+	client.log.Info().Err(err).Str("move", move).Str("action", string(data.Action)).Msg("Rejected invalid move")
+
+	if err := client.sendInvalidMove(data); err != nil {
+		client.log.Err(err).Msg("Failed to send invalid move")
+	}
+	g.announce(client, string(messageInvalidMove), data)
+
+	if data.Action == InvalidMoveForfeit {
+		g.end(player.Opponent(), gameDoneInvalidMove)
+	}
+	return data.Action
+}
+
+// resign ends the game in favor of the opponent of the player.
+func (g *game) resign(player Player) {
+	g.log.Info().Str("current_turn_addr", g.client(player).remoteAddr()).Msg("Client resigned")
+	g.end(player.Opponent(), gameDoneResign)
+}
+
+// offerDraw asks the opponent of the player whether they agree to a draw.
+// It returns true if they agree, in which case the game is done.
+func (g *game) offerDraw(ctx context.Context, player Player, messages <-chan clientMessage) bool {
+	for _, p := range []Player{PlayerOne, PlayerTwo} {
+		client := g.client(p)
+		if err := client.sendDrawOffered(p == player); err != nil {
+			client.log.Err(err).Msg("Failed to send draw offer")
+		}
+	}
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageDrawOffered), func(p Player) any {
+		return &dataDrawOffer{IsPlayer: p == player}
+	})
+
+	if g.askOpponent(ctx, player, messages, messageDrawAnswer) {
+		g.log.Info().Msg("Clients agreed to a draw")
+		g.end(PlayerNone, gameDoneDrawAgreed)
+		return true
+	}
+
+	if ctx.Err() == nil {
+		for _, p := range []Player{PlayerOne, PlayerTwo} {
+			client := g.client(p)
+			if err := client.sendDrawDeclined(p == player); err != nil {
+				client.log.Err(err).Msg("Failed to send declined draw offer")
+			}
+		}
+		g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageDrawDeclined), func(p Player) any {
+			return &dataDrawOffer{IsPlayer: p == player}
+		})
+	}
+	return false
+}
+
+// takeback asks the opponent of the player whether the latest move of the player may be
+// taken back. If they agree, all moves since then are taken back and it is the turn of
+// the player again.
+func (g *game) takeback(ctx context.Context, player Player, messages <-chan clientMessage) {
+	send := func(messageType webSocketMessage, reason string) {
+		players := []Player{PlayerOne, PlayerTwo}
+		// Only the player learns that a takeback is not possible.
+		if reason != "" {
+			players = []Player{player}
+		}
+		data := map[Player]*dataTakeback{}
+		for _, p := range players {
+			client := g.client(p)
+			data[p] = &dataTakeback{IsPlayer: p == player, Reason: reason}
+			if err := client.sendTakeback(messageType, data[p]); err != nil {
+				client.log.Err(err).Str("data_type", string(messageType)).Msg("Failed to send takeback")
+			}
+		}
+		g.announceEach(players, string(messageType), func(p Player) any {
+			return data[p]
+		})
+	}
+
+	last := -1
+	for i, mover := range g.movers {
+		if mover == player {
+			last = i
+		}
+	}
+	ug, canUndo := g.game.(undoGame)
+	switch {
+	case !canUndo:
+		send(messageTakebackDeclined, "moves of this game can not be taken back")
+		return
+	case last < 0:
+		send(messageTakebackDeclined, "there is no move to take back")
+		return
+	}
+
+	send(messageTakebackRequested, "")
+	if !g.askOpponent(ctx, player, messages, messageTakebackAnswer) {
+		if ctx.Err() == nil {
+			send(messageTakebackDeclined, "")
+		}
+		return
+	}
+
+	for len(g.movers) > last {
+		ug.Undo()
+		g.movers = g.movers[:len(g.movers)-1]
+	}
+	g.log.Info().Int("moves", len(g.movers)).Msg("Clients agreed to take back moves")
+	send(messageTakebackAccepted, "")
+	for _, p := range []Player{PlayerOne, PlayerTwo} {
+		g.sendBoardState(p)
+	}
+}
+
+// askOpponent waits until the opponent of the player answers a request, either with
+// answerAccept or answerDecline on the phone or with the given message on the website.
+// Requests that are not answered in time and requests to bots are declined.
+func (g *game) askOpponent(ctx context.Context, player Player, messages <-chan clientMessage, answer webSocketMessage) bool {
+	opponent := player.Opponent()
+	if g.client(opponent).isBot() {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, answerTimeout)
+	answers, wait := g.readAnswers(ctx, []Player{opponent}, messages, answer)
+	// The call must not be read by the game before the answer was read.
+	defer func() {
+		cancel()
+		wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case answer := <-answers:
+		return answer.accept
+	}
+}
+
+// askRematch asks both players whether they want to play another series against each other.
+// It returns true if both agree. Players who do not answer in time decline.
+func (g *game) askRematch(ctx context.Context, messages <-chan clientMessage) bool {
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		client := g.client(player)
+		if err := client.sendRematchVote(); err != nil {
+			client.log.Err(err).Msg("Failed to send rematch vote")
+		}
+	}
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageRematchVote), func(Player) any {
+		return nil
+	})
+
+	voteCtx, cancel := context.WithTimeout(ctx, answerTimeout)
+	answers, wait := g.readAnswers(voteCtx, []Player{PlayerOne, PlayerTwo}, messages, messageRematchAnswer)
+
+	// Players who did not answer only decline once the time is up.
+	accepted := map[Player]bool{}
+	timeUp := false
+	for declined := false; !declined && !timeUp && len(accepted) < 2; {
+		select {
+		case <-voteCtx.Done():
+			timeUp = true
+
+		case answer := <-answers:
+			accepted[answer.player] = answer.accept
+			declined = !answer.accept
+			for _, player := range []Player{PlayerOne, PlayerTwo} {
+				client := g.client(player)
+				data := &dataRematchAnswer{IsPlayer: player == answer.player, Accept: answer.accept}
+				if err := client.sendRematchAnswered(data); err != nil {
+					client.log.Err(err).Msg("Failed to send rematch answer")
+				}
+			}
+		}
+	}
+	// The calls must not be announced to while their answers are read.
+	cancel()
+	wait()
+
+	if accepted[PlayerOne] && accepted[PlayerTwo] {
+		g.log.Info().Msg("Clients agreed to a rematch")
+		return true
+	}
+	if ctx.Err() == nil {
+		data := map[Player]*dataRematchDeclined{}
+		for _, player := range []Player{PlayerOne, PlayerTwo} {
+			accept, answered := accepted[player]
+			data[player] = &dataRematchDeclined{IsPlayer: answered && !accept || !answered && timeUp}
+			client := g.client(player)
+			if err := client.sendRematchDeclined(data[player].IsPlayer); err != nil {
+				client.log.Err(err).Msg("Failed to send declined rematch")
+			}
+		}
+		g.announceEach([]Player{PlayerOne, PlayerTwo}, string(messageRematchDeclined), func(player Player) any {
+			return data[player]
+		})
+	}
+	return false
+}
+
+// playerAnswer is the answer of a player to a request.
+type playerAnswer struct {
+	player Player
+	accept bool
+}
+
+// readAnswers passes the answers of the given players to a request to the returned channel,
+// until the context is done. Players answer with answerAccept or answerDecline on the phone
+// or with the given message on the website, only their first answer counts.
+// The returned function waits until the calls and messages are no longer read,
+// it must be called after the context is done.
+func (g *game) readAnswers(
+	ctx context.Context,
+	players []Player,
+	messages <-chan clientMessage,
+	answerType webSocketMessage,
+) (<-chan playerAnswer, func()) {
+	// Drop answers to earlier requests that were already answered on the phone.
+	for drained := false; !drained; {
+		select {
+		case <-messages:
+		default:
+			drained = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	keys := make(chan playerAnswer, len(players))
+	pending := map[Player]bool{}
+	for _, player := range players {
+		player := player
+		pending[player] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := g.client(player)
+			key, err := client.call.ReadMove(ctx, answerInputSpec)
+			if err != nil {
+				client.log.Info().Err(err).Msg("Request was not answered on the phone")
+			}
+			keys <- playerAnswer{player: player, accept: key == answerAccept}
+		}()
+	}
+
+	answers := make(chan playerAnswer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for len(pending) > 0 {
+			var answer playerAnswer
+			select {
+			case <-ctx.Done():
+				return
+
+			case answer = <-keys:
+
+			case msg := <-messages:
+				player := g.player(msg.client)
+				if !pending[player] || msg.Type != answerType {
+					msg.client.log.Warn().Str("data_type", string(msg.Type)).Msg("Ignored unexpected message")
+					continue
+				}
+				var data dataAnswer
+				if err := json.Unmarshal(msg.Data, &data); err != nil {
+					msg.client.log.Warn().Err(err).Msg("Ignored malformed answer")
+					continue
+				}
+				answer = playerAnswer{player: player, accept: data.Accept}
+			}
+
+			if !pending[answer.player] {
+				continue
+			}
+			delete(pending, answer.player)
+			g.client(answer.player).log.Info().Bool("accept", answer.accept).Msg("Client answered request")
+
+			select {
+			case <-ctx.Done():
+				return
+			case answers <- answer:
+			}
+		}
+	}()
+	return answers, wg.Wait
+}
+
+// forfeit ends the game in favor of the player that did not hang up.
+// It returns false if no player hung up.
+func (g *game) forfeit() bool {
+	switch {
+	case g.playerOne.hasHungUp():
+		g.log.Info().Msg("Player one hung up and forfeits the game")
+		g.end(PlayerTwo, gameDoneHangup)
+	case g.playerTwo.hasHungUp():
+		g.log.Info().Msg("Player two hung up and forfeits the game")
+		g.end(PlayerOne, gameDoneHangup)
+	default:
+		return false
+	}
+	return true
+}
+
+// runSetup waits until both players have finished the setup of the game on the website.
+// Players who did not finish it in time get a random setup.
+// It returns false if the game ended early.
+func (g *game) runSetup(ctx context.Context, sg setupGame, messages <-chan clientMessage) bool {
+	// Bots do not use the website.
+	for _, player := range []Player{PlayerOne, PlayerTwo} {
+		if g.client(player).isBot() {
+			if err := sg.Setup(player, nil); err != nil {
+				g.client(player).log.Err(err).Msg("Failed to make setup of bot")
+				return false
+			}
+		}
+	}
+
+	timeout := time.NewTimer(setupTimeout)
+	defer timeout.Stop()
+
+	for !sg.SetupDone(PlayerOne) || !sg.SetupDone(PlayerTwo) {
+		select {
+		case <-ctx.Done():
+			return false
+
+		case msg := <-messages:
+			client := msg.client
+			if msg.Type != messageSetup {
+				client.log.Warn().Str("data_type", string(msg.Type)).Msg("Ignored unexpected message during setup")
+				continue
+			}
+			if err := sg.Setup(g.player(client), msg.Data); err != nil {
+				client.log.Info().Err(err).Msg("Rejected setup of client")
+				if err := client.sendSetupRejected(err.Error()); err != nil {
+					client.log.Err(err).Msg("Failed to send setup rejection")
+					return false
+				}
+				continue
+			}
+			client.log.Info().Msg("Client finished setup")
+
+		case <-timeout.C:
+			for _, player := range []Player{PlayerOne, PlayerTwo} {
+				if sg.SetupDone(player) {
+					continue
+				}
+				g.client(player).log.Info().Msg("Client ran out of time for setup, using random setup")
+				if err := sg.Setup(player, nil); err != nil {
+					g.client(player).log.Err(err).Msg("Failed to make random setup")
+					return false
+				}
+			}
+		}
+
+		// Both players see when their opponent is ready.
+		if !g.sendBoardState(PlayerOne) || !g.sendBoardState(PlayerTwo) {
+			return false
+		}
+	}
+
+	turn := g.game.Turn()
+	g.announceEach([]Player{PlayerOne, PlayerTwo}, announceSetupDone, func(player Player) any {
+		return &dataAnnounceSetupDone{PlayerHasFirstTurn: turn == player}
+	})
+	return true
+}
+
+// runGame runs the games between the two web socket clients.
+// The games end early if the context is cancelled or one of the players hangs up.
+func (g *game) run(ctx context.Context) {
 	start := time.Now()
 
-	go g.copyAudioStream(g.playerOne, g.playerTwo)
-	go g.copyAudioStream(g.playerTwo, g.playerOne)
+	ctx, cancel := g.endOnHangup(ctx)
+	defer cancel()
+
+	// The audio stream is missing if the caller hung up before it was connected.
+	if g.playerOne.incomingAudio != nil && g.playerTwo.incomingAudio != nil {
+		go g.copyAudioStream(g.playerOne, g.playerTwo)
+		go g.copyAudioStream(g.playerTwo, g.playerOne)
+	}
 
 	defer func() {
-		g.callGameDoneWebHook()
+		g.announceEach([]Player{PlayerOne, PlayerTwo}, announceGoodbye, func(Player) any {
+			return nil
+		})
+		g.hangupCalls()
 
-		_ = g.playerOne.incomingAudio.Close()
-		_ = g.playerTwo.incomingAudio.Close()
+		if g.playerOne.incomingAudio != nil {
+			_ = g.playerOne.incomingAudio.Close()
+		}
+		if g.playerTwo.incomingAudio != nil {
+			_ = g.playerTwo.incomingAudio.Close()
+		}
 
-		_ = g.playerOne.conn.Close()
-		_ = g.playerTwo.conn.Close()
+		g.playerOne.close()
+		g.playerTwo.close()
 
 		g.log.Info().TimeDiff("game_duration", time.Now(), start).Msg("Closed connections to clients")
 	}()
 
-	isFirstsTurn := rand.Intn(2) == 1
-
-	if !g.sendOpponentReadyMessage(g.playerOne, g.playerTwo.phoneNumber, isFirstsTurn) ||
-		!g.sendOpponentReadyMessage(g.playerTwo, g.playerOne.phoneNumber, !isFirstsTurn) {
+	if g.forfeit() {
 		return
 	}
 
-	var game ticTacToe
+	messages := make(chan clientMessage)
+	go g.playerOne.receive(ctx, messages)
+	go g.playerTwo.receive(ctx, messages)
+
+	for g.play(ctx, messages) && g.next(ctx, messages) {
+	}
+}
+
+// play plays a single game. It returns false if the game ended without a result
+// or the players can not play another game, e.g. because one of them hung up.
+func (g *game) play(ctx context.Context, messages <-chan clientMessage) bool {
+	if !g.sendOpponentReadyMessages() {
+		return false
+	}
 
-	for !game.done() {
-		var client *webSocketClient
+	if sg, ok := g.game.(setupGame); ok && !g.runSetup(ctx, sg, messages) {
+		g.forfeit()
+		return false
+	}
 
-		if isFirstsTurn {
-			client = g.playerOne
-		} else {
-			client = g.playerTwo
+	// Number of invalid moves in the current turn.
+	invalidMoves := 0
+	for !g.game.Outcome().Done {
+		player := g.game.Turn()
+		client := g.client(player)
+
+		g.sendClock(player)
+		turnCtx, cancelTurn := g.clock.turnContext(ctx, player)
+		start := time.Now()
+		move, err := g.getMoveFromClient(turnCtx, client)
+		cancelTurn()
+		g.clock.use(player, time.Since(start))
+
+		if err != nil && ctx.Err() == nil && errors.Is(turnCtx.Err(), context.DeadlineExceeded) {
+			g.clock.endTurn()
+			invalidMoves = 0
+			if !g.timeUp(player) {
+				// Either the player forfeited or a client is gone.
+				return g.clock.config.OnTimeUp == TimeUpForfeit
+			}
+			continue
+		}
+		if err != nil && isInputTimeout(err) && !client.hasHungUp() {
+			// The call gave up waiting for the player, who is therefore inactive.
+			g.log.Info().Str("current_turn_addr", client.remoteAddr()).Msg("Client did not enter a move")
+			g.end(player.Opponent(), gameDoneTimeout)
+			return true
+		}
+		if err != nil {
+			if !g.forfeit() && ctx.Err() == nil {
+				// Without a call monitor the call is not known to be done, but a failed read
+				// means that the caller is gone all the same.
+				client.log.Info().Err(err).Msg("Failed to read move, player forfeits the game")
+				g.end(player.Opponent(), gameDoneHangup)
+			}
+			return false
 		}
 
-		digit, ok := g.getDigitFromClient(client)
-		if !ok {
-			return
+		switch move {
+		case strconv.Itoa(readBoardDigit), commandReadBoard:
+			g.announceBoard(player)
+			continue
+		case commandResign:
+			g.resign(player)
+			return true
+		case commandOfferDraw:
+			if g.offerDraw(ctx, player, messages) {
+				return true
+			}
+			continue
+		case commandTakeback:
+			g.takeback(ctx, player, messages)
+			continue
 		}
 
-		// Normalize digit from 1-9 to expected field index 0-8.
-		if !game.selectField(digit-1, isFirstsTurn) {
-			digit = game.selectRandomField(isFirstsTurn) + 1
+		if err := g.game.Play(move); err != nil {
+			invalidMoves++
+			switch g.rejectMove(player, move, err, invalidMoves) {
+			case InvalidMoveReprompt:
+				continue
+			case InvalidMoveForfeit:
+				return true
+			}
+			move = g.playRandomMove()
 		}
 
+		g.clock.endTurn()
+		invalidMoves = 0
+		g.movers = append(g.movers, player)
 		g.log.Info().
-			Str("current_turn_addr", client.conn.RemoteAddr().String()).
-			Int("digit", digit).
-			Msg("Client selected digit")
+			Str("current_turn_addr", client.remoteAddr()).
+			Str("move", move).
+			Msg("Client made move")
 
-		if !g.sendTurnInfo(g.playerOne, digit, isFirstsTurn) || !g.sendTurnInfo(
-			g.playerTwo,
-			digit,
-			!isFirstsTurn,
-		) {
-			return
+		if !g.sendTurnInfo(player, move, false) {
+			return false
 		}
+	}
 
-		isFirstsTurn = !isFirstsTurn
+	g.end(g.game.Outcome().Winner, gameDoneCompleted)
+	return true
+}
+
+// next prepares the next game of the series, in which the players switch sides.
+// It returns false if the players are done, because the series is over and they
+// do not play a rematch.
+func (g *game) next(ctx context.Context, messages <-chan clientMessage) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if g.series.done() {
+		if g.series == nil || !g.series.config.Rematch || !g.askRematch(ctx, messages) {
+			return false
+		}
+		g.series.rematch()
 	}
 
-	winner, _, ok := game.hasWinner()
-	if !ok {
-		g.sendGameDone(g.playerOne, false, false)
-		g.sendGameDone(g.playerTwo, false, false)
-	} else {
-		g.sendGameDone(g.playerOne, true, winner == playerOne)
-		g.sendGameDone(g.playerTwo, true, winner == playerTwo)
+	rules, err := newGame(g.playerOne.gameType)
+	if err != nil {
+		g.log.Err(err).Msg("Failed to create next game")
+		return false
+	}
+	g.playerOne, g.playerTwo = g.playerTwo, g.playerOne
+	g.game = rules
+	g.movers = nil
+	if g.clock != nil {
+		g.clock = newMoveClock(g.clock.config)
 	}
+	g.log.Info().Int("series", g.series.number).Int("games", g.series.games).Msg("Starting next game")
+	return true
 }
 
 func (g *game) copyAudioStream(from, to *webSocketClient) {
+	src := from.incomingAudio.Format()
+	dst := audio.PlaybackFormat(src)
+	if err := to.sendAudioFormat(dst); err != nil {
+		to.log.Err(err).Msg("Failed to send audio format to client")
+		return
+	}
+	converter := audio.NewConverter(src, dst)
+
 	// Sample logs because streaming audio is called many times per second.
 	sampleLogTo := to.log.Sample(&zerolog.BurstSampler{
 		Burst:  1,
@@ -167,17 +917,13 @@ func (g *game) copyAudioStream(from, to *webSocketClient) {
 	})
 	var total uint64
 	for {
-		typ, data, err := from.incomingAudio.ReadMessage()
+		data, err := from.incomingAudio.ReadAudio()
 		if err != nil {
-			from.log.Err(err).Msg("Failed to read audio from web socket")
+			from.log.Err(err).Msg("Failed to read audio from incoming audio stream")
 			break
 		}
-		if typ != websocket.BinaryMessage {
-			from.log.Warn().Int("msg_type", typ).Msg("Received unexpected web socket message type")
-			continue
-		}
 		total += uint64(len(data))
-		if err := to.sendAudio(data); err != nil {
+		if err := to.sendAudio(converter.Convert(data)); err != nil {
 			to.log.Err(err).Msg("Failed to stream audio to client")
 			break
 		}
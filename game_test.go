@@ -0,0 +1,580 @@
+package voipttt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/audio"
+)
+
+// runTestGame plays a game of Tic-Tac-Toe between the two calls until it is done.
+// It returns the messages that the browsers of both players received.
+func runTestGame(t *testing.T, one, two *testCall, invalidMove InvalidMoveConfig) (browserOne, browserTwo <-chan webSocketRequest) {
+	t.Helper()
+	playerOne, _, browserOne := newTestClient(t, "100", one)
+	playerTwo, _, browserTwo := newTestClient(t, "200", two)
+	g := &game{
+		playerOne:   playerOne,
+		playerTwo:   playerTwo,
+		game:        new(ticTacToe),
+		invalidMove: invalidMove,
+		log:         zerolog.Nop(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	g.run(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("game did not end")
+	}
+	return browserOne, browserTwo
+}
+
+// received decodes the data of all messages of the given type that the browser received
+// until its connection was closed.
+func received[T any](t *testing.T, browser <-chan webSocketRequest, messageType webSocketMessage) []T {
+	t.Helper()
+	var data []T
+	for msg := range browser {
+		if msg.Type != messageType {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(msg.Data, &v); err != nil {
+			t.Fatalf("decode %s: %v", messageType, err)
+		}
+		data = append(data, v)
+	}
+	return data
+}
+
+// gameDone returns the only GAME_DONE announcement of the call.
+func gameDone(t *testing.T, call *testCall) *dataGameDone {
+	t.Helper()
+	announced := call.announced(string(messageGameDone))
+	if len(announced) != 1 {
+		t.Fatalf("got %d GAME_DONE announcements, want 1", len(announced))
+	}
+	return announced[0].(*dataGameDone)
+}
+
+func TestGameEndsWhenPlayerDoesNotEnterMove(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "timeout", err: &InputTimeoutError{Attempts: 4}},
+		{name: "too short", err: fmt.Errorf("%w: %q is too short", ErrInvalidInput, "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inactive := newTestCall(func(context.Context, InputSpec) (string, error) {
+				return "", tt.err
+			})
+			opponent := newTestCall(nil)
+			runTestGame(t, inactive, opponent, defaultInvalidMoveConfig)
+
+			for _, tc := range []struct {
+				call   *testCall
+				winner bool
+			}{{inactive, false}, {opponent, true}} {
+				if data := gameDone(t, tc.call); data.Reason != gameDoneTimeout || data.IsPlayerWinner != tc.winner {
+					t.Fatalf("got %+v, want a timeout with IsPlayerWinner %v", data, tc.winner)
+				}
+			}
+		})
+	}
+}
+
+func TestGameEndsWhenReadingMoveFails(t *testing.T) {
+	// The call is not known to be done, as without a call monitor.
+	gone := newTestCall(func(context.Context, InputSpec) (string, error) {
+		return "", errors.New("caller hung up")
+	})
+	opponent := newTestCall(nil)
+	runTestGame(t, gone, opponent, defaultInvalidMoveConfig)
+
+	for _, tc := range []struct {
+		call   *testCall
+		winner bool
+	}{{gone, false}, {opponent, true}} {
+		if data := gameDone(t, tc.call); data.Reason != gameDoneHangup || data.IsPlayerWinner != tc.winner {
+			t.Fatalf("got %+v, want a hangup with IsPlayerWinner %v", data, tc.winner)
+		}
+	}
+}
+
+// countingGame is a game unknown to the server: the players count up in turns
+// and the player who says three wins.
+type countingGame struct {
+	count int
+}
+
+func (c *countingGame) Turn() Player {
+	if c.count%2 == 0 {
+		return PlayerOne
+	}
+	return PlayerTwo
+}
+
+func (c *countingGame) Moves() []string {
+	if c.count >= 3 {
+		return nil
+	}
+	return []string{strconv.Itoa(c.count + 1)}
+}
+
+func (c *countingGame) Play(move string) error {
+	if move != strconv.Itoa(c.count+1) {
+		return fmt.Errorf("%w: %q is not the next number", ErrIllegalMove, move)
+	}
+	c.count++
+	return nil
+}
+
+func (c *countingGame) Outcome() Outcome {
+	if c.count < 3 {
+		return Outcome{}
+	}
+	return Outcome{Done: true, Winner: PlayerOne}
+}
+
+func (c *countingGame) State() any {
+	return map[string]int{"count": c.count}
+}
+
+func (c *countingGame) Input() InputSpec {
+	return MoveInputSpec
+}
+
+func TestGameRunsRegisteredGame(t *testing.T) {
+	const name = "test-counting"
+	RegisterGame(name, func() Game { return new(countingGame) })
+	t.Cleanup(func() {
+		gameTypesMu.Lock()
+		defer gameTypesMu.Unlock()
+		delete(gameTypes, name)
+	})
+
+	counting, err := newGame(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, two := newTestCall(scriptedKeys("1", "3")), newTestCall(scriptedKeys("2"))
+	playerOne, _, browser := newTestClient(t, "100", one)
+	playerTwo, _, _ := newTestClient(t, "200", two)
+	playerOne.gameType, playerTwo.gameType = name, name
+	g := &game{
+		playerOne:   playerOne,
+		playerTwo:   playerTwo,
+		game:        counting,
+		invalidMove: defaultInvalidMoveConfig,
+		log:         zerolog.Nop(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	g.run(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("game did not end")
+	}
+
+	if data := gameDone(t, one); !data.IsPlayerWinner {
+		t.Fatalf("got %+v, want a win of player one", data)
+	}
+
+	// The browser shows the state of the game after each move as it is returned by the game.
+	var states []string
+	for msg := range browser {
+		if msg.Type != messageTurnInfo {
+			continue
+		}
+		var data struct {
+			Move  string          `json:"move"`
+			State json.RawMessage `json:"state"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, data.Move+" "+string(data.State))
+	}
+	want := []string{`1 {"count":1}`, `2 {"count":2}`, `3 {"count":3}`}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("got turn infos %v, want %v", states, want)
+	}
+}
+
+// testAudioStream is an incoming audio stream that returns the given chunks.
+type testAudioStream struct {
+	format audio.Format
+	chunks [][]byte
+}
+
+func (s *testAudioStream) ReadAudio() ([]byte, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *testAudioStream) Format() audio.Format { return s.format }
+func (s *testAudioStream) RemoteAddr() net.Addr { return nil }
+func (s *testAudioStream) Close() error         { return nil }
+
+func TestCopyAudioStreamSendsFormatFirst(t *testing.T) {
+	conn, browser := newTestWebSocket(t)
+	to := &webSocketClient{conn: conn, connMu: new(sync.Mutex), log: zerolog.Nop()}
+	pcm := audio.PCM([]int16{100, 200, 300, 400})
+	from := &webSocketClient{
+		incomingAudio: &testAudioStream{
+			format: audio.Format{Encoding: audio.EncodingULaw, SampleRate: 8000, Channels: 1},
+			chunks: [][]byte{audio.EncodeULawPCM(pcm[:4]), audio.EncodeULawPCM(pcm[4:])},
+		},
+		log: zerolog.Nop(),
+	}
+
+	g := &game{log: zerolog.Nop()}
+	g.copyAudioStream(from, to)
+
+	messageType, data, err := browser.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Type webSocketMessage `json:"type"`
+		Data audio.Format     `json:"data"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := audio.Format{Encoding: audio.EncodingLinear16, SampleRate: 8000, Channels: 1}
+	if messageType != websocket.TextMessage || msg.Type != messageAudioFormat || msg.Data != want {
+		t.Fatalf("got first message %s, want the AUDIO_FORMAT %v", data, want)
+	}
+
+	// The audio follows in the announced format.
+	for range [2]struct{}{} {
+		messageType, data, err := browser.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != websocket.BinaryMessage || len(data) != 4 {
+			t.Fatalf("got message of type %d with %d bytes, want two samples of PCM", messageType, len(data))
+		}
+	}
+}
+
+func TestGameResign(t *testing.T) {
+	one := newTestCall(scriptedKeys("5", commandResign))
+	two := newTestCall(scriptedKeys("1"))
+	runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+	for _, tc := range []struct {
+		call   *testCall
+		winner bool
+	}{{one, false}, {two, true}} {
+		if data := gameDone(t, tc.call); data.Reason != gameDoneResign || data.IsPlayerWinner != tc.winner {
+			t.Fatalf("got %+v, want a resignation with IsPlayerWinner %v", data, tc.winner)
+		}
+	}
+}
+
+func TestGameDrawAgreedOnPhone(t *testing.T) {
+	one := newTestCall(scriptedKeys("5", commandOfferDraw))
+	two := newTestCall(scriptedKeys("1", answerAccept))
+	runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+	for _, tc := range []struct {
+		call     *testCall
+		isPlayer bool
+	}{{one, true}, {two, false}} {
+		offers := tc.call.announced(string(messageDrawOffered))
+		if len(offers) != 1 || offers[0].(*dataDrawOffer).IsPlayer != tc.isPlayer {
+			t.Fatalf("got DRAW_OFFERED announcements %+v, want IsPlayer %v", offers, tc.isPlayer)
+		}
+		if data := gameDone(t, tc.call); data.Reason != gameDoneDrawAgreed || data.HasWinner {
+			t.Fatalf("got %+v, want an agreed draw", data)
+		}
+	}
+}
+
+func TestGameDrawAgreedOnWebsite(t *testing.T) {
+	one := newTestCall(scriptedKeys(commandOfferDraw))
+	// Player two does not answer on the phone. The answer on the website is only sent
+	// once the game waits for it, earlier answers belong to earlier requests.
+	asked := make(chan struct{}, 1)
+	two := newTestCall(func(ctx context.Context, spec InputSpec) (string, error) {
+		if spec == answerInputSpec {
+			asked <- struct{}{}
+		}
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	playerOne, _, _ := newTestClient(t, "100", one)
+	playerTwo, browserTwo, _ := newTestClient(t, "200", two)
+	g := &game{
+		playerOne:   playerOne,
+		playerTwo:   playerTwo,
+		game:        new(ticTacToe),
+		invalidMove: defaultInvalidMoveConfig,
+		log:         zerolog.Nop(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.run(ctx)
+	}()
+
+	select {
+	case <-asked:
+	case <-done:
+		t.Fatal("game ended before player two was asked")
+	}
+	answer := map[string]any{"type": messageDrawAnswer, "data": dataAnswer{Accept: true}}
+	if err := browserTwo.WriteJSON(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if ctx.Err() != nil {
+		t.Fatal("game did not end")
+	}
+
+	if data := gameDone(t, two); data.Reason != gameDoneDrawAgreed || data.HasWinner {
+		t.Fatalf("got %+v, want an agreed draw", data)
+	}
+}
+
+func TestGameDrawDeclined(t *testing.T) {
+	timedOut := func(keys func(context.Context, InputSpec) (string, error)) func(context.Context, InputSpec) (string, error) {
+		return func(ctx context.Context, spec InputSpec) (string, error) {
+			if spec == answerInputSpec {
+				return "", &InputTimeoutError{Attempts: 1}
+			}
+			return keys(ctx, spec)
+		}
+	}
+
+	tests := []struct {
+		name string
+		two  func(context.Context, InputSpec) (string, error)
+	}{
+		{name: "declined", two: scriptedKeys(answerDecline, commandResign)},
+		{name: "timeout", two: timedOut(scriptedKeys(commandResign))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			one := newTestCall(scriptedKeys(commandOfferDraw, "5"))
+			two := newTestCall(tt.two)
+			browserOne, _ := runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+			declined := one.announced(string(messageDrawDeclined))
+			if len(declined) != 1 || !declined[0].(*dataDrawOffer).IsPlayer {
+				t.Fatalf("got DRAW_DECLINED announcements %+v, want the declined offer of the player", declined)
+			}
+
+			// Player one makes their move after the offer and wins when player two resigns.
+			turns := received[dataTurnInfo](t, browserOne, messageTurnInfo)
+			if len(turns) != 1 || turns[0].Move != "5" || !turns[0].IsPlayer {
+				t.Fatalf("got turn infos %+v, want the move of player one", turns)
+			}
+			if data := gameDone(t, one); data.Reason != gameDoneResign || !data.IsPlayerWinner {
+				t.Fatalf("got %+v, want a win by resignation", data)
+			}
+		})
+	}
+}
+
+func TestGameTakeback(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		// message is what both players are told about the takeback.
+		message webSocketMessage
+	}{
+		{name: "accepted", answer: answerAccept, message: messageTakebackAccepted},
+		{name: "declined", answer: answerDecline, message: messageTakebackDeclined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Player one asks to take back their move 5 after player two answered with 1.
+			one := newTestCall(scriptedKeys("5", commandTakeback, "9"))
+			two := newTestCall(scriptedKeys("1", tt.answer, commandResign))
+			browserOne, browserTwo := runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+			for _, tc := range []struct {
+				call     *testCall
+				isPlayer bool
+			}{{one, true}, {two, false}} {
+				got := tc.call.announced(string(tt.message))
+				if len(got) != 1 || got[0].(*dataTakeback).IsPlayer != tc.isPlayer {
+					t.Fatalf("got %s announcements %+v, want IsPlayer %v", tt.message, got, tc.isPlayer)
+				}
+			}
+
+			for _, browser := range []<-chan webSocketRequest{browserOne, browserTwo} {
+				var turns []string
+				var boardStates []*gridState
+				for msg := range browser {
+					if msg.Type != messageTurnInfo && msg.Type != messageBoardState {
+						continue
+					}
+					var data struct {
+						Move  string     `json:"move"`
+						State *gridState `json:"state"`
+					}
+					if err := json.Unmarshal(msg.Data, &data); err != nil {
+						t.Fatal(err)
+					}
+					if msg.Type == messageTurnInfo {
+						turns = append(turns, data.Move)
+					} else {
+						boardStates = append(boardStates, data.State)
+					}
+				}
+
+				// Player one moves again after the request, no matter the answer.
+				if want := []string{"5", "1", "9"}; !reflect.DeepEqual(turns, want) {
+					t.Fatalf("got moves %v, want %v", turns, want)
+				}
+
+				if tt.message == messageTakebackDeclined {
+					if len(boardStates) != 0 {
+						t.Fatalf("got board states %+v after a declined takeback", boardStates)
+					}
+					continue
+				}
+				// Both moves are taken back, the board is empty again.
+				if len(boardStates) != 1 || !reflect.DeepEqual(boardStates[0].Fields, make([]Player, 9)) {
+					t.Fatalf("got board states %+v, want an empty board", boardStates)
+				}
+			}
+		})
+	}
+}
+
+func TestGameTakebackWithoutMove(t *testing.T) {
+	one := newTestCall(scriptedKeys(commandTakeback, "5"))
+	two := newTestCall(scriptedKeys(commandResign))
+	runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+	declined := one.announced(string(messageTakebackDeclined))
+	if len(declined) != 1 || declined[0].(*dataTakeback).Reason != "there is no move to take back" {
+		t.Fatalf("got TAKEBACK_DECLINED announcements %+v, want the reason", declined)
+	}
+	// The opponent is not asked.
+	if requested := two.announced(string(messageTakebackRequested)); len(requested) != 0 {
+		t.Fatalf("got TAKEBACK_REQUESTED announcements %+v for the opponent", requested)
+	}
+	if declined := two.announced(string(messageTakebackDeclined)); len(declined) != 0 {
+		t.Fatalf("got TAKEBACK_DECLINED announcements %+v for the opponent", declined)
+	}
+	if data := gameDone(t, one); data.Reason != gameDoneResign || !data.IsPlayerWinner {
+		t.Fatalf("got %+v, want a win by resignation", data)
+	}
+}
+
+func TestGamePlaysSeries(t *testing.T) {
+	// Both players resign in turns, the players switch sides after each game.
+	a := newTestCall(scriptedKeys(commandResign, commandResign))
+	b := newTestCall(scriptedKeys(commandResign))
+	playerOne, _, _ := newTestClient(t, "100", a)
+	playerTwo, _, _ := newTestClient(t, "200", b)
+	g := &game{
+		playerOne:   playerOne,
+		playerTwo:   playerTwo,
+		game:        new(ticTacToe),
+		invalidMove: defaultInvalidMoveConfig,
+		series:      newSeries(SeriesConfig{BestOf: 3}),
+		log:         zerolog.Nop(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	g.run(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("series did not end")
+	}
+
+	var winners []bool
+	for _, data := range b.announced(string(messageGameDone)) {
+		winners = append(winners, data.(*dataGameDone).IsPlayerWinner)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(winners, want) {
+		t.Fatalf("got wins %v of the player who resigned once, want %v", winners, want)
+	}
+	if data := g.series.data(playerTwo, playerOne); data.PlayerWins != 2 || !data.Done {
+		t.Fatalf("got series %+v, want two wins of the player who resigned once", data)
+	}
+}
+
+func TestGameAnnouncesToBothPlayersAtTheSameTime(t *testing.T) {
+	one := newTestCall(scriptedKeys(commandResign))
+	two := newTestCall(scriptedKeys())
+
+	// The announcement to player one only finishes once player two heard it, too.
+	announcedToTwo := make(chan struct{})
+	waited := false
+	one.onAnnounce = func(announcement Announcement) {
+		if announcement.Type != string(messageOpponentReady) {
+			return
+		}
+		select {
+		case <-announcedToTwo:
+		case <-time.After(time.Second * 5):
+			waited = true
+		}
+	}
+	two.onAnnounce = func(announcement Announcement) {
+		if announcement.Type == string(messageOpponentReady) {
+			close(announcedToTwo)
+		}
+	}
+	runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+	if waited {
+		t.Fatal("player two waited for the announcement to player one")
+	}
+	if data := gameDone(t, two); data.Reason != gameDoneResign || !data.IsPlayerWinner {
+		t.Fatalf("got %+v, want player two to win by resignation", data)
+	}
+}
+
+func TestGameReadsBoard(t *testing.T) {
+	one := newTestCall(scriptedKeys("5", strconv.Itoa(readBoardDigit), commandReadBoard, commandResign))
+	two := newTestCall(scriptedKeys("1"))
+	runTestGame(t, one, two, defaultInvalidMoveConfig)
+
+	boards := one.announced(announceBoard)
+	if len(boards) != 2 {
+		t.Fatalf("got %d board announcements, want 2", len(boards))
+	}
+	for _, board := range boards {
+		fields := board.(*dataAnnounceBoard).Fields
+		if fields[4].Owner != boardFieldPlayer || fields[0].Owner != boardFieldOpponent {
+			t.Fatalf("got fields %+v, want field 5 of the player and field 1 of the opponent", fields)
+		}
+	}
+	if data := gameDone(t, one); data.Reason != gameDoneResign {
+		t.Fatalf("got %+v, want a resignation", data)
+	}
+}
@@ -0,0 +1,84 @@
+package voipttt
+
+// grid is a board of fields arranged in rows and columns, which is used by games
+// that are won by placing a number of fields in a row.
+type grid struct {
+	rows, cols int
+	// Fields row by row, starting at the top left.
+	fields []Player
+}
+
+func newGrid(rows, cols int) grid {
+	return grid{
+		rows:   rows,
+		cols:   cols,
+		fields: make([]Player, rows*cols),
+	}
+}
+
+// contains returns whether the zero based row and column are on the grid.
+func (g *grid) contains(row, col int) bool {
+	return row >= 0 && row < g.rows && col >= 0 && col < g.cols
+}
+
+func (g *grid) at(row, col int) Player {
+	return g.fields[row*g.cols+col]
+}
+
+func (g *grid) set(row, col int, player Player) {
+	g.fields[row*g.cols+col] = player
+}
+
+// full returns whether no field is free anymore.
+func (g *grid) full() bool {
+	for _, f := range g.fields {
+		if f == PlayerNone {
+			return false
+		}
+	}
+	return true
+}
+
+// inRow returns whether the field at the given row and column is part of at least
+// n fields in a horizontal, vertical or diagonal row that belong to its owner.
+// Only the rows through the field are checked, so that the check does not depend
+// on the size of the grid.
+func (g *grid) inRow(row, col, n int) bool {
+	owner := g.at(row, col)
+	if owner == PlayerNone {
+		return false
+	}
+
+	count := func(dRow, dCol int) int {
+		var count int
+		for r, c := row+dRow, col+dCol; g.contains(r, c) && g.at(r, c) == owner; r, c = r+dRow, c+dCol {
+			count++
+		}
+		return count
+	}
+
+	directions := [...][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		if 1+count(d[0], d[1])+count(-d[0], -d[1]) >= n {
+			return true
+		}
+	}
+	return false
+}
+
+// state returns the grid as it is shown on the website.
+func (g *grid) state() gridState {
+	fields := make([]Player, len(g.fields))
+	copy(fields, g.fields)
+	return gridState{
+		Rows:   g.rows,
+		Cols:   g.cols,
+		Fields: fields,
+	}
+}
+
+// clone returns a copy of the grid that does not share its fields.
+func (g grid) clone() grid {
+	g.fields = append([]Player(nil), g.fields...)
+	return g
+}
@@ -0,0 +1,296 @@
+package voipttt
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inputPollInterval is how long a key reader waits at once when the input has no timeouts,
+// so that a hung up call is still noticed.
+const inputPollInterval = time.Second * 5
+
+// ErrInvalidInput is returned when the caller entered too few keys in all attempts.
+var ErrInvalidInput = errors.New("invalid input")
+
+// InputTimeoutError is returned when the caller did not complete their input in time,
+// not even after all retries.
+type InputTimeoutError struct {
+	// Attempts is the number of attempts the caller had.
+	Attempts int
+	// Keys are the keys entered in the last attempt.
+	Keys string
+}
+
+func (e *InputTimeoutError) Error() string {
+	if e.Attempts == 0 {
+		// The attempts are not known if the input was read by a client of the private API.
+		return "input timed out"
+	}
+	return fmt.Sprintf("input timed out after %d attempts", e.Attempts)
+}
+
+// isInputTimeout returns whether the caller did not complete their input after all retries,
+// i.e. whether the error is of type *InputTimeoutError or ErrInvalidInput.
+func isInputTimeout(err error) bool {
+	var timeoutErr *InputTimeoutError
+	return errors.As(err, &timeoutErr) || errors.Is(err, ErrInvalidInput)
+}
+
+// KeyReader waits up to timeout for the caller to press a key.
+// The returned key is 0 if the timeout was reached.
+type KeyReader func(timeout time.Duration) (rune, error)
+
+// InputSpec describes how the keys a caller presses are collected into an input,
+// e.g. a verification code or a move.
+type InputSpec struct {
+	// Timeout limits the time of a single attempt. 0 means no limit.
+	Timeout time.Duration
+	// InterDigitTimeout limits the time until the first and between two keys.
+	// If the keys entered so far satisfy MinLength, the input is accepted once it
+	// elapses, so the terminator may be omitted. 0 means no limit.
+	InterDigitTimeout time.Duration
+	// MinLength is the minimum number of keys, at least one key is always required.
+	MinLength int
+	// MaxLength ends the input as soon as it is reached. 0 means no limit.
+	// A MaxLength of 1 results in single key mode, i.e. a move does not need the terminator.
+	MaxLength int
+	// Terminator submits the input. 0 means the input has no terminator.
+	Terminator rune
+	// ClearKey discards all keys entered so far. 0 disables clearing.
+	ClearKey rune
+	// CommandKey as the first key starts a command instead of a move, which ends
+	// after one more key, e.g. *1. It takes precedence over the ClearKey.
+	// 0 disables commands.
+	CommandKey rune
+	// MaxRetries is the number of times the input is restarted after a timeout or
+	// input that is too short, before an error is returned.
+	MaxRetries int
+}
+
+var (
+	// CodeInputSpec collects the verification code, which is submitted with #.
+	CodeInputSpec = InputSpec{
+		InterDigitTimeout: time.Second * 10,
+		MinLength:         1,
+		Terminator:        '#',
+		ClearKey:          '*',
+		MaxRetries:        3,
+	}
+	// MoveInputSpec collects a single key move, a # after the key is optional.
+	// Instead of a move, the caller can enter a command like *1 to resign.
+	// The star is both the CommandKey and the ClearKey: as the first key it starts
+	// a command, after any other key it clears the input, so ** cancels a command.
+	MoveInputSpec = InputSpec{
+		InterDigitTimeout: time.Second * 30,
+		MinLength:         1,
+		MaxLength:         1,
+		Terminator:        '#',
+		ClearKey:          '*',
+		CommandKey:        '*',
+		MaxRetries:        3,
+	}
+)
+
+// ParseInputSpec changes the given spec as described by a comma separated list of
+// <name>=<value> pairs, e.g. `digit-timeout=10s,retries=1`. The names are timeout,
+// digit-timeout, min, max and retries, which take durations and numbers, and terminator,
+// clear and command, which take a single key or nothing to disable the key.
+func ParseInputSpec(s string, spec InputSpec) (InputSpec, error) {
+	if s == "" {
+		return spec, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return spec, fmt.Errorf("expected <name>=<value>, got %q", pair)
+		}
+
+		var err error
+		switch name {
+		case "timeout":
+			spec.Timeout, err = time.ParseDuration(value)
+		case "digit-timeout":
+			spec.InterDigitTimeout, err = time.ParseDuration(value)
+		case "min":
+			spec.MinLength, err = strconv.Atoi(value)
+		case "max":
+			spec.MaxLength, err = strconv.Atoi(value)
+		case "retries":
+			spec.MaxRetries, err = strconv.Atoi(value)
+		case "terminator":
+			spec.Terminator, err = parseInputKey(value)
+		case "clear":
+			spec.ClearKey, err = parseInputKey(value)
+		case "command":
+			spec.CommandKey, err = parseInputKey(value)
+		default:
+			return spec, fmt.Errorf("unknown name %q", name)
+		}
+		if err != nil {
+			return spec, fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+	}
+	return spec, nil
+}
+
+// parseInputKey returns the single key of value, 0 if it is empty.
+func parseInputKey(value string) (rune, error) {
+	keys := []rune(value)
+	switch {
+	case len(keys) == 0:
+		return 0, nil
+	case len(keys) > 1 || !strings.ContainsRune("0123456789*#", keys[0]):
+		return 0, errors.New("expected a single key of the phone")
+	}
+	return keys[0], nil
+}
+
+// Read collects an input with the given key reader.
+// If the caller does not complete their input after all retries, the returned error
+// is either of type *InputTimeoutError or ErrInvalidInput.
+func (spec InputSpec) Read(readKey KeyReader) (string, error) {
+	for attempt := 1; ; attempt++ {
+		keys, err := spec.readAttempt(readKey)
+		if err == nil {
+			return keys, nil
+		}
+
+		var timeoutErr *InputTimeoutError
+		if !errors.As(err, &timeoutErr) && !errors.Is(err, ErrInvalidInput) {
+			return "", err
+		}
+		if attempt > spec.MaxRetries {
+			if timeoutErr != nil {
+				timeoutErr.Attempts = attempt
+			}
+			return "", err
+		}
+	}
+}
+
+// readAttempt collects a single attempt of the input.
+func (spec InputSpec) readAttempt(readKey KeyReader) (string, error) {
+	minLength := spec.MinLength
+	if minLength < 1 {
+		minLength = 1
+	}
+
+	var keys strings.Builder
+	isCommand := false
+	start := time.Now()
+
+	for {
+		wait := spec.InterDigitTimeout
+		if wait == 0 {
+			wait = inputPollInterval
+		}
+		timedOut := false
+		if spec.Timeout > 0 {
+			remaining := spec.Timeout - time.Since(start)
+			if remaining <= 0 {
+				return "", &InputTimeoutError{Keys: keys.String()}
+			}
+			if remaining < wait {
+				wait = remaining
+				timedOut = true
+			}
+		}
+
+		key, err := readKey(wait)
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case key == 0 && timedOut:
+			return "", &InputTimeoutError{Keys: keys.String()}
+		case key == 0 && spec.InterDigitTimeout == 0:
+			// Without an inter digit timeout, only the overall timeout ends the input.
+			continue
+		case key == 0:
+			if keys.Len() >= minLength {
+				return keys.String(), nil
+			}
+			return "", &InputTimeoutError{Keys: keys.String()}
+		case key == spec.CommandKey && keys.Len() == 0:
+			keys.WriteRune(key)
+			isCommand = true
+		case key == spec.ClearKey:
+			keys.Reset()
+			isCommand = false
+		case key == spec.Terminator:
+			if keys.Len() == 0 {
+				// A superfluous terminator, e.g. after a single key input.
+				continue
+			}
+			if keys.Len() < minLength {
+				return "", fmt.Errorf("%w: %q is too short", ErrInvalidInput, keys.String())
+			}
+			return keys.String(), nil
+		default:
+			keys.WriteRune(key)
+			if isCommand || (spec.MaxLength > 0 && keys.Len() >= spec.MaxLength) {
+				return keys.String(), nil
+			}
+		}
+	}
+}
+
+// addKeysToQuery adds how the keys of the input are entered to the query, which tells
+// clients of the private API how to read the next move. Timeouts and retries are left
+// to the client.
+func (spec InputSpec) addKeysToQuery(q url.Values) {
+	q.Set("minLength", strconv.Itoa(spec.MinLength))
+	q.Set("maxLength", strconv.Itoa(spec.MaxLength))
+	if spec.Terminator != 0 {
+		q.Set("terminator", string(spec.Terminator))
+	}
+	if spec.ClearKey != 0 {
+		q.Set("clearKey", string(spec.ClearKey))
+	}
+	if spec.CommandKey != 0 {
+		q.Set("commandKey", string(spec.CommandKey))
+	}
+}
+
+// withKeysFromQuery returns the spec with the keys added by addKeysToQuery.
+// The spec is returned unchanged if the query does not describe the keys.
+func (spec InputSpec) withKeysFromQuery(q url.Values) (InputSpec, error) {
+	if !q.Has("maxLength") {
+		return spec, nil
+	}
+
+	var err error
+	if spec.MinLength, err = strconv.Atoi(q.Get("minLength")); err != nil {
+		return spec, fmt.Errorf("invalid minimum length %q", q.Get("minLength"))
+	}
+	if spec.MaxLength, err = strconv.Atoi(q.Get("maxLength")); err != nil {
+		return spec, fmt.Errorf("invalid maximum length %q", q.Get("maxLength"))
+	}
+
+	key := func(name string) (rune, error) {
+		v := []rune(q.Get(name))
+		switch len(v) {
+		case 0:
+			return 0, nil
+		case 1:
+			return v[0], nil
+		default:
+			return 0, fmt.Errorf("invalid %s %q", name, string(v))
+		}
+	}
+	if spec.Terminator, err = key("terminator"); err != nil {
+		return spec, err
+	}
+	if spec.ClearKey, err = key("clearKey"); err != nil {
+		return spec, err
+	}
+	if spec.CommandKey, err = key("commandKey"); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
@@ -0,0 +1,222 @@
+package voipttt
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeKeyReader returns the scripted keys one after another, where 0 means that the
+// wait elapsed. It records the waits it was called with and fails once the keys are used up.
+type fakeKeyReader struct {
+	keys  []rune
+	waits []time.Duration
+}
+
+func (r *fakeKeyReader) read(timeout time.Duration) (rune, error) {
+	r.waits = append(r.waits, timeout)
+	if len(r.keys) == 0 {
+		return 0, errors.New("no more keys")
+	}
+	key := r.keys[0]
+	r.keys = r.keys[1:]
+	return key, nil
+}
+
+func TestInputSpecRead(t *testing.T) {
+	codeSpec := InputSpec{
+		InterDigitTimeout: time.Second,
+		MinLength:         2,
+		Terminator:        '#',
+		ClearKey:          '*',
+		MaxRetries:        1,
+	}
+
+	tests := []struct {
+		name string
+		spec InputSpec
+		keys string // 0 is a timeout of the key reader.
+		want string
+		// Either a *InputTimeoutError with the given attempts or ErrInvalidInput.
+		attempts int
+		invalid  bool
+	}{
+		{name: "single key move", spec: MoveInputSpec, keys: "5", want: "5"},
+		{name: "superfluous terminator", spec: MoveInputSpec, keys: "#5", want: "5"},
+		{name: "command", spec: MoveInputSpec, keys: "*1", want: "*1"},
+		{name: "clear key cancels a command", spec: MoveInputSpec, keys: "**5", want: "5"},
+		{name: "command of two key moves", spec: newUltimateTicTacToe().Input(), keys: "*0", want: "*0"},
+		{name: "code with terminator", spec: codeSpec, keys: "123#", want: "123"},
+		{name: "clear key", spec: codeSpec, keys: "12*34#", want: "34"},
+		{name: "accepted on inter digit timeout", spec: codeSpec, keys: "12\x00", want: "12"},
+		{name: "max length", spec: InputSpec{MaxLength: 3, InterDigitTimeout: time.Second}, keys: "123", want: "123"},
+		{name: "too short, then valid", spec: codeSpec, keys: "1#12#", want: "12"},
+		{name: "terminator only, then valid", spec: codeSpec, keys: "##12#", want: "12"},
+		{name: "timeout, then valid", spec: codeSpec, keys: "1\x0012#", want: "12"},
+		{name: "too short in all attempts", spec: codeSpec, keys: "1#\x00", attempts: 2},
+		{name: "input too short in last attempt", spec: codeSpec, keys: "\x001#", invalid: true},
+		{name: "no retries", spec: MoveInputSpec, keys: "\x00\x00\x00\x00", attempts: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &fakeKeyReader{keys: []rune(tt.keys)}
+			got, err := tt.spec.Read(reader.read)
+
+			var timeoutErr *InputTimeoutError
+			switch {
+			case tt.attempts > 0:
+				if !errors.As(err, &timeoutErr) || timeoutErr.Attempts != tt.attempts {
+					t.Fatalf("got %q, %v, want a timeout after %d attempts", got, err, tt.attempts)
+				}
+			case tt.invalid:
+				if !errors.Is(err, ErrInvalidInput) {
+					t.Fatalf("got %q, %v, want %v", got, err, ErrInvalidInput)
+				}
+			case err != nil || got != tt.want:
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+			if len(reader.keys) > 0 {
+				t.Fatalf("keys %q were not read", string(reader.keys))
+			}
+		})
+	}
+}
+
+func TestInputSpecReadTimeouts(t *testing.T) {
+	t.Run("inter digit timeout", func(t *testing.T) {
+		reader := &fakeKeyReader{keys: []rune("12#")}
+		spec := InputSpec{InterDigitTimeout: time.Second * 3, Terminator: '#'}
+		if _, err := spec.Read(reader.read); err != nil {
+			t.Fatal(err)
+		}
+		for _, wait := range reader.waits {
+			if wait != time.Second*3 {
+				t.Fatalf("waited %v for a key, want the inter digit timeout", wait)
+			}
+		}
+	})
+
+	t.Run("no timeouts poll for hangups", func(t *testing.T) {
+		reader := &fakeKeyReader{keys: []rune("\x00\x001#")}
+		spec := InputSpec{Terminator: '#'}
+		got, err := spec.Read(reader.read)
+		if err != nil || got != "1" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+		for _, wait := range reader.waits {
+			if wait != inputPollInterval {
+				t.Fatalf("waited %v for a key, want %v", wait, inputPollInterval)
+			}
+		}
+	})
+
+	t.Run("overall timeout limits the wait", func(t *testing.T) {
+		// Without an inter digit timeout, only the overall timeout ends the attempt.
+		reader := &fakeKeyReader{keys: []rune("\x00")}
+		spec := InputSpec{Timeout: time.Millisecond * 10, Terminator: '#'}
+		_, err := spec.Read(reader.read)
+		var timeoutErr *InputTimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Attempts != 1 {
+			t.Fatalf("got %v, want a timeout after 1 attempt", err)
+		}
+		if len(reader.waits) != 1 || reader.waits[0] > spec.Timeout {
+			t.Fatalf("waited %v, want at most the overall timeout", reader.waits)
+		}
+	})
+
+	t.Run("overall timeout keeps entered keys", func(t *testing.T) {
+		reader := &fakeKeyReader{keys: []rune("12")}
+		spec := InputSpec{Timeout: time.Millisecond * 10, InterDigitTimeout: time.Second, Terminator: '#'}
+		// The reader takes longer than the overall timeout.
+		read := func(timeout time.Duration) (rune, error) {
+			time.Sleep(time.Millisecond * 10)
+			return reader.read(timeout)
+		}
+		_, err := spec.Read(read)
+		var timeoutErr *InputTimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Keys != "1" {
+			t.Fatalf("got %v, want a timeout with the keys entered so far", err)
+		}
+	})
+
+	t.Run("reader errors are returned", func(t *testing.T) {
+		errHungUp := errors.New("hung up")
+		spec := MoveInputSpec
+		_, err := spec.Read(func(time.Duration) (rune, error) { return 0, errHungUp })
+		if !errors.Is(err, errHungUp) {
+			t.Fatalf("got %v, want %v", err, errHungUp)
+		}
+	})
+}
+
+func TestInputSpecQuery(t *testing.T) {
+	clientSpec := CodeInputSpec
+
+	for _, spec := range []InputSpec{
+		MoveInputSpec,
+		answerInputSpec,
+		{MinLength: 2, MaxLength: 3},
+	} {
+		q := url.Values{}
+		spec.addKeysToQuery(q)
+		got, err := clientSpec.withKeysFromQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.MinLength != spec.MinLength ||
+			got.MaxLength != spec.MaxLength ||
+			got.Terminator != spec.Terminator ||
+			got.ClearKey != spec.ClearKey ||
+			got.CommandKey != spec.CommandKey {
+			t.Fatalf("got keys %+v, want %+v", got, spec)
+		}
+		// Timeouts and retries are left to the client.
+		if got.InterDigitTimeout != clientSpec.InterDigitTimeout || got.MaxRetries != clientSpec.MaxRetries {
+			t.Fatalf("query changed the timeouts of the client: %+v", got)
+		}
+	}
+
+	// Servers that only support single digits do not send the keys.
+	if got, err := clientSpec.withKeysFromQuery(url.Values{}); err != nil || got != clientSpec {
+		t.Fatalf("got %+v, %v, want the unchanged spec", got, err)
+	}
+
+	for _, q := range []url.Values{
+		{"maxLength": {"x"}, "minLength": {"1"}},
+		{"maxLength": {"1"}, "minLength": {""}},
+		{"maxLength": {"1"}, "minLength": {"1"}, "terminator": {"##"}},
+	} {
+		if _, err := clientSpec.withKeysFromQuery(q); err == nil {
+			t.Errorf("accepted invalid query %v", q)
+		}
+	}
+}
+
+func TestParseInputSpec(t *testing.T) {
+	got, err := ParseInputSpec("digit-timeout=10s,timeout=1m,min=2,max=3,retries=0,terminator=,clear=#,command=", MoveInputSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := InputSpec{
+		Timeout:           time.Minute,
+		InterDigitTimeout: time.Second * 10,
+		MinLength:         2,
+		MaxLength:         3,
+		ClearKey:          '#',
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if got, err := ParseInputSpec("", CodeInputSpec); err != nil || got != CodeInputSpec {
+		t.Fatalf("got %+v and %v, want the unchanged spec", got, err)
+	}
+
+	for _, s := range []string{"min", "max=x", "timeout=10", "terminator=a", "clear=**", "length=2"} {
+		if _, err := ParseInputSpec(s, MoveInputSpec); err == nil {
+			t.Errorf("parsed %q", s)
+		}
+	}
+}
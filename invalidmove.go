@@ -0,0 +1,64 @@
+package voipttt
+
+import (
+	"fmt"
+)
+
+// InvalidMovePolicy is what happens when a player enters a move that is not possible,
+// e.g. a field that is already taken or keys that are not a field at all.
+type InvalidMovePolicy string
+
+const (
+	// InvalidMoveReprompt asks the player for another move. After too many invalid
+	// moves in the same turn, a random move is made for the player.
+	InvalidMoveReprompt InvalidMovePolicy = "reprompt"
+	// InvalidMoveRandom makes a random move for the player.
+	InvalidMoveRandom InvalidMovePolicy = "random"
+	// InvalidMoveForfeit ends the game, the player loses.
+	InvalidMoveForfeit InvalidMovePolicy = "forfeit"
+)
+
+// ParseInvalidMovePolicy returns the policy of the given name.
+func ParseInvalidMovePolicy(name string) (InvalidMovePolicy, error) {
+	switch p := InvalidMovePolicy(name); p {
+	case InvalidMoveReprompt, InvalidMoveRandom, InvalidMoveForfeit:
+		return p, nil
+	}
+	return "", fmt.Errorf(
+		"unknown policy %q, expected %s, %s or %s",
+		name,
+		InvalidMoveReprompt,
+		InvalidMoveRandom,
+		InvalidMoveForfeit,
+	)
+}
+
+// InvalidMoveConfig configures how a game handles invalid moves.
+type InvalidMoveConfig struct {
+	Policy InvalidMovePolicy
+	// Reprompts is how often a player is asked for another move in the same turn
+	// with InvalidMoveReprompt.
+	Reprompts int
+}
+
+// defaultInvalidMoveConfig is used for games without their own configuration.
+var defaultInvalidMoveConfig = InvalidMoveConfig{
+	Policy:    InvalidMoveReprompt,
+	Reprompts: 3,
+}
+
+// WithInvalidMovePolicy configures how the game of the given name handles invalid moves.
+// Games without configuration ask the player up to three times for another move.
+func WithInvalidMovePolicy(gameType string, config InvalidMoveConfig) ServerOption {
+	return func(s *Server) {
+		s.wsManager.invalidMoves[gameType] = config
+	}
+}
+
+// action returns what happens after the given number of invalid moves in the same turn.
+func (c InvalidMoveConfig) action(invalidMoves int) InvalidMovePolicy {
+	if c.Policy == InvalidMoveReprompt && invalidMoves > c.Reprompts {
+		return InvalidMoveRandom
+	}
+	return c.Policy
+}
@@ -0,0 +1,70 @@
+package voipttt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInvalidMoveReprompt(t *testing.T) {
+	// Player two enters invalid moves until a random move is made for them,
+	// then player one resigns.
+	one := newTestCall(scriptedKeys("1", "*1"))
+	two := newTestCall(scriptedKeys("1", "10", "1"))
+	_, browserTwo := runTestGame(t, one, two, InvalidMoveConfig{Policy: InvalidMoveReprompt, Reprompts: 2})
+
+	var actions []InvalidMovePolicy
+	for _, data := range two.announced(string(messageInvalidMove)) {
+		actions = append(actions, data.(*dataInvalidMove).Action)
+	}
+	want := []InvalidMovePolicy{InvalidMoveReprompt, InvalidMoveReprompt, InvalidMoveRandom}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("got actions %v, want %v", actions, want)
+	}
+
+	turns := received[dataTurnInfo](t, browserTwo, messageTurnInfo)
+	if len(turns) != 2 || turns[1].Move == "1" || !turns[1].IsPlayer {
+		t.Fatalf("got turn infos %+v, want a random move of player two", turns)
+	}
+	if data := gameDone(t, two); data.Reason != gameDoneResign || !data.IsPlayerWinner {
+		t.Fatalf("got %+v, want player two to win by resignation", data)
+	}
+}
+
+func TestInvalidMoveRandom(t *testing.T) {
+	one := newTestCall(scriptedKeys("5", "*1"))
+	two := newTestCall(scriptedKeys("5"))
+	_, browserTwo := runTestGame(t, one, two, InvalidMoveConfig{Policy: InvalidMoveRandom})
+
+	if invalid := two.announced(string(messageInvalidMove)); len(invalid) != 1 || invalid[0].(*dataInvalidMove).Action != InvalidMoveRandom {
+		t.Fatalf("got INVALID_MOVE announcements %+v, want a random move", invalid)
+	}
+	turns := received[dataTurnInfo](t, browserTwo, messageTurnInfo)
+	if len(turns) != 2 || turns[1].Move == "5" || turns[1].Move == "" {
+		t.Fatalf("got turn infos %+v, want a random move of player two", turns)
+	}
+}
+
+func TestInvalidMoveForfeit(t *testing.T) {
+	one := newTestCall(scriptedKeys("5"))
+	two := newTestCall(scriptedKeys("5"))
+	_, browserTwo := runTestGame(t, one, two, InvalidMoveConfig{Policy: InvalidMoveForfeit})
+
+	for _, tc := range []struct {
+		call   *testCall
+		winner bool
+	}{{one, true}, {two, false}} {
+		if data := gameDone(t, tc.call); data.Reason != gameDoneInvalidMove || data.IsPlayerWinner != tc.winner {
+			t.Fatalf("got %+v, want an invalid move with IsPlayerWinner %v", data, tc.winner)
+		}
+	}
+
+	// The browser learns which move was rejected and why.
+	invalid := received[dataInvalidMove](t, browserTwo, messageInvalidMove)
+	if len(invalid) != 1 {
+		t.Fatalf("got %d INVALID_MOVE messages, want 1", len(invalid))
+	}
+	if invalid[0].Move != "5" || invalid[0].Action != InvalidMoveForfeit || !strings.Contains(invalid[0].Reason, "already taken") {
+		t.Fatalf("got %+v, want the taken field 5 to forfeit the game", invalid[0])
+	}
+}
@@ -0,0 +1,171 @@
+package voipttt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GameGomoku is the name of Gomoku, five in a row on a board of 15 × 15 fields.
+const GameGomoku = "gomoku"
+
+// mnkGame is an m,n,k-game, in which players take turns to place their mark on a
+// board of m columns and n rows and the first player with k marks in a row wins.
+// Tic-Tac-Toe is the 3,3,3-game, Gomoku the 15,15,5-game.
+//
+// A move is the row and the column of a field, both counted from 1 and separated
+// by a star, e.g. `3*12`. The move is submitted with #.
+type mnkGame struct {
+	grid   grid
+	k      int
+	turn   Player
+	winner Player
+	// history are the zero based rows and columns of all moves as row*cols+col,
+	// -1 for a skipped turn.
+	history []int
+}
+
+// NewMNKGame returns a function that creates m,n,k-games with m columns, n rows
+// and k marks in a row to win, which can be registered with RegisterGame.
+func NewMNKGame(m, n, k int) NewGameFunc {
+	return func() Game {
+		return &mnkGame{
+			grid: newGrid(n, m),
+			k:    k,
+		}
+	}
+}
+
+// mnkGameState is the state of the game as it is shown on the website.
+type mnkGameState struct {
+	gridState
+	// InARow is the number of marks in a row that win the game.
+	InARow int `json:"inARow"`
+}
+
+func (g *mnkGame) Turn() Player {
+	if g.turn == PlayerNone {
+		return PlayerOne
+	}
+	return g.turn
+}
+
+// Moves returns the free fields.
+func (g *mnkGame) Moves() []string {
+	if g.Outcome().Done {
+		return nil
+	}
+	var moves []string
+	for row := 0; row < g.grid.rows; row++ {
+		for col := 0; col < g.grid.cols; col++ {
+			if g.grid.at(row, col) == PlayerNone {
+				moves = append(moves, mnkMove(row, col))
+			}
+		}
+	}
+	return moves
+}
+
+func (g *mnkGame) Play(move string) error {
+	rowKeys, colKeys, ok := strings.Cut(move, "*")
+	if !ok {
+		return fmt.Errorf("%w: %q is not a row and a column separated by *", ErrInvalidMove, move)
+	}
+	row, rowErr := strconv.Atoi(rowKeys)
+	col, colErr := strconv.Atoi(colKeys)
+	if rowErr != nil || colErr != nil || !g.grid.contains(row-1, col-1) {
+		return fmt.Errorf("%w: %q is not a field", ErrInvalidMove, move)
+	}
+	row, col = row-1, col-1
+
+	if g.Outcome().Done {
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	}
+	if g.grid.at(row, col) != PlayerNone {
+		return fmt.Errorf("%w: field %s is already taken", ErrIllegalMove, move)
+	}
+
+	player := g.Turn()
+	g.grid.set(row, col, player)
+	if g.grid.inRow(row, col, g.k) {
+		g.winner = player
+	}
+	g.turn = player.Opponent()
+	g.history = append(g.history, row*g.grid.cols+col)
+	return nil
+}
+
+func (g *mnkGame) Skip() {
+	g.turn = g.Turn().Opponent()
+	g.history = append(g.history, -1)
+}
+
+func (g *mnkGame) Undo() bool {
+	if len(g.history) == 0 {
+		return false
+	}
+	field := g.history[len(g.history)-1]
+	g.history = g.history[:len(g.history)-1]
+	if field >= 0 {
+		// The game can not go on after a win, so the latest move was not won before.
+		g.grid.fields[field] = PlayerNone
+		g.winner = PlayerNone
+	}
+	g.turn = g.Turn().Opponent()
+	return true
+}
+
+func (g *mnkGame) Outcome() Outcome {
+	return Outcome{
+		Done:   g.winner != PlayerNone || g.grid.full(),
+		Winner: g.winner,
+	}
+}
+
+func (g *mnkGame) State() any {
+	state := &mnkGameState{
+		gridState: g.grid.state(),
+		InARow:    g.k,
+	}
+	state.Labels = make([]string, len(state.Fields))
+	for i := range state.Labels {
+		state.Labels[i] = mnkMove(i/g.grid.cols, i%g.grid.cols)
+	}
+	return state
+}
+
+// Input uses the star as separator, so the input can not be cleared and
+// must be submitted with #.
+func (g *mnkGame) Input() InputSpec {
+	spec := MoveInputSpec
+	spec.MaxLength = 0
+	spec.ClearKey = 0
+	return spec
+}
+
+// Fields returns only the taken fields, because announcing every free field
+// of a large board takes too long.
+func (g *mnkGame) Fields() []field {
+	var fields []field
+	for i, owner := range g.grid.fields {
+		if owner != PlayerNone {
+			fields = append(fields, field{
+				Move:  mnkMove(i/g.grid.cols, i%g.grid.cols),
+				Owner: owner,
+			})
+		}
+	}
+	return fields
+}
+
+func (g *mnkGame) Clone() Game {
+	clone := *g
+	clone.grid = g.grid.clone()
+	clone.history = append([]int(nil), g.history...)
+	return &clone
+}
+
+// mnkMove returns the move that selects the field at the zero based row and column.
+func mnkMove(row, col int) string {
+	return fmt.Sprintf("%d*%d", row+1, col+1)
+}
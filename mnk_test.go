@@ -0,0 +1,104 @@
+package voipttt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMNKGameParsesMoves(t *testing.T) {
+	// Four columns and three rows.
+	newGame := NewMNKGame(4, 3, 3)
+
+	tests := []struct {
+		move     string
+		row, col int
+		err      error
+	}{
+		{move: "1*1", row: 0, col: 0},
+		{move: "3*4", row: 2, col: 3},
+		{move: "2*03", row: 1, col: 2},
+		{move: "4*3", err: ErrInvalidMove},
+		{move: "0*1", err: ErrInvalidMove},
+		{move: "1*0", err: ErrInvalidMove},
+		{move: "11", err: ErrInvalidMove},
+		{move: "1*", err: ErrInvalidMove},
+		{move: "*1", err: ErrInvalidMove},
+		{move: "1*2*3", err: ErrInvalidMove},
+		{move: "", err: ErrInvalidMove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.move, func(t *testing.T) {
+			g := newGame().(*mnkGame)
+			err := g.Play(tt.move)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := g.grid.at(tt.row, tt.col); got != PlayerOne {
+				t.Fatalf("got %v at row %d and column %d, want %v", got, tt.row, tt.col, PlayerOne)
+			}
+		})
+	}
+}
+
+func TestMNKGameWin(t *testing.T) {
+	g := NewMNKGame(15, 15, 5)()
+	// Player one places a diagonal from 3*3 to 7*7, player two stays in row 1.
+	playMoves(t, g, "3*3", "1*1", "4*4", "1*2", "5*5", "1*3", "6*6", "1*4")
+	if g.Outcome().Done {
+		t.Fatal("game is over with four in a row")
+	}
+
+	playMoves(t, g, "7*7")
+	if outcome := g.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerOne}) {
+		t.Fatalf("got %+v, want a win of %v", outcome, PlayerOne)
+	}
+	if err := g.Play("1*5"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestMNKGameDraw(t *testing.T) {
+	g := NewMNKGame(3, 3, 3)()
+	playMoves(t, g, "1*1", "1*2", "1*3", "2*2", "2*1", "2*3", "3*2", "3*1", "3*3")
+
+	if outcome := g.Outcome(); outcome != (Outcome{Done: true}) {
+		t.Fatalf("got %+v, want a draw", outcome)
+	}
+}
+
+func TestMNKGameIllegalMove(t *testing.T) {
+	g := NewMNKGame(15, 15, 5)()
+	playMoves(t, g, "8*8")
+
+	if err := g.Play("8*8"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	if g.Turn() != PlayerTwo {
+		t.Fatalf("got turn %v after an illegal move, want %v", g.Turn(), PlayerTwo)
+	}
+}
+
+func TestMNKGameUndo(t *testing.T) {
+	g := NewMNKGame(3, 3, 3)().(*mnkGame)
+	playMoves(t, g, "1*1", "2*1", "1*2", "2*2", "1*3")
+	g.Skip()
+
+	if !g.Undo() || g.Turn() != PlayerTwo || g.Outcome().Winner != PlayerOne {
+		t.Fatalf("got turn %v and %+v after undoing the skip", g.Turn(), g.Outcome())
+	}
+	if !g.Undo() || g.Turn() != PlayerOne || g.Outcome().Done || g.grid.at(0, 2) != PlayerNone {
+		t.Fatalf("got turn %v and %+v after undoing the winning move", g.Turn(), g.Outcome())
+	}
+	for g.Undo() {
+	}
+	if len(g.Fields()) != 0 || g.Turn() != PlayerOne {
+		t.Fatalf("got fields %v and turn %v after undoing all moves", g.Fields(), g.Turn())
+	}
+}
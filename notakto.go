@@ -0,0 +1,183 @@
+package voipttt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GameNotakto is the name of Notakto on three boards.
+const GameNotakto = "notakto"
+
+// notaktoBoards is the number of boards Notakto is played on.
+const notaktoBoards = 3
+
+// notakto is a game of Notakto, Tic-Tac-Toe in which both players place X on several
+// boards. A board with three X in a row is dead and can not be played anymore.
+// The player who kills the last board loses, so there is no draw.
+//
+// A move consists of two digits, the board and its field from 1 to 9.
+type notakto struct {
+	// boards contain the X of both players as PlayerOne, so that lines are found
+	// regardless of who placed them.
+	boards []ticTacToe
+	// placedBy is the player who placed each X, which is only shown on the website.
+	placedBy [][9]Player
+	// killedBy is the player who completed a line on each board.
+	killedBy []Player
+	turn     Player
+	// history are the zero based board and field of all moves as board*9+field,
+	// -1 for a skipped turn.
+	history []int
+}
+
+func newNotakto() Game {
+	return &notakto{
+		boards:   make([]ticTacToe, notaktoBoards),
+		placedBy: make([][9]Player, notaktoBoards),
+		killedBy: make([]Player, notaktoBoards),
+	}
+}
+
+func (n *notakto) Turn() Player {
+	if n.turn == PlayerNone {
+		return PlayerOne
+	}
+	return n.turn
+}
+
+// Moves returns the free fields of all boards that are still alive.
+func (n *notakto) Moves() []string {
+	var moves []string
+	for b := range n.boards {
+		if n.killedBy[b] != PlayerNone {
+			continue
+		}
+		for _, f := range n.boards[b].Moves() {
+			moves = append(moves, strconv.Itoa(b+1)+f)
+		}
+	}
+	return moves
+}
+
+func (n *notakto) Play(move string) error {
+	if len(move) != 2 || move[0] < '1' || int(move[0]-'0') > len(n.boards) || move[1] < '1' || move[1] > '9' {
+		return fmt.Errorf("%w: %q is not a board followed by a field", ErrInvalidMove, move)
+	}
+	board, cell := int(move[0]-'1'), int(move[1]-'1')
+
+	switch {
+	case n.Outcome().Done:
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	case n.killedBy[board] != PlayerNone:
+		return fmt.Errorf("%w: board %d is dead", ErrIllegalMove, board+1)
+	case !n.boards[board].selectField(cell, PlayerOne):
+		return fmt.Errorf("%w: field %d of board %d is already taken", ErrIllegalMove, cell+1, board+1)
+	}
+
+	player := n.Turn()
+	n.placedBy[board][cell] = player
+	if _, _, ok := n.boards[board].hasWinner(); ok {
+		n.killedBy[board] = player
+	}
+	n.turn = player.Opponent()
+	n.history = append(n.history, board*9+cell)
+	return nil
+}
+
+func (n *notakto) Skip() {
+	n.turn = n.Turn().Opponent()
+	n.history = append(n.history, -1)
+}
+
+func (n *notakto) Undo() bool {
+	if len(n.history) == 0 {
+		return false
+	}
+	move := n.history[len(n.history)-1]
+	n.history = n.history[:len(n.history)-1]
+	if move >= 0 {
+		board, cell := move/9, move%9
+		n.boards[board].fields[cell] = PlayerNone
+		n.placedBy[board][cell] = PlayerNone
+		// A dead board is not played anymore, so the latest move on it killed it.
+		n.killedBy[board] = PlayerNone
+	}
+	n.turn = n.Turn().Opponent()
+	return true
+}
+
+// Outcome is done once all boards are dead. The player who killed the last board
+// made the last move and loses.
+func (n *notakto) Outcome() Outcome {
+	for _, killer := range n.killedBy {
+		if killer == PlayerNone {
+			return Outcome{}
+		}
+	}
+	return Outcome{
+		Done:   true,
+		Winner: n.Turn(),
+	}
+}
+
+func (n *notakto) Variant() string {
+	return variantNotakto
+}
+
+// State arranges the boards next to each other.
+func (n *notakto) State() any {
+	cols := 3 * len(n.boards)
+	state := &smallBoardsState{
+		gridState: gridState{
+			Rows:   3,
+			Cols:   cols,
+			Fields: make([]Player, 0, 3*cols),
+			Labels: make([]string, 0, 3*cols),
+		},
+		Boards: append([]Player(nil), n.killedBy...),
+	}
+	for row := 0; row < 3; row++ {
+		for col := 0; col < cols; col++ {
+			board, cell := col/3, row*3+col%3
+			state.Fields = append(state.Fields, n.placedBy[board][cell])
+			state.Labels = append(state.Labels, fmt.Sprintf("%d%d", board+1, cell+1))
+		}
+	}
+	return state
+}
+
+// Input expects two keys, but accepts a single one, so that the board can
+// still be requested with 0.
+func (n *notakto) Input() InputSpec {
+	spec := MoveInputSpec
+	spec.MaxLength = 2
+	return spec
+}
+
+// Fields returns the fields of all boards that are still alive. Because both players
+// place X, taken fields are marked without an owner.
+func (n *notakto) Fields() []field {
+	var fields []field
+	for b := range n.boards {
+		if n.killedBy[b] != PlayerNone {
+			continue
+		}
+		for _, f := range n.boards[b].Fields() {
+			fields = append(fields, field{
+				Move:   strconv.Itoa(b+1) + f.Move,
+				Marked: f.Owner != PlayerNone,
+			})
+		}
+	}
+	return fields
+}
+
+func (n *notakto) Clone() Game {
+	return &notakto{
+		boards:   append([]ticTacToe(nil), n.boards...),
+		placedBy: append([][9]Player(nil), n.placedBy...),
+		killedBy: append([]Player(nil), n.killedBy...),
+		turn:     n.turn,
+		history:  append([]int(nil), n.history...),
+	}
+}
@@ -0,0 +1,71 @@
+package voipttt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNotaktoFieldsAreMarkedWithoutOwner(t *testing.T) {
+	n := newNotakto().(*notakto)
+	playMoves(t, n, "15", "21")
+
+	for _, f := range n.Fields() {
+		if f.Owner != PlayerNone {
+			t.Fatalf("got owner %v of field %s", f.Owner, f.Move)
+		}
+		if want := f.Move == "15" || f.Move == "21"; f.Marked != want {
+			t.Fatalf("got marked %v for field %s, want %v", f.Marked, f.Move, want)
+		}
+	}
+}
+
+func TestNotaktoLastBoardLoses(t *testing.T) {
+	n := newNotakto().(*notakto)
+	playMoves(t, n, "11", "12", "13")
+
+	if n.killedBy[0] != PlayerOne {
+		t.Fatalf("got board 1 killed by %v, want %v", n.killedBy[0], PlayerOne)
+	}
+	if err := n.Play("14"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	for _, move := range n.Moves() {
+		if strings.HasPrefix(move, "1") {
+			t.Fatalf("got move %q on dead board 1", move)
+		}
+	}
+
+	playMoves(t, n, "21", "22", "23", "31", "32")
+	if n.Outcome().Done {
+		t.Fatal("game is over while board 3 is alive")
+	}
+	playMoves(t, n, "33")
+	if outcome := n.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerTwo}) {
+		t.Fatalf("got %+v, want a win of %v", outcome, PlayerTwo)
+	}
+}
+
+func TestNotaktoInvalidMoves(t *testing.T) {
+	for _, move := range []string{"", "1", "41", "10", "123"} {
+		if err := newNotakto().Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+
+	n := newNotakto()
+	playMoves(t, n, "15")
+	if err := n.Play("15"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestNotaktoUndo(t *testing.T) {
+	n := newNotakto().(*notakto)
+	playMoves(t, n, "11", "12", "13")
+
+	if !n.Undo() || n.Turn() != PlayerOne || n.killedBy[0] != PlayerNone || n.placedBy[0][2] != PlayerNone {
+		t.Fatalf("got turn %v and board 1 killed by %v after undoing the killing move", n.Turn(), n.killedBy[0])
+	}
+	playMoves(t, n, "14")
+}
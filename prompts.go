@@ -0,0 +1,361 @@
+package voipttt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Sound files of the voice prompts, relative to the sounds directory of the telephony
+// provider and without extension. The comments contain the text of each prompt.
+const (
+	SoundEnterCode                = "voipttt/enter-code"                 // "Please enter the code shown on the website, followed by the hash key."
+	SoundWaitForOpponent          = "voipttt/wait-for-opponent"          // "Waiting for an opponent."
+	SoundOpponentFound            = "voipttt/opponent-found"             // "An opponent has been found."
+	SoundYourTurn                 = "voipttt/your-turn"                  // "It's your turn. Press 0 to hear the board."
+	SoundOpponentsTurn            = "voipttt/opponents-turn"             // "It's your opponent's turn."
+	SoundYouChose                 = "voipttt/you-chose"                  // "You chose field"
+	SoundOpponentChose            = "voipttt/opponent-chose"             // "Your opponent chose field"
+	SoundInvalidMove              = "voipttt/invalid-move"               // "This move is not possible."
+	SoundTryAgain                 = "voipttt/try-again"                  // "Please try again."
+	SoundOpponentInvalidMove      = "voipttt/opponent-invalid-move"      // "Your opponent entered an invalid move."
+	SoundTimeUp                   = "voipttt/time-up"                    // "Your time is up."
+	SoundOpponentTimeUp           = "voipttt/opponent-time-up"           // "Your opponent ran out of time."
+	SoundRandomMove               = "voipttt/random-move"                // "A random field is chosen."
+	SoundTurnSkipped              = "voipttt/turn-skipped"               // "The turn is skipped."
+	SoundDrawOffered              = "voipttt/draw-offered"               // "You offered a draw, waiting for your opponent."
+	SoundOpponentOffersDraw       = "voipttt/opponent-offers-draw"       // "Your opponent offers a draw. Press 1 to accept or 2 to decline."
+	SoundDrawDeclined             = "voipttt/draw-declined"              // "Your opponent declined the draw."
+	SoundOpponentResigned         = "voipttt/opponent-resigned"          // "Your opponent resigned."
+	SoundTakebackRequested        = "voipttt/takeback-requested"         // "You asked to take back your last move, waiting for your opponent."
+	SoundOpponentRequestsTakeback = "voipttt/opponent-requests-takeback" // "Your opponent asks to take back their last move. Press 1 to accept or 2 to decline."
+	SoundTakebackAccepted         = "voipttt/takeback-accepted"          // "The last move was taken back."
+	SoundTakebackDeclined         = "voipttt/takeback-declined"          // "Your opponent declined the takeback."
+	SoundNoTakeback               = "voipttt/no-takeback"                // "There is no move to take back."
+	SoundPrepareBoard             = "voipttt/prepare-board"              // "Prepare your board on the website."
+	SoundGameBegins               = "voipttt/game-begins"                // "Both players are ready, the game begins."
+	SoundHit                      = "voipttt/hit"                        // "Hit!"
+	SoundMiss                     = "voipttt/miss"                       // "Miss."
+	SoundSunk                     = "voipttt/sunk"                       // "Hit and sunk!"
+	SoundFieldEmpty               = "voipttt/field-empty"                // "is empty"
+	SoundFieldPlayer              = "voipttt/field-player"               // "is yours"
+	SoundFieldOpponent            = "voipttt/field-opponent"             // "is your opponent's"
+	SoundFieldMarked              = "voipttt/field-marked"               // "is marked"
+	SoundYouWin                   = "voipttt/you-win"                    // "You win!"
+	SoundYouLose                  = "voipttt/you-lose"                   // "You lose."
+	SoundDraw                     = "voipttt/draw"                       // "The game ends in a draw."
+	SoundOpponentHungUp           = "voipttt/opponent-hung-up"           // "Your opponent hung up."
+	SoundSeriesScore              = "voipttt/series-score"               // "The score is"
+	SoundScoreTo                  = "voipttt/score-to"                   // "to"
+	SoundYouWinSeries             = "voipttt/you-win-series"             // "You win the series!"
+	SoundYouLoseSeries            = "voipttt/you-lose-series"            // "You lose the series."
+	SoundSeriesDraw               = "voipttt/series-draw"                // "The series ends in a draw."
+	SoundNextGame                 = "voipttt/next-game"                  // "The next game begins, you switch sides."
+	SoundRematchVote              = "voipttt/rematch-vote"               // "Press 1 to play again or 2 to hang up."
+	SoundRematchDeclined          = "voipttt/rematch-declined"           // "Your opponent does not want to play again."
+	SoundGoodbye                  = "voipttt/goodbye"                    // "Thanks for playing, goodbye."
+)
+
+// readBoardDigit is the digit a player enters instead of a field to hear the board.
+// In games with moves of more than one key it must be submitted with the terminator,
+// commandReadBoard reads the board at once in every game.
+const readBoardDigit = 0
+
+// Commands a player enters instead of a move, see InputSpec.CommandKey.
+const (
+	commandReadBoard = "*0"
+	commandResign    = "*1"
+	commandOfferDraw = "*2"
+	commandTakeback  = "*3"
+)
+
+// Keys that answer a request of the opponent, e.g. a draw offer.
+const (
+	answerAccept  = "1"
+	answerDecline = "2"
+)
+
+// Types of announcements that have no web socket message counterpart.
+const (
+	announceBoard     = "BOARD"
+	announceSetupDone = "SETUP_DONE"
+	announceGoodbye   = "GOODBYE"
+)
+
+// Prompt is a single part of a voice prompt that is played to the caller.
+// Exactly one of the fields is set.
+type Prompt struct {
+	// Sound is the name of a sound file, see the Sound constants.
+	Sound string
+	// Digits are spoken one by one.
+	Digits string
+}
+
+// boardField is the owner of a field from the perspective of the announced player.
+type boardField string
+
+const (
+	boardFieldEmpty    boardField = "EMPTY"
+	boardFieldPlayer   boardField = "PLAYER"
+	boardFieldOpponent boardField = "OPPONENT"
+	boardFieldMarked   boardField = "MARKED"
+)
+
+// dataAnnounceTurnInfo is the TURN_INFO web socket message extended by whether
+// the turn ended the game, in which case the next turn is not announced.
+type dataAnnounceTurnInfo struct {
+	dataTurnInfo
+	IsGameDone bool `json:"isGameDone"`
+}
+
+type dataAnnounceSetupDone struct {
+	PlayerHasFirstTurn bool `json:"playerHasFirstTurn"`
+}
+
+type dataAnnounceBoard struct {
+	Fields []dataAnnounceField `json:"fields"`
+}
+
+type dataAnnounceField struct {
+	Move  string     `json:"move"`
+	Owner boardField `json:"owner"`
+}
+
+// announcementRequest is an announcement as received by the announce webhook.
+type announcementRequest struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// prompts returns the voice prompts that announce the event to the caller.
+func (a announcementRequest) prompts() ([]Prompt, error) {
+	sounds := func(names ...string) []Prompt {
+		prompts := make([]Prompt, len(names))
+		for i, name := range names {
+			prompts[i] = Prompt{Sound: name}
+		}
+		return prompts
+	}
+
+	switch a.Type {
+	case string(messageSendWaitForOpponent):
+		return sounds(SoundWaitForOpponent), nil
+
+	case string(messageOpponentReady):
+		var data dataOpponentReady
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		start := SoundOpponentFound
+		if s := data.Series; s != nil && (s.Games > 0 || s.Series > 1) {
+			start = SoundNextGame
+		}
+		switch {
+		case data.NeedsSetup:
+			// The turn is announced once the setup is done.
+			return sounds(start, SoundPrepareBoard), nil
+		case data.PlayerHasFirstTurn:
+			return sounds(start, SoundYourTurn), nil
+		default:
+			return sounds(start, SoundOpponentsTurn), nil
+		}
+
+	case announceSetupDone:
+		var data dataAnnounceSetupDone
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		if data.PlayerHasFirstTurn {
+			return sounds(SoundGameBegins, SoundYourTurn), nil
+		}
+		return sounds(SoundGameBegins, SoundOpponentsTurn), nil
+
+	case string(messageTurnInfo):
+		var data dataAnnounceTurnInfo
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		digit := Prompt{Digits: data.Move}
+		var result []Prompt
+		switch data.Result {
+		case shotHit:
+			result = sounds(SoundHit)
+		case shotMiss:
+			result = sounds(SoundMiss)
+		case shotSunk:
+			result = sounds(SoundSunk)
+		}
+		var prompts []Prompt
+		if data.TimeUp {
+			timeUp, policy := SoundOpponentTimeUp, SoundRandomMove
+			if data.IsPlayer {
+				timeUp = SoundTimeUp
+			}
+			if data.Move == "" {
+				policy = SoundTurnSkipped
+			}
+			prompts = sounds(timeUp, policy)
+		}
+		switch {
+		case data.Move == "" && data.IsPlayer:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentsTurn})
+		case data.Move == "":
+			prompts = append(prompts, Prompt{Sound: SoundYourTurn})
+		case data.IsPlayer:
+			prompts = append(prompts, Prompt{Sound: SoundYouChose}, digit)
+			prompts = append(prompts, result...)
+			if !data.IsGameDone {
+				prompts = append(prompts, Prompt{Sound: SoundOpponentsTurn})
+			}
+		default:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentChose}, digit)
+			prompts = append(prompts, result...)
+			if !data.IsGameDone {
+				prompts = append(prompts, Prompt{Sound: SoundYourTurn})
+			}
+		}
+		return prompts, nil
+
+	case string(messageDrawOffered):
+		var data dataDrawOffer
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		if data.IsPlayer {
+			return sounds(SoundDrawOffered), nil
+		}
+		return sounds(SoundOpponentOffersDraw), nil
+
+	case string(messageDrawDeclined):
+		var data dataDrawOffer
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		if data.IsPlayer {
+			return sounds(SoundDrawDeclined, SoundYourTurn), nil
+		}
+		return sounds(SoundOpponentsTurn), nil
+
+	case string(messageTakebackRequested), string(messageTakebackAccepted), string(messageTakebackDeclined):
+		var data dataTakeback
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		switch {
+		case a.Type == string(messageTakebackRequested) && data.IsPlayer:
+			return sounds(SoundTakebackRequested), nil
+		case a.Type == string(messageTakebackRequested):
+			return sounds(SoundOpponentRequestsTakeback), nil
+		case a.Type == string(messageTakebackAccepted) && data.IsPlayer:
+			return sounds(SoundTakebackAccepted, SoundYourTurn), nil
+		case a.Type == string(messageTakebackAccepted):
+			return sounds(SoundTakebackAccepted, SoundOpponentsTurn), nil
+		case data.IsPlayer && data.Reason != "":
+			return sounds(SoundNoTakeback, SoundYourTurn), nil
+		case data.IsPlayer:
+			return sounds(SoundTakebackDeclined, SoundYourTurn), nil
+		default:
+			return sounds(SoundOpponentsTurn), nil
+		}
+
+	case string(messageInvalidMove):
+		var data dataInvalidMove
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		switch data.Action {
+		case InvalidMoveReprompt:
+			return sounds(SoundInvalidMove, SoundTryAgain), nil
+		case InvalidMoveRandom:
+			return sounds(SoundInvalidMove, SoundRandomMove), nil
+		default:
+			// The game is lost, which is announced with GAME_DONE.
+			return sounds(SoundInvalidMove), nil
+		}
+
+	case announceBoard:
+		var data dataAnnounceBoard
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		var prompts []Prompt
+		for _, field := range data.Fields {
+			prompts = append(prompts, Prompt{Digits: field.Move})
+			switch field.Owner {
+			case boardFieldPlayer:
+				prompts = append(prompts, Prompt{Sound: SoundFieldPlayer})
+			case boardFieldOpponent:
+				prompts = append(prompts, Prompt{Sound: SoundFieldOpponent})
+			case boardFieldMarked:
+				prompts = append(prompts, Prompt{Sound: SoundFieldMarked})
+			default:
+				prompts = append(prompts, Prompt{Sound: SoundFieldEmpty})
+			}
+		}
+		return prompts, nil
+
+	case string(messageGameDone):
+		var data dataGameDone
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		var prompts []Prompt
+		switch {
+		case data.Reason == gameDoneHangup && data.IsPlayerWinner:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentHungUp})
+		case data.Reason == gameDoneTimeout && data.IsPlayerWinner:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentTimeUp})
+		case data.Reason == gameDoneTimeout:
+			prompts = append(prompts, Prompt{Sound: SoundTimeUp})
+		case data.Reason == gameDoneInvalidMove && data.IsPlayerWinner:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentInvalidMove})
+		case data.Reason == gameDoneResign && data.IsPlayerWinner:
+			prompts = append(prompts, Prompt{Sound: SoundOpponentResigned})
+		}
+		switch {
+		case !data.HasWinner:
+			prompts = append(prompts, Prompt{Sound: SoundDraw})
+		case data.IsPlayerWinner:
+			prompts = append(prompts, Prompt{Sound: SoundYouWin})
+		default:
+			prompts = append(prompts, Prompt{Sound: SoundYouLose})
+		}
+		if s := data.Series; s != nil {
+			prompts = append(prompts,
+				Prompt{Sound: SoundSeriesScore},
+				Prompt{Digits: strconv.Itoa(s.PlayerWins)},
+				Prompt{Sound: SoundScoreTo},
+				Prompt{Digits: strconv.Itoa(s.OpponentWins)},
+			)
+			switch {
+			case !s.Done:
+			case s.PlayerWins > s.OpponentWins:
+				prompts = append(prompts, Prompt{Sound: SoundYouWinSeries})
+			case s.PlayerWins < s.OpponentWins:
+				prompts = append(prompts, Prompt{Sound: SoundYouLoseSeries})
+			default:
+				prompts = append(prompts, Prompt{Sound: SoundSeriesDraw})
+			}
+		}
+		return prompts, nil
+
+	case string(messageRematchVote):
+		return sounds(SoundRematchVote), nil
+
+	case string(messageRematchDeclined):
+		var data dataRematchDeclined
+		if err := json.Unmarshal(a.Data, &data); err != nil {
+			return nil, fmt.Errorf("decode announcement %s: %w", a.Type, err)
+		}
+		if data.IsPlayer {
+			// Only the goodbye follows.
+			return nil, nil
+		}
+		return sounds(SoundRematchDeclined), nil
+
+	case announceGoodbye:
+		return sounds(SoundGoodbye), nil
+	}
+
+	return nil, fmt.Errorf("unknown announcement %q", a.Type)
+}
@@ -0,0 +1,335 @@
+package voipttt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GameQuantumTicTacToe is the name of quantum Tic-Tac-Toe.
+const GameQuantumTicTacToe = "quantum-tic-tac-toe"
+
+// quantumMark is a mark of quantum Tic-Tac-Toe.
+type quantumMark struct {
+	Player Player `json:"player"`
+	// Move is the number of the move that placed the mark, starting at 1.
+	Move int `json:"move"`
+}
+
+// spookyMark is a mark that is in two fields at once, until it collapses into one of them.
+type spookyMark struct {
+	quantumMark
+	fields [2]int // Zero based.
+}
+
+// quantumTicTacToe is a game of quantum Tic-Tac-Toe. Instead of a single field,
+// each move places a spooky mark in two fields, which entangles them. Once the
+// spooky marks form a cycle, the player whose move did not create the cycle chooses
+// in which of its two fields the latest mark collapses. This collapses all entangled
+// marks into classical marks, which can form three in a row.
+//
+// A move is two different fields, e.g. `19`. A collapse is a single field of the
+// mark that created the cycle. If only one field is left, it is taken with a single
+// classical mark.
+//
+// If both players get three in a row by the same collapse, the player whose row
+// was completed by the earlier move wins.
+type quantumTicTacToe struct {
+	classical [9]quantumMark
+	spooky    []spookyMark // Marks that did not collapse yet.
+	moves     int          // Number of moves that placed a mark.
+	turn      Player
+	// cycle is the mark that created a cycle and still needs to collapse, nil if none.
+	cycle *spookyMark
+	// collapsed are the zero based fields that became classical by the latest collapse.
+	collapsed []int
+}
+
+func newQuantumTicTacToe() Game {
+	return new(quantumTicTacToe)
+}
+
+// quantumTicTacToeState is the state of the game as it is shown on the website.
+type quantumTicTacToeState struct {
+	gridState
+	// Classical are the classical marks of each field, the player is PlayerNone if the field
+	// is not classical yet.
+	Classical []quantumMark `json:"classical"`
+	// Spooky are the spooky marks in each field.
+	Spooky [][]quantumMark `json:"spooky"`
+	// Collapse are the two fields from 1, between which the player whose turn it is
+	// chooses where the mark that created a cycle collapses.
+	Collapse []int `json:"collapse,omitempty"`
+	// Collapsed are the fields from 1 that became classical by the latest collapse.
+	Collapsed []int `json:"collapsed,omitempty"`
+}
+
+func (q *quantumTicTacToe) Turn() Player {
+	if q.turn == PlayerNone {
+		return PlayerOne
+	}
+	return q.turn
+}
+
+// Moves returns the fields of a pending collapse, the last free field or
+// all pairs of free fields.
+func (q *quantumTicTacToe) Moves() []string {
+	if q.Outcome().Done {
+		return nil
+	}
+	if q.cycle != nil {
+		return []string{
+			strconv.Itoa(q.cycle.fields[0] + 1),
+			strconv.Itoa(q.cycle.fields[1] + 1),
+		}
+	}
+
+	free := q.free()
+	if len(free) == 1 {
+		return []string{strconv.Itoa(free[0] + 1)}
+	}
+	var moves []string
+	for _, a := range free {
+		for _, b := range free {
+			if a < b {
+				moves = append(moves, fmt.Sprintf("%d%d", a+1, b+1))
+			}
+		}
+	}
+	return moves
+}
+
+func (q *quantumTicTacToe) Play(move string) error {
+	fields := make([]int, len(move))
+	for i := range move {
+		if move[i] < '1' || move[i] > '9' {
+			return fmt.Errorf("%w: %q is not a field", ErrInvalidMove, move)
+		}
+		fields[i] = int(move[i] - '1')
+	}
+	if q.Outcome().Done {
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	}
+
+	free := q.free()
+	switch {
+	case q.cycle != nil:
+		if len(fields) != 1 {
+			return fmt.Errorf("%w: %q is not a single field to collapse into", ErrInvalidMove, move)
+		}
+		if fields[0] != q.cycle.fields[0] && fields[0] != q.cycle.fields[1] {
+			return fmt.Errorf(
+				"%w: the mark can only collapse into field %d or %d",
+				ErrIllegalMove,
+				q.cycle.fields[0]+1,
+				q.cycle.fields[1]+1,
+			)
+		}
+		q.collapse(fields[0])
+		// The player who collapsed now makes their own move.
+		return nil
+
+	case len(free) == 1:
+		if len(fields) != 1 {
+			return fmt.Errorf("%w: %q is not the last free field", ErrInvalidMove, move)
+		}
+		if fields[0] != free[0] {
+			return fmt.Errorf("%w: only field %d is free", ErrIllegalMove, free[0]+1)
+		}
+		q.moves++
+		q.classical[fields[0]] = quantumMark{Player: q.Turn(), Move: q.moves}
+		q.collapsed = []int{fields[0]}
+
+	default:
+		if len(fields) != 2 || fields[0] == fields[1] {
+			return fmt.Errorf("%w: %q is not two different fields", ErrInvalidMove, move)
+		}
+		for _, f := range fields {
+			if q.classical[f].Player != PlayerNone {
+				return fmt.Errorf("%w: field %d is already taken", ErrIllegalMove, f+1)
+			}
+		}
+
+		q.moves++
+		mark := spookyMark{
+			quantumMark: quantumMark{Player: q.Turn(), Move: q.moves},
+			fields:      [2]int{fields[0], fields[1]},
+		}
+		createsCycle := q.entangled(fields[0], fields[1])
+		q.spooky = append(q.spooky, mark)
+		q.collapsed = nil
+		if createsCycle {
+			q.cycle = &mark
+		}
+	}
+
+	q.turn = q.Turn().Opponent()
+	return nil
+}
+
+func (q *quantumTicTacToe) Outcome() Outcome {
+	// The move that completed the row of each player, 0 if the player has no row.
+	var completedBy [3]int
+	for _, line := range ticTacToeLines {
+		owner := q.classical[line[0]].Player
+		if owner == PlayerNone || q.classical[line[1]].Player != owner || q.classical[line[2]].Player != owner {
+			continue
+		}
+		move := q.classical[line[0]].Move
+		for _, f := range line[1:] {
+			if q.classical[f].Move > move {
+				move = q.classical[f].Move
+			}
+		}
+		if completedBy[owner] == 0 || move < completedBy[owner] {
+			completedBy[owner] = move
+		}
+	}
+
+	one, two := completedBy[PlayerOne], completedBy[PlayerTwo]
+	switch {
+	case one != 0 && (two == 0 || one < two):
+		return Outcome{Done: true, Winner: PlayerOne}
+	case two != 0:
+		return Outcome{Done: true, Winner: PlayerTwo}
+	}
+	return Outcome{Done: len(q.free()) == 0}
+}
+
+func (q *quantumTicTacToe) State() any {
+	state := &quantumTicTacToeState{
+		gridState: gridState{
+			Rows:   3,
+			Cols:   3,
+			Fields: make([]Player, len(q.classical)),
+		},
+		Classical: append([]quantumMark(nil), q.classical[:]...),
+		Spooky:    make([][]quantumMark, len(q.classical)),
+	}
+	for i, mark := range q.classical {
+		state.Fields[i] = mark.Player
+		state.Spooky[i] = []quantumMark{}
+	}
+	for _, mark := range q.spooky {
+		for _, f := range mark.fields {
+			state.Spooky[f] = append(state.Spooky[f], mark.quantumMark)
+		}
+	}
+	if q.cycle != nil {
+		state.Collapse = []int{q.cycle.fields[0] + 1, q.cycle.fields[1] + 1}
+	}
+	for _, f := range q.collapsed {
+		state.Collapsed = append(state.Collapsed, f+1)
+	}
+	return state
+}
+
+// Input expects two fields, unless the player chooses a collapse or takes the last field.
+func (q *quantumTicTacToe) Input() InputSpec {
+	spec := MoveInputSpec
+	if q.cycle == nil && len(q.free()) != 1 {
+		spec.MaxLength = 2
+	}
+	return spec
+}
+
+// Fields returns the classical marks, fields with only spooky marks are announced as empty.
+func (q *quantumTicTacToe) Fields() []field {
+	fields := make([]field, len(q.classical))
+	for i, mark := range q.classical {
+		fields[i] = field{Move: strconv.Itoa(i + 1), Owner: mark.Player}
+	}
+	return fields
+}
+
+func (q *quantumTicTacToe) Clone() Game {
+	clone := *q
+	clone.spooky = append([]spookyMark(nil), q.spooky...)
+	clone.collapsed = append([]int(nil), q.collapsed...)
+	if q.cycle != nil {
+		cycle := *q.cycle
+		clone.cycle = &cycle
+	}
+	return &clone
+}
+
+// free returns the zero based fields without a classical mark.
+func (q *quantumTicTacToe) free() []int {
+	var free []int
+	for i, mark := range q.classical {
+		if mark.Player == PlayerNone {
+			free = append(free, i)
+		}
+	}
+	return free
+}
+
+// entangled returns whether the two fields are connected through spooky marks,
+// in which case another mark between them creates a cycle.
+func (q *quantumTicTacToe) entangled(from, to int) bool {
+	visited := map[int]bool{from: true}
+	queue := []int{from}
+	for len(queue) > 0 {
+		field := queue[0]
+		queue = queue[1:]
+		if field == to {
+			return true
+		}
+		for _, mark := range q.spooky {
+			for i, f := range mark.fields {
+				other := mark.fields[1-i]
+				if f == field && !visited[other] {
+					visited[other] = true
+					queue = append(queue, other)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// collapse collapses the mark that created the cycle into the given field. Each mark
+// that shares a field with a classical mark is then pushed into its other field,
+// until all entangled marks are classical.
+func (q *quantumTicTacToe) collapse(field int) {
+	q.collapsed = nil
+	place := func(mark spookyMark, field int) {
+		q.classical[field] = mark.quantumMark
+		q.collapsed = append(q.collapsed, field)
+	}
+
+	cycle := *q.cycle
+	q.cycle = nil
+	q.removeSpooky(cycle.Move)
+	place(cycle, field)
+
+	for changed := true; changed; {
+		changed = false
+		for _, mark := range q.spooky {
+			a, b := mark.fields[0], mark.fields[1]
+			aTaken := q.classical[a].Player != PlayerNone
+			bTaken := q.classical[b].Player != PlayerNone
+			if !aTaken && !bTaken {
+				continue
+			}
+			q.removeSpooky(mark.Move)
+			switch {
+			case aTaken && !bTaken:
+				place(mark, b)
+			case bTaken && !aTaken:
+				place(mark, a)
+			}
+			changed = true
+			break
+		}
+	}
+}
+
+// removeSpooky removes the spooky mark that was placed by the given move.
+func (q *quantumTicTacToe) removeSpooky(move int) {
+	for i, mark := range q.spooky {
+		if mark.Move == move {
+			q.spooky = append(q.spooky[:i], q.spooky[i+1:]...)
+			return
+		}
+	}
+}
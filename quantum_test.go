@@ -0,0 +1,79 @@
+package voipttt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQuantumTicTacToeCollapsesCycle(t *testing.T) {
+	q := newQuantumTicTacToe().(*quantumTicTacToe)
+	// The second mark entangles the same fields, which creates a cycle that
+	// player one collapses.
+	playMoves(t, q, "12", "12")
+
+	if q.cycle == nil || q.Turn() != PlayerOne {
+		t.Fatalf("got cycle %v and turn %v, want a cycle to be collapsed by %v", q.cycle, q.Turn(), PlayerOne)
+	}
+	if moves := q.Moves(); !reflect.DeepEqual(moves, []string{"1", "2"}) {
+		t.Fatalf("got moves %v, want the fields of the cycle", moves)
+	}
+	if err := q.Play("3"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	if err := q.Play("13"); !errors.Is(err, ErrInvalidMove) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidMove)
+	}
+
+	playMoves(t, q, "1")
+
+	want := [9]quantumMark{
+		{Player: PlayerTwo, Move: 2},
+		{Player: PlayerOne, Move: 1},
+	}
+	if q.classical != want {
+		t.Fatalf("got classical marks %v, want %v", q.classical, want)
+	}
+	if len(q.spooky) != 0 || q.cycle != nil {
+		t.Fatalf("got spooky marks %v and cycle %v after the collapse", q.spooky, q.cycle)
+	}
+	if !reflect.DeepEqual(q.collapsed, []int{0, 1}) {
+		t.Fatalf("got collapsed fields %v, want [0 1]", q.collapsed)
+	}
+	// The player who collapsed makes the next move.
+	if q.Turn() != PlayerOne {
+		t.Fatalf("got turn %v, want %v", q.Turn(), PlayerOne)
+	}
+	if err := q.Play("13"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestQuantumTicTacToeWin(t *testing.T) {
+	q := newQuantumTicTacToe()
+	playMoves(t, q, "12", "12", "1", "58", "36", "58")
+	if q.Outcome().Done {
+		t.Fatal("game is over before the collapse")
+	}
+
+	// Player two collapses the mark of player one into field 5, which pushes
+	// the other mark of player one into field 8 and completes the middle column.
+	playMoves(t, q, "5")
+	if outcome := q.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerOne}) {
+		t.Fatalf("got %+v, want a win of %v", outcome, PlayerOne)
+	}
+	if moves := q.Moves(); moves != nil {
+		t.Fatalf("got moves %v after the game is over", moves)
+	}
+	if err := q.Play("47"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestQuantumTicTacToeInvalidMoves(t *testing.T) {
+	for _, move := range []string{"", "1", "11", "10", "123"} {
+		if err := newQuantumTicTacToe().Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package rtp implements parsing and serialization of RTP packets (RFC 3550).
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	version    = 2
+	headerSize = 12
+)
+
+// ErrInvalidPacket is returned when a packet can not be parsed.
+var ErrInvalidPacket = errors.New("invalid RTP packet")
+
+// Header is the fixed header of an RTP packet.
+type Header struct {
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	CSRC           []uint32
+}
+
+// Packet is a single RTP packet.
+type Packet struct {
+	Header
+	Payload []byte
+}
+
+// Unmarshal parses the given data into the packet.
+// Header extensions and padding are skipped.
+// The payload references the given data.
+func (p *Packet) Unmarshal(data []byte) error {
+	if len(data) < headerSize || data[0]>>6 != version {
+		return ErrInvalidPacket
+	}
+
+	hasPadding := data[0]&0x20 != 0
+	hasExtension := data[0]&0x10 != 0
+	csrcCount := int(data[0] & 0x0f)
+
+	p.Marker = data[1]&0x80 != 0
+	p.PayloadType = data[1] & 0x7f
+	p.SequenceNumber = binary.BigEndian.Uint16(data[2:4])
+	p.Timestamp = binary.BigEndian.Uint32(data[4:8])
+	p.SSRC = binary.BigEndian.Uint32(data[8:12])
+
+	offset := headerSize
+	if len(data) < offset+csrcCount*4 {
+		return ErrInvalidPacket
+	}
+	p.CSRC = p.CSRC[:0]
+	for i := 0; i < csrcCount; i++ {
+		p.CSRC = append(p.CSRC, binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+	}
+
+	if hasExtension {
+		if len(data) < offset+4 {
+			return ErrInvalidPacket
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:])) * 4
+		offset += 4 + length
+		if len(data) < offset {
+			return ErrInvalidPacket
+		}
+	}
+
+	end := len(data)
+	if hasPadding {
+		padding := int(data[end-1])
+		if padding == 0 || end-padding < offset {
+			return ErrInvalidPacket
+		}
+		end -= padding
+	}
+
+	p.Payload = data[offset:end]
+	return nil
+}
+
+// Marshal serializes the packet.
+func (p *Packet) Marshal() []byte {
+	data := make([]byte, headerSize+len(p.CSRC)*4+len(p.Payload))
+
+	data[0] = version<<6 | uint8(len(p.CSRC)&0x0f)
+	data[1] = p.PayloadType & 0x7f
+	if p.Marker {
+		data[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(data[2:4], p.SequenceNumber)
+	binary.BigEndian.PutUint32(data[4:8], p.Timestamp)
+	binary.BigEndian.PutUint32(data[8:12], p.SSRC)
+
+	offset := headerSize
+	for _, csrc := range p.CSRC {
+		binary.BigEndian.PutUint32(data[offset:], csrc)
+		offset += 4
+	}
+	copy(data[offset:], p.Payload)
+
+	return data
+}
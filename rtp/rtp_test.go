@@ -0,0 +1,104 @@
+package rtp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []Packet{
+		{Header: Header{PayloadType: 0, SequenceNumber: 1, Timestamp: 160, SSRC: 0xdeadbeef}, Payload: []byte{1, 2, 3}},
+		{Header: Header{Marker: true, PayloadType: 101, SequenceNumber: 0xffff, Timestamp: 0xffffffff, SSRC: 1}, Payload: []byte{5, 0x80, 0, 160}},
+		{Header: Header{PayloadType: 8, CSRC: []uint32{1, 2}}, Payload: []byte{}},
+	}
+
+	for _, want := range tests {
+		var got Packet
+		if err := got.Unmarshal(want.Marshal()); err != nil {
+			t.Fatalf("unmarshal %+v: %v", want, err)
+		}
+		if got.Marker != want.Marker ||
+			got.PayloadType != want.PayloadType ||
+			got.SequenceNumber != want.SequenceNumber ||
+			got.Timestamp != want.Timestamp ||
+			got.SSRC != want.SSRC ||
+			len(got.CSRC) != len(want.CSRC) ||
+			!bytes.Equal(got.Payload, want.Payload) {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+		for i := range want.CSRC {
+			if got.CSRC[i] != want.CSRC[i] {
+				t.Fatalf("got CSRC %v, want %v", got.CSRC, want.CSRC)
+			}
+		}
+	}
+}
+
+func TestPacketUnmarshal(t *testing.T) {
+	header := func(first byte) []byte {
+		return []byte{first, 0x80 | 8, 0, 1, 0, 0, 0, 160, 0, 0, 0, 1}
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		payload []byte
+		err     error
+	}{
+		{
+			name:    "plain",
+			data:    join(header(0x80), []byte{1, 2, 3}),
+			payload: []byte{1, 2, 3},
+		},
+		{
+			name:    "padding",
+			data:    join(header(0xa0), []byte{1, 2, 0, 0, 3}),
+			payload: []byte{1, 2},
+		},
+		{
+			name:    "padding of the whole payload",
+			data:    join(header(0xa0), []byte{0, 0, 3}),
+			payload: []byte{},
+		},
+		{
+			name:    "extension",
+			data:    join(header(0x90), []byte{0xbe, 0xde, 0, 1, 9, 9, 9, 9}, []byte{1, 2}),
+			payload: []byte{1, 2},
+		},
+		{
+			name:    "csrc, extension and padding",
+			data:    join(header(0xb1), []byte{0, 0, 0, 7}, []byte{0xbe, 0xde, 0, 0}, []byte{1, 0, 2}),
+			payload: []byte{1},
+		},
+		{name: "too short", data: header(0x80)[:11], err: ErrInvalidPacket},
+		{name: "wrong version", data: join(header(0x40), []byte{1}), err: ErrInvalidPacket},
+		{name: "missing csrc", data: join(header(0x82), []byte{0, 0, 0, 1}), err: ErrInvalidPacket},
+		{name: "missing extension header", data: join(header(0x90), []byte{0xbe, 0xde}), err: ErrInvalidPacket},
+		{name: "truncated extension", data: join(header(0x90), []byte{0xbe, 0xde, 0, 2, 9, 9, 9, 9}), err: ErrInvalidPacket},
+		{name: "zero padding", data: join(header(0xa0), []byte{1, 0}), err: ErrInvalidPacket},
+		{name: "padding exceeds payload", data: join(header(0xa0), []byte{1, 3}), err: ErrInvalidPacket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Packet
+			err := p.Unmarshal(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(p.Payload, tt.payload) {
+				t.Fatalf("got payload %v, want %v", p.Payload, tt.payload)
+			}
+			if !p.Marker || p.PayloadType != 8 || p.SequenceNumber != 1 || p.Timestamp != 160 || p.SSRC != 1 {
+				t.Fatalf("got header %+v", p.Header)
+			}
+		})
+	}
+}
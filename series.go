@@ -0,0 +1,86 @@
+package voipttt
+
+// SeriesConfig configures how many games two callers play against each other in a single call.
+type SeriesConfig struct {
+	// BestOf is the number of games of a series. The series ends early once a player
+	// has won more than half of them. A single game is played if it is zero.
+	BestOf int
+	// Rematch lets the players vote for another series with the same opponent
+	// once a series is over.
+	Rematch bool
+}
+
+// WithSeries lets two callers play a series of games in a single call, in which
+// the players switch sides after each game. Games against bots are single games.
+func WithSeries(config SeriesConfig) ServerOption {
+	return func(s *Server) {
+		s.wsManager.series = &config
+	}
+}
+
+// series keeps track of the score of the games two clients played in a series.
+// A nil series only plays a single game.
+type series struct {
+	config SeriesConfig
+	number int // Number of the current series, starting at 1.
+	games  int // Number of games played in the current series.
+	wins   map[*webSocketClient]int
+}
+
+func newSeries(config SeriesConfig) *series {
+	if config.BestOf < 1 {
+		config.BestOf = 1
+	}
+	return &series{
+		config: config,
+		number: 1,
+		wins:   map[*webSocketClient]int{},
+	}
+}
+
+// record adds a game to the score, the winner is nil for a draw.
+func (s *series) record(winner *webSocketClient) {
+	if s == nil {
+		return
+	}
+	s.games++
+	if winner != nil {
+		s.wins[winner]++
+	}
+}
+
+// done returns whether no more games are played in the current series.
+func (s *series) done() bool {
+	if s == nil || s.games >= s.config.BestOf {
+		return true
+	}
+	for _, wins := range s.wins {
+		if wins > s.config.BestOf/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// rematch starts the next series with an empty score.
+func (s *series) rematch() {
+	s.number++
+	s.games = 0
+	s.wins = map[*webSocketClient]int{}
+}
+
+// data returns the score of the series from the perspective of the client.
+func (s *series) data(client, opponent *webSocketClient) *dataSeries {
+	if s == nil {
+		return nil
+	}
+	return &dataSeries{
+		Series:       s.number,
+		Games:        s.games,
+		BestOf:       s.config.BestOf,
+		PlayerWins:   s.wins[client],
+		OpponentWins: s.wins[opponent],
+		Draws:        s.games - s.wins[client] - s.wins[opponent],
+		Done:         s.done(),
+	}
+}
@@ -0,0 +1,77 @@
+package voipttt
+
+import "testing"
+
+func TestSeriesDone(t *testing.T) {
+	one, two := new(webSocketClient), new(webSocketClient)
+
+	tests := []struct {
+		name   string
+		bestOf int
+		// winners of the games in order, nil for a draw.
+		winners []*webSocketClient
+		// doneAfter is the number of games after which the series is done.
+		doneAfter int
+	}{
+		{name: "single game", bestOf: 0, winners: []*webSocketClient{one}, doneAfter: 1},
+		{name: "best of 1 win", bestOf: 1, winners: []*webSocketClient{two}, doneAfter: 1},
+		{name: "best of 1 draw", bestOf: 1, winners: []*webSocketClient{nil}, doneAfter: 1},
+		{name: "best of 3 early", bestOf: 3, winners: []*webSocketClient{one, one}, doneAfter: 2},
+		{name: "best of 3 decider", bestOf: 3, winners: []*webSocketClient{one, two, two}, doneAfter: 3},
+		{name: "best of 3 draws", bestOf: 3, winners: []*webSocketClient{nil, nil, one}, doneAfter: 3},
+		{name: "best of 4 early", bestOf: 4, winners: []*webSocketClient{two, two, two}, doneAfter: 3},
+		{name: "best of 4 tie", bestOf: 4, winners: []*webSocketClient{one, two, one, two}, doneAfter: 4},
+		{name: "best of 4 draws", bestOf: 4, winners: []*webSocketClient{nil, one, nil, nil}, doneAfter: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeries(SeriesConfig{BestOf: tt.bestOf})
+			if s.done() {
+				t.Fatal("series is done before the first game")
+			}
+			for i, winner := range tt.winners {
+				s.record(winner)
+				if want := i+1 == tt.doneAfter; s.done() != want {
+					t.Fatalf("got done %v after %d games, want %v", s.done(), i+1, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeriesData(t *testing.T) {
+	one, two := new(webSocketClient), new(webSocketClient)
+	s := newSeries(SeriesConfig{BestOf: 4})
+	s.record(one)
+	s.record(nil)
+	s.record(two)
+	s.record(one)
+
+	want := dataSeries{Series: 1, Games: 4, BestOf: 4, PlayerWins: 2, OpponentWins: 1, Draws: 1, Done: true}
+	if got := s.data(one, two); *got != want {
+		t.Fatalf("got %+v, want %+v", *got, want)
+	}
+	want.PlayerWins, want.OpponentWins = 1, 2
+	if got := s.data(two, one); *got != want {
+		t.Fatalf("got %+v from the opponent's perspective, want %+v", *got, want)
+	}
+
+	s.rematch()
+	want = dataSeries{Series: 2, BestOf: 4}
+	if got := s.data(one, two); *got != want {
+		t.Fatalf("got %+v after the rematch, want %+v", *got, want)
+	}
+}
+
+func TestNilSeriesPlaysSingleGame(t *testing.T) {
+	var s *series
+	s.record(new(webSocketClient))
+
+	if !s.done() {
+		t.Fatal("nil series is not done")
+	}
+	if data := s.data(new(webSocketClient), new(webSocketClient)); data != nil {
+		t.Fatalf("got %+v, want no series data", data)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/n9v9/voip-ttt/sip"
 )
 
 // Server manages the api.publicAPI and api.privateAPI instances.
@@ -17,19 +19,49 @@ type Server struct {
 	privateAPI     *privateAPI
 	privateAPIAddr string
 	wsManager      *webSocketManager
+	callMonitor    *callMonitor
+	sipConfig      *SIPConfig
+}
+
+// ServerOption configures optional features of the Server.
+type ServerOption func(*Server)
+
+// WithAMI connects the server to the asterisk manager interface
+// to detect when callers hang up.
+func WithAMI(config AMIConfig) ServerOption {
+	return func(s *Server) {
+		s.callMonitor = newCallMonitor(config, s.wsManager)
+		s.wsManager.callMonitor = s.callMonitor
+	}
+}
+
+// WithSIP lets the server accept SIP calls directly, so that
+// no asterisk instance is required.
+func WithSIP(config SIPConfig) ServerOption {
+	return func(s *Server) {
+		s.sipConfig = &config
+	}
 }
 
 // NewServer returns an initialized instance whose APIs will
 // listen on the given addresses.
-func NewServer(callPhoneNumber PhoneNumber, publicAPIAddr, privateAPIAddr string) *Server {
+func NewServer(
+	callPhoneNumber PhoneNumber,
+	publicAPIAddr, privateAPIAddr string,
+	opts ...ServerOption,
+) *Server {
 	wsManager := newManager(callPhoneNumber)
-	return &Server{
+	s := &Server{
 		publicAPI:      newPublic(wsManager),
 		privateAPI:     newPrivate(wsManager),
 		publicAPIAddr:  publicAPIAddr,
 		privateAPIAddr: privateAPIAddr,
 		wsManager:      wsManager,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Run starts the APIs.
@@ -79,6 +111,22 @@ func (s *Server) Run(ctx context.Context, shutdownTimeout time.Duration) {
 		s.wsManager.runClientMatcher(ctx)
 	}()
 
+	if s.callMonitor != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.callMonitor.run(ctx)
+		}()
+	}
+
+	if s.sipConfig != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runSIP(ctx)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -97,3 +145,20 @@ func (s *Server) Run(ctx context.Context, shutdownTimeout time.Duration) {
 
 	wg.Wait()
 }
+
+// runSIP runs the built-in SIP user agent until the context is cancelled.
+func (s *Server) runSIP(ctx context.Context) {
+	l := log.With().Str("sip_addr", s.sipConfig.Addr).Logger()
+
+	server, err := sip.Listen(s.sipConfig.Addr, s.sipConfig.PublicIP, l)
+	if err != nil {
+		l.Err(err).Msg("Failed to start SIP user agent")
+		return
+	}
+
+	if err := server.Serve(ctx, func(ctx context.Context, call *sip.Call) {
+		s.wsManager.handleSIPCall(ctx, call, s.sipConfig.SoundsDir, l)
+	}); err != nil {
+		l.Err(err).Msg("Failed to run SIP user agent")
+	}
+}
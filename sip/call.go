@@ -0,0 +1,371 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/rtp"
+)
+
+// Timers of the SIP transaction layer, see RFC 3261 section 17.
+const (
+	timerT1 = time.Millisecond * 500
+	timerT2 = time.Second * 4
+)
+
+// Audio is sent in packets of 20 ms, i.e. 160 G.711 samples at 8 kHz.
+const (
+	packetDuration   = time.Millisecond * 20
+	samplesPerPacket = 160
+)
+
+// ErrHungUp is returned when reading from a call that has ended.
+var ErrHungUp = errors.New("call hung up")
+
+// telephoneEvents maps RFC 4733 event codes to their DTMF key.
+var telephoneEvents = [...]rune{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '*', '#', 'A', 'B', 'C', 'D'}
+
+// Call is an established incoming call.
+type Call struct {
+	server     *Server
+	callID     string
+	remoteAddr *net.UDPAddr
+	invite     *Message
+	localTag   string
+	localCSeq  uint32
+
+	// Serialized 200 OK to the INVITE, retransmitted until the ACK arrives.
+	inviteOK []byte
+	acked    chan struct{}
+	ackOnce  sync.Once
+
+	rtpConn        *net.UDPConn
+	codec          uint8
+	telephoneEvent uint8
+	// Address the caller receives audio on, as offered in the SDP.
+	remoteRTPAddr *net.UDPAddr
+
+	// State of the audio stream sent to the caller, only one stream is sent at a time.
+	sendMu    sync.Mutex
+	sequence  uint16
+	timestamp uint32
+	ssrc      uint32
+
+	dtmf  chan rune
+	audio chan []byte
+
+	// Responses to our BYE request.
+	responses chan *Message
+
+	done     chan struct{}
+	doneOnce sync.Once
+
+	log zerolog.Logger
+}
+
+func newCall(
+	s *Server,
+	invite *Message,
+	remoteAddr *net.UDPAddr,
+	rtpConn *net.UDPConn,
+	offer sessionDescription,
+	codec uint8,
+	l zerolog.Logger,
+) *Call {
+	return &Call{
+		server:         s,
+		callID:         invite.Get("Call-ID"),
+		remoteAddr:     remoteAddr,
+		invite:         invite,
+		localTag:       randomToken(),
+		acked:          make(chan struct{}),
+		rtpConn:        rtpConn,
+		codec:          codec,
+		telephoneEvent: offer.telephoneEvent,
+		remoteRTPAddr:  &net.UDPAddr{IP: offer.ip, Port: offer.port},
+		sequence:       uint16(randomUint32()),
+		timestamp:      randomUint32(),
+		ssrc:           randomUint32(),
+		dtmf:           make(chan rune, 32),
+		audio:          make(chan []byte, 64),
+		responses:      make(chan *Message, 4),
+		done:           make(chan struct{}),
+		log:            l.With().Str("rtp_addr", rtpConn.LocalAddr().String()).Logger(),
+	}
+}
+
+// Caller returns the user part of the caller's SIP URI, usually their phone number.
+func (c *Call) Caller() string {
+	return uriUser(headerURI(c.invite.Get("From")))
+}
+
+// DTMF returns the channel receiving the keys pressed by the caller.
+func (c *Call) DTMF() <-chan rune {
+	return c.dtmf
+}
+
+// Audio returns the channel receiving the audio of the caller as G.711 samples at 8 kHz,
+// see Codec. Audio is dropped if it is not read fast enough.
+func (c *Call) Audio() <-chan []byte {
+	return c.audio
+}
+
+// Codec returns the negotiated payload type of the audio, either PayloadTypePCMU or PayloadTypePCMA.
+func (c *Call) Codec() uint8 {
+	return c.codec
+}
+
+// Done returns a channel that is closed when the call has ended.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// RemoteAddr returns the signalling address of the caller.
+func (c *Call) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// start sends the 200 OK response to the INVITE and starts receiving media.
+func (c *Call) start(ok *Message) {
+	c.inviteOK = ok.Marshal()
+	c.server.send(ok, c.remoteAddr)
+
+	go c.retransmitInviteOK()
+	go c.receiveMedia()
+}
+
+// retransmitInviteOK retransmits the 200 OK until the caller acknowledges it.
+func (c *Call) retransmitInviteOK() {
+	interval := timerT1
+	timeout := time.After(timerT1 * 64)
+	for {
+		select {
+		case <-c.acked:
+			return
+		case <-c.done:
+			return
+		case <-timeout:
+			c.log.Warn().Msg("Caller did not acknowledge the answer")
+			c.end("missing ACK")
+			return
+		case <-time.After(interval):
+			if _, err := c.server.conn.WriteToUDP(c.inviteOK, c.remoteAddr); err != nil {
+				c.log.Err(err).Msg("Failed to retransmit answer")
+			}
+			interval = nextInterval(interval)
+		}
+	}
+}
+
+// nextInterval doubles the retransmission interval up to T2.
+func nextInterval(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval > timerT2 {
+		return timerT2
+	}
+	return interval
+}
+
+// handleInviteRetransmission resends the answer if the caller did not receive it.
+func (c *Call) handleInviteRetransmission(req *Message) {
+	if isSameTransaction(req, c.invite) {
+		_, _ = c.server.conn.WriteToUDP(c.inviteOK, c.remoteAddr)
+		return
+	}
+	// Re-INVITEs to change the session are not supported.
+	c.server.send(newResponse(req, 488, "Not Acceptable Here"), c.remoteAddr)
+}
+
+func (c *Call) handleAck() {
+	c.ackOnce.Do(func() { close(c.acked) })
+}
+
+func (c *Call) handleResponse(resp *Message) {
+	select {
+	case c.responses <- resp:
+	default:
+	}
+}
+
+// receiveMedia reads RTP packets, passes on the audio and extracts DTMF events.
+func (c *Call) receiveMedia() {
+	buf := make([]byte, 1500)
+	var (
+		packet rtp.Packet
+		// Timestamp of the last handled telephone event. The end of an event is
+		// sent multiple times with the same timestamp.
+		lastEvent   uint32
+		handledOnce bool
+	)
+
+	for {
+		n, err := c.rtpConn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.log.Err(err).Msg("Failed to read RTP packet")
+			}
+			return
+		}
+		if err := packet.Unmarshal(buf[:n]); err != nil {
+			continue
+		}
+
+		switch {
+		case c.telephoneEvent != 0 && packet.PayloadType == c.telephoneEvent:
+			if len(packet.Payload) < 4 {
+				continue
+			}
+			event := packet.Payload[0]
+			isEnd := packet.Payload[1]&0x80 != 0
+			if !isEnd || int(event) >= len(telephoneEvents) {
+				continue
+			}
+			if handledOnce && packet.Timestamp == lastEvent {
+				continue
+			}
+			handledOnce = true
+			lastEvent = packet.Timestamp
+
+			key := telephoneEvents[event]
+			c.log.Debug().Str("digit", string(key)).Msg("Received DTMF")
+			select {
+			case c.dtmf <- key:
+			default:
+				c.log.Warn().Str("digit", string(key)).Msg("Dropped DTMF because nobody is reading")
+			}
+
+		case packet.PayloadType == c.codec:
+			// The payload is reused by the next packet.
+			samples := append([]byte(nil), packet.Payload...)
+			select {
+			case c.audio <- samples:
+			default:
+			}
+		}
+	}
+}
+
+// SendAudio plays the G.711 samples at 8 kHz, encoded as returned by Codec, to the caller.
+// It blocks until all samples are sent in real time, concurrent calls are played
+// one after another.
+func (c *Call) SendAudio(ctx context.Context, samples []byte) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	ticker := time.NewTicker(packetDuration)
+	defer ticker.Stop()
+
+	for i := 0; len(samples) > 0; i++ {
+		n := samplesPerPacket
+		if n > len(samples) {
+			n = len(samples)
+		}
+		packet := rtp.Packet{
+			Header: rtp.Header{
+				// Marks the start of the talkspurt.
+				Marker:         i == 0,
+				PayloadType:    c.codec,
+				SequenceNumber: c.sequence,
+				Timestamp:      c.timestamp,
+				SSRC:           c.ssrc,
+			},
+			Payload: samples[:n],
+		}
+		if _, err := c.rtpConn.WriteToUDP(packet.Marshal(), c.remoteRTPAddr); err != nil {
+			select {
+			case <-c.done:
+				return ErrHungUp
+			default:
+				return fmt.Errorf("send RTP packet: %w", err)
+			}
+		}
+		c.sequence++
+		c.timestamp += samplesPerPacket
+		samples = samples[n:]
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return ErrHungUp
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Hangup ends the call by sending a BYE request to the caller.
+func (c *Call) Hangup(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	defer c.end("local hangup")
+
+	c.localCSeq++
+	bye := c.newRequest("BYE", c.localCSeq)
+	data := bye.Marshal()
+
+	interval := timerT1
+	for attempt := 0; attempt < 7; attempt++ {
+		if _, err := c.server.conn.WriteToUDP(data, c.remoteAddr); err != nil {
+			return fmt.Errorf("send BYE: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return nil
+		case resp := <-c.responses:
+			if seq, method := resp.CSeq(); seq == c.localCSeq && method == "BYE" && resp.StatusCode >= 200 {
+				return nil
+			}
+		case <-time.After(interval):
+			interval = nextInterval(interval)
+		}
+	}
+	return errors.New("caller did not respond to BYE")
+}
+
+// newRequest returns a request within the dialog of the call.
+func (c *Call) newRequest(method string, cseq uint32) *Message {
+	target := headerURI(c.invite.Get("Contact"))
+	if target == "" {
+		target = headerURI(c.invite.Get("From"))
+	}
+
+	localIP := c.server.localIP(c.remoteAddr)
+	req := &Message{
+		Method:     method,
+		RequestURI: target,
+	}
+	req.Add("Via", fmt.Sprintf(
+		"SIP/2.0/UDP %s;branch=z9hG4bK%s;rport",
+		c.server.contactAddr(localIP),
+		randomToken(),
+	))
+	req.Add("Max-Forwards", "70")
+	// The roles are reversed, as we are the callee of the INVITE.
+	req.Add("From", c.invite.Get("To")+";tag="+c.localTag)
+	req.Add("To", c.invite.Get("From"))
+	req.Add("Call-ID", c.callID)
+	req.Add("CSeq", fmt.Sprintf("%d %s", cseq, method))
+	return req
+}
+
+// end releases all resources of the call.
+func (c *Call) end(reason string) {
+	c.doneOnce.Do(func() {
+		c.log.Info().Str("reason", reason).Msg("Call ended")
+		close(c.done)
+		_ = c.rtpConn.Close()
+		c.server.removeCall(c)
+	})
+}
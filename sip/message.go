@@ -0,0 +1,231 @@
+// Package sip implements a minimal SIP user agent over UDP that accepts incoming
+// calls, receives their G.711 audio through RTP and their DTMF digits as
+// RFC 4733 telephone events.
+package sip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidMessage is returned when a SIP message can not be parsed.
+var ErrInvalidMessage = errors.New("invalid SIP message")
+
+// compactHeaders maps the compact form of header names to their full form.
+var compactHeaders = map[string]string{
+	"v": "Via",
+	"f": "From",
+	"t": "To",
+	"i": "Call-ID",
+	"m": "Contact",
+	"l": "Content-Length",
+	"c": "Content-Type",
+	"k": "Supported",
+}
+
+// header is a single header line of a message.
+type header struct {
+	name  string
+	value string
+}
+
+// Message is a SIP request or response.
+type Message struct {
+	// Set for requests.
+	Method     string
+	RequestURI string
+
+	// Set for responses.
+	StatusCode int
+	Reason     string
+
+	headers []header
+	Body    []byte
+}
+
+// newResponse returns a response to the given request, copying the headers
+// that identify the transaction.
+func newResponse(req *Message, statusCode int, reason string) *Message {
+	resp := &Message{
+		StatusCode: statusCode,
+		Reason:     reason,
+	}
+	for _, via := range req.GetAll("Via") {
+		resp.Add("Via", via)
+	}
+	resp.Add("From", req.Get("From"))
+	resp.Add("To", req.Get("To"))
+	resp.Add("Call-ID", req.Get("Call-ID"))
+	resp.Add("CSeq", req.Get("CSeq"))
+	return resp
+}
+
+// IsRequest returns whether the message is a request.
+func (m *Message) IsRequest() bool {
+	return m.Method != ""
+}
+
+// Get returns the value of the first header with the given name.
+func (m *Message) Get(name string) string {
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, name) {
+			return h.value
+		}
+	}
+	return ""
+}
+
+// GetAll returns the values of all headers with the given name.
+func (m *Message) GetAll(name string) []string {
+	var values []string
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, name) {
+			values = append(values, h.value)
+		}
+	}
+	return values
+}
+
+// Add adds a header with the given name.
+func (m *Message) Add(name, value string) {
+	m.headers = append(m.headers, header{name: name, value: value})
+}
+
+// Set replaces all headers with the given name.
+func (m *Message) Set(name, value string) {
+	headers := m.headers[:0]
+	for _, h := range m.headers {
+		if !strings.EqualFold(h.name, name) {
+			headers = append(headers, h)
+		}
+	}
+	m.headers = append(headers, header{name: name, value: value})
+}
+
+// CSeq returns the sequence number and method of the CSeq header.
+func (m *Message) CSeq() (uint32, string) {
+	num, method, _ := strings.Cut(strings.TrimSpace(m.Get("CSeq")), " ")
+	n, _ := strconv.ParseUint(num, 10, 32)
+	return uint32(n), strings.TrimSpace(method)
+}
+
+// Marshal serializes the message, setting its Content-Length.
+func (m *Message) Marshal() []byte {
+	var buf bytes.Buffer
+	if m.IsRequest() {
+		fmt.Fprintf(&buf, "%s %s SIP/2.0\r\n", m.Method, m.RequestURI)
+	} else {
+		fmt.Fprintf(&buf, "SIP/2.0 %d %s\r\n", m.StatusCode, m.Reason)
+	}
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, "Content-Length") {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.name, h.value)
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(m.Body))
+	buf.Write(m.Body)
+	return buf.Bytes()
+}
+
+// ParseMessage parses a single SIP message as received in a UDP datagram.
+func ParseMessage(data []byte) (*Message, error) {
+	head, body, ok := bytes.Cut(data, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, fmt.Errorf("%w: missing end of headers", ErrInvalidMessage)
+	}
+
+	lines := strings.Split(string(head), "\r\n")
+	m := &Message{}
+
+	startLine := strings.SplitN(lines[0], " ", 3)
+	if len(startLine) != 3 {
+		return nil, fmt.Errorf("%w: malformed start line %q", ErrInvalidMessage, lines[0])
+	}
+	if startLine[0] == "SIP/2.0" {
+		code, err := strconv.Atoi(startLine[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed status code %q", ErrInvalidMessage, startLine[1])
+		}
+		m.StatusCode = code
+		m.Reason = startLine[2]
+	} else {
+		if startLine[2] != "SIP/2.0" {
+			return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidMessage, startLine[2])
+		}
+		m.Method = startLine[0]
+		m.RequestURI = startLine[1]
+	}
+
+	for _, line := range lines[1:] {
+		// Continuation of the previous header.
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(m.headers) > 0 {
+			m.headers[len(m.headers)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed header %q", ErrInvalidMessage, line)
+		}
+		name = strings.TrimSpace(name)
+		if full, ok := compactHeaders[strings.ToLower(name)]; ok {
+			name = full
+		}
+		m.Add(name, strings.TrimSpace(value))
+	}
+
+	if length := m.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > len(body) {
+			return nil, fmt.Errorf("%w: invalid Content-Length %q", ErrInvalidMessage, length)
+		}
+		body = body[:n]
+	}
+	m.Body = body
+
+	return m, nil
+}
+
+// headerParam returns the value of the given parameter of a header value,
+// e.g. the `tag` of a From header.
+func headerParam(value, param string) string {
+	// Parameters of the URI inside angle brackets do not belong to the header.
+	if i := strings.LastIndex(value, ">"); i >= 0 {
+		value = value[i+1:]
+	}
+	for _, p := range strings.Split(value, ";")[1:] {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if strings.EqualFold(k, param) {
+			return v
+		}
+	}
+	return ""
+}
+
+// headerURI returns the URI of a From, To or Contact header value.
+func headerURI(value string) string {
+	if start := strings.Index(value, "<"); start >= 0 {
+		if end := strings.Index(value[start:], ">"); end >= 0 {
+			return value[start+1 : start+end]
+		}
+	}
+	uri, _, _ := strings.Cut(value, ";")
+	return strings.TrimSpace(uri)
+}
+
+// uriUser returns the user part of a SIP URI, e.g. `alice` for `sip:alice@example.com`.
+func uriUser(uri string) string {
+	_, rest, ok := strings.Cut(uri, ":")
+	if !ok {
+		return ""
+	}
+	user, _, ok := strings.Cut(rest, "@")
+	if !ok {
+		return ""
+	}
+	user, _, _ = strings.Cut(user, ";")
+	return user
+}
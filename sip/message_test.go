@@ -0,0 +1,142 @@
+package sip
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	invite := "INVITE sip:voipttt@10.0.0.1 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK1\r\n" +
+		"v: SIP/2.0/UDP 10.0.0.3:5060;branch=z9hG4bK2\r\n" +
+		"f: \"Alice\" <sip:100@10.0.0.2;user=phone>;tag=abc\r\n" +
+		"To: <sip:voipttt@10.0.0.1>\r\n" +
+		"i: call-1\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Subject: long\r\n" +
+		" subject\r\n" +
+		"l: 4\r\n" +
+		"\r\n" +
+		"body and more"
+
+	m, err := ParseMessage([]byte(invite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsRequest() || m.Method != "INVITE" || m.RequestURI != "sip:voipttt@10.0.0.1" {
+		t.Fatalf("got start line %q %q", m.Method, m.RequestURI)
+	}
+	if via := m.GetAll("via"); len(via) != 2 || !strings.Contains(via[1], "z9hG4bK2") {
+		t.Fatalf("got Via headers %q", via)
+	}
+	if got := m.Get("Call-ID"); got != "call-1" {
+		t.Fatalf("got Call-ID %q", got)
+	}
+	if got := m.Get("Subject"); got != "long subject" {
+		t.Fatalf("got continued header %q", got)
+	}
+	if seq, method := m.CSeq(); seq != 2 || method != "INVITE" {
+		t.Fatalf("got CSeq %d %s", seq, method)
+	}
+	if string(m.Body) != "body" {
+		t.Fatalf("got body %q", m.Body)
+	}
+
+	resp, err := ParseMessage([]byte("SIP/2.0 486 Busy Here\r\nCall-ID: call-1\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IsRequest() || resp.StatusCode != 486 || resp.Reason != "Busy Here" {
+		t.Fatalf("got response %d %q", resp.StatusCode, resp.Reason)
+	}
+}
+
+func TestParseMessageInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "missing end of headers", data: "BYE sip:a@b SIP/2.0\r\nCall-ID: 1\r\n"},
+		{name: "malformed start line", data: "BYE\r\n\r\n"},
+		{name: "unsupported version", data: "BYE sip:a@b SIP/3.0\r\n\r\n"},
+		{name: "malformed status code", data: "SIP/2.0 OK fine\r\n\r\n"},
+		{name: "malformed header", data: "BYE sip:a@b SIP/2.0\r\nCall-ID\r\n\r\n"},
+		{name: "Content-Length exceeds body", data: "BYE sip:a@b SIP/2.0\r\nContent-Length: 10\r\n\r\nshort"},
+		{name: "negative Content-Length", data: "BYE sip:a@b SIP/2.0\r\nContent-Length: -1\r\n\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMessage([]byte(tt.data)); !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("got error %v, want %v", err, ErrInvalidMessage)
+			}
+		})
+	}
+}
+
+func TestMessageMarshal(t *testing.T) {
+	req := &Message{Method: "BYE", RequestURI: "sip:100@10.0.0.2"}
+	req.Add("Call-ID", "call-1")
+	req.Add("Content-Length", "99")
+	req.Add("X-Test", "a")
+	req.Set("x-test", "b")
+	req.Body = []byte("hi")
+
+	want := "BYE sip:100@10.0.0.2 SIP/2.0\r\nCall-ID: call-1\r\nx-test: b\r\nContent-Length: 2\r\n\r\nhi"
+	if got := string(req.Marshal()); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	parsed, err := ParseMessage(req.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Get("X-Test") != "b" || string(parsed.Body) != "hi" {
+		t.Fatalf("round trip changed the message: %+v", parsed)
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	req := &Message{Method: "INVITE", RequestURI: "sip:voipttt@10.0.0.1"}
+	req.Add("Via", "SIP/2.0/UDP 10.0.0.2;branch=z9hG4bK1")
+	req.Add("Via", "SIP/2.0/UDP 10.0.0.3;branch=z9hG4bK2")
+	req.Add("From", "<sip:100@10.0.0.2>;tag=abc")
+	req.Add("To", "<sip:voipttt@10.0.0.1>")
+	req.Add("Call-ID", "call-1")
+	req.Add("CSeq", "1 INVITE")
+	req.Add("Max-Forwards", "70")
+
+	resp := newResponse(req, 180, "Ringing")
+	if resp.StatusCode != 180 || len(resp.GetAll("Via")) != 2 || resp.Get("CSeq") != "1 INVITE" ||
+		resp.Get("From") != req.Get("From") || resp.Get("Max-Forwards") != "" {
+		t.Fatalf("got response %+v", resp)
+	}
+}
+
+func TestHeaderHelpers(t *testing.T) {
+	tests := []struct {
+		value string
+		uri   string
+		user  string
+		tag   string
+	}{
+		{value: `"Alice" <sip:100@10.0.0.2;user=phone>;tag=abc`, uri: "sip:100@10.0.0.2;user=phone", user: "100", tag: "abc"},
+		{value: `<sip:100;npdi@10.0.0.2;tag=uri>`, uri: "sip:100;npdi@10.0.0.2;tag=uri", user: "100"},
+		{value: `sip:bob@example.com;tag=1`, uri: "sip:bob@example.com", user: "bob", tag: "1"},
+		{value: `<sip:example.com>`, uri: "sip:example.com"},
+		{value: ``},
+	}
+
+	for _, tt := range tests {
+		if got := headerURI(tt.value); got != tt.uri {
+			t.Errorf("headerURI(%q) = %q, want %q", tt.value, got, tt.uri)
+		}
+		if got := uriUser(headerURI(tt.value)); got != tt.user {
+			t.Errorf("uriUser of %q = %q, want %q", tt.value, got, tt.user)
+		}
+		if got := headerParam(tt.value, "tag"); got != tt.tag {
+			t.Errorf("headerParam(%q, tag) = %q, want %q", tt.value, got, tt.tag)
+		}
+	}
+}
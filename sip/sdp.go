@@ -0,0 +1,120 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Static RTP payload types of the supported codecs.
+const (
+	PayloadTypePCMU uint8 = 0
+	PayloadTypePCMA uint8 = 8
+)
+
+// sessionDescription is the part of an SDP offer that is relevant for an audio call.
+type sessionDescription struct {
+	ip   net.IP
+	port int
+	// Payload types offered for the audio stream, in order of preference.
+	payloadTypes []uint8
+	// Payload type of telephone-event, 0 if not offered.
+	telephoneEvent uint8
+}
+
+// parseSDP parses the connection address, the audio port and the offered payload types.
+func parseSDP(body []byte) (sessionDescription, error) {
+	var sd sessionDescription
+
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "c":
+			// c=IN IP4 192.168.1.2
+			fields := strings.Fields(value)
+			if len(fields) == 3 {
+				sd.ip = net.ParseIP(fields[2])
+			}
+		case "m":
+			// m=audio 49170 RTP/AVP 0 8 101
+			fields := strings.Fields(value)
+			if len(fields) < 4 || fields[0] != "audio" || sd.port != 0 {
+				continue
+			}
+			port, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return sd, fmt.Errorf("invalid SDP media port %q", fields[1])
+			}
+			sd.port = port
+			for _, f := range fields[3:] {
+				pt, err := strconv.ParseUint(f, 10, 7)
+				if err == nil {
+					sd.payloadTypes = append(sd.payloadTypes, uint8(pt))
+				}
+			}
+		case "a":
+			// a=rtpmap:101 telephone-event/8000
+			attr, rest, ok := strings.Cut(value, ":")
+			if !ok || attr != "rtpmap" {
+				continue
+			}
+			pt, encoding, ok := strings.Cut(rest, " ")
+			if !ok || !strings.HasPrefix(strings.ToLower(encoding), "telephone-event/") {
+				continue
+			}
+			if n, err := strconv.ParseUint(pt, 10, 7); err == nil {
+				sd.telephoneEvent = uint8(n)
+			}
+		}
+	}
+
+	if sd.ip == nil || sd.port == 0 {
+		return sd, fmt.Errorf("SDP offer does not contain an audio stream")
+	}
+	return sd, nil
+}
+
+// selectCodec returns the first offered payload type that is supported.
+func (sd sessionDescription) selectCodec() (uint8, bool) {
+	for _, pt := range sd.payloadTypes {
+		if pt == PayloadTypePCMU || pt == PayloadTypePCMA {
+			return pt, true
+		}
+	}
+	return 0, false
+}
+
+// answerSDP returns the SDP answer for an audio stream received on the given address.
+func answerSDP(ip net.IP, port int, codec, telephoneEvent uint8) []byte {
+	encoding := "PCMU/8000"
+	if codec == PayloadTypePCMA {
+		encoding = "PCMA/8000"
+	}
+
+	id := time.Now().Unix()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "v=0\r\n")
+	fmt.Fprintf(&sb, "o=voipttt %d %d IN IP4 %s\r\n", id, id, ip)
+	fmt.Fprintf(&sb, "s=voipttt\r\n")
+	fmt.Fprintf(&sb, "c=IN IP4 %s\r\n", ip)
+	fmt.Fprintf(&sb, "t=0 0\r\n")
+	if telephoneEvent != 0 {
+		fmt.Fprintf(&sb, "m=audio %d RTP/AVP %d %d\r\n", port, codec, telephoneEvent)
+	} else {
+		fmt.Fprintf(&sb, "m=audio %d RTP/AVP %d\r\n", port, codec)
+	}
+	fmt.Fprintf(&sb, "a=rtpmap:%d %s\r\n", codec, encoding)
+	if telephoneEvent != 0 {
+		fmt.Fprintf(&sb, "a=rtpmap:%d telephone-event/8000\r\n", telephoneEvent)
+		fmt.Fprintf(&sb, "a=fmtp:%d 0-16\r\n", telephoneEvent)
+	}
+	fmt.Fprintf(&sb, "a=ptime:20\r\n")
+	fmt.Fprintf(&sb, "a=sendrecv\r\n")
+	return []byte(sb.String())
+}
@@ -0,0 +1,111 @@
+package sip
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		ip             string
+		port           int
+		payloadTypes   []uint8
+		telephoneEvent uint8
+		codec          uint8
+		noCodec        bool
+		err            bool
+	}{
+		{
+			name: "offer with telephone events",
+			body: "v=0\r\nc=IN IP4 10.0.0.2\r\nm=audio 49170 RTP/AVP 0 8 101\r\n" +
+				"a=rtpmap:0 PCMU/8000\r\na=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-16\r\n",
+			ip:             "10.0.0.2",
+			port:           49170,
+			payloadTypes:   []uint8{0, 8, 101},
+			telephoneEvent: 101,
+			codec:          PayloadTypePCMU,
+		},
+		{
+			name:         "prefers the order of the offer",
+			body:         "c=IN IP4 10.0.0.2\nm=audio 4000 RTP/AVP 9 8 0\n",
+			ip:           "10.0.0.2",
+			port:         4000,
+			payloadTypes: []uint8{9, 8, 0},
+			codec:        PayloadTypePCMA,
+		},
+		{
+			name:         "only the first audio stream",
+			body:         "c=IN IP4 10.0.0.2\r\nm=video 5000 RTP/AVP 96\r\nm=audio 4000 RTP/AVP 0 foo 200\r\nm=audio 6000 RTP/AVP 8\r\n",
+			ip:           "10.0.0.2",
+			port:         4000,
+			payloadTypes: []uint8{0},
+			codec:        PayloadTypePCMU,
+		},
+		{
+			name:         "unsupported codecs",
+			body:         "c=IN IP4 10.0.0.2\r\nm=audio 4000 RTP/AVP 9 18\r\n",
+			ip:           "10.0.0.2",
+			port:         4000,
+			payloadTypes: []uint8{9, 18},
+			noCodec:      true,
+		},
+		{name: "missing connection", body: "m=audio 4000 RTP/AVP 0\r\n", err: true},
+		{name: "missing audio", body: "c=IN IP4 10.0.0.2\r\n", err: true},
+		{name: "invalid port", body: "c=IN IP4 10.0.0.2\r\nm=audio x RTP/AVP 0\r\n", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := parseSDP([]byte(tt.body))
+			if tt.err {
+				if err == nil {
+					t.Fatal("parsed invalid offer")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sd.ip.Equal(net.ParseIP(tt.ip)) || sd.port != tt.port || sd.telephoneEvent != tt.telephoneEvent {
+				t.Fatalf("got %+v", sd)
+			}
+			if len(sd.payloadTypes) != len(tt.payloadTypes) {
+				t.Fatalf("got payload types %v, want %v", sd.payloadTypes, tt.payloadTypes)
+			}
+			for i := range tt.payloadTypes {
+				if sd.payloadTypes[i] != tt.payloadTypes[i] {
+					t.Fatalf("got payload types %v, want %v", sd.payloadTypes, tt.payloadTypes)
+				}
+			}
+			codec, ok := sd.selectCodec()
+			if ok == tt.noCodec || codec != tt.codec {
+				t.Fatalf("got codec %d %v, want %d", codec, ok, tt.codec)
+			}
+		})
+	}
+}
+
+func TestAnswerSDP(t *testing.T) {
+	ip := net.ParseIP("10.0.0.1")
+
+	answer := string(answerSDP(ip, 4000, PayloadTypePCMA, 101))
+	for _, line := range []string{"c=IN IP4 10.0.0.1", "m=audio 4000 RTP/AVP 8 101", "a=rtpmap:8 PCMA/8000", "a=rtpmap:101 telephone-event/8000"} {
+		if !strings.Contains(answer, line+"\r\n") {
+			t.Errorf("answer does not contain %q:\n%s", line, answer)
+		}
+	}
+
+	answer = string(answerSDP(ip, 4000, PayloadTypePCMU, 0))
+	if !strings.Contains(answer, "m=audio 4000 RTP/AVP 0\r\n") || strings.Contains(answer, "telephone-event") {
+		t.Errorf("answer without telephone events:\n%s", answer)
+	}
+
+	// The answer is understood by our own parser.
+	sd, err := parseSDP([]byte(answer))
+	if err != nil || sd.port != 4000 || !sd.ip.Equal(ip) {
+		t.Fatalf("parse answer: %+v %v", sd, err)
+	}
+}
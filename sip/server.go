@@ -0,0 +1,291 @@
+package sip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Handler is called in its own goroutine for each established call.
+type Handler func(ctx context.Context, call *Call)
+
+// Server accepts incoming SIP calls on a UDP socket.
+type Server struct {
+	conn *net.UDPConn
+	// IP address that is announced in SDP answers and Contact headers.
+	// If nil, the address of the interface that routes to the caller is used.
+	publicIP net.IP
+
+	calls   map[string]*Call // By Call-ID.
+	callsMu sync.Mutex
+
+	log zerolog.Logger
+}
+
+// Listen returns a server listening for SIP messages on the given UDP address.
+// publicIP is announced to callers as the address of the server, it may be empty.
+func Listen(addr, publicIP string, log zerolog.Logger) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve sip address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen udp for sip: %w", err)
+	}
+	return &Server{
+		conn:     conn,
+		publicIP: net.ParseIP(publicIP),
+		calls:    map[string]*Call{},
+		log:      log.With().Str("sip_addr", conn.LocalAddr().String()).Logger(),
+	}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve handles incoming SIP messages until the context is cancelled.
+// The handler is called for each call after it has been answered.
+func (s *Server) Serve(ctx context.Context, handler Handler) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		_ = s.conn.Close()
+	}()
+
+	s.log.Info().Msg("Start SIP user agent")
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				s.hangupAll()
+				s.log.Info().Msg("Stopped SIP user agent")
+				return nil
+			}
+			return fmt.Errorf("read sip message: %w", err)
+		}
+
+		msg, err := ParseMessage(buf[:n])
+		if err != nil {
+			s.log.Warn().Err(err).Str("remote_addr", addr.String()).Msg("Dropped invalid SIP message")
+			continue
+		}
+
+		if !msg.IsRequest() {
+			s.handleResponse(msg)
+			continue
+		}
+
+		if call := s.handleRequest(msg, addr); call != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler(ctx, call)
+			}()
+		}
+	}
+}
+
+// handleRequest handles the request and returns the new call, if an INVITE created one.
+func (s *Server) handleRequest(req *Message, addr *net.UDPAddr) *Call {
+	callID := req.Get("Call-ID")
+	l := s.log.With().
+		Str("sip_method", req.Method).
+		Str("call_id", callID).
+		Str("remote_addr", addr.String()).
+		Logger()
+
+	s.callsMu.Lock()
+	call, exists := s.calls[callID]
+	s.callsMu.Unlock()
+
+	switch req.Method {
+	case "INVITE":
+		if exists {
+			call.handleInviteRetransmission(req)
+			return nil
+		}
+		call, err := s.answer(req, addr, l)
+		if err != nil {
+			l.Err(err).Msg("Failed to answer call")
+			return nil
+		}
+		return call
+	case "ACK":
+		if exists {
+			call.handleAck()
+		}
+	case "BYE":
+		if !exists {
+			s.send(newResponse(req, 481, "Call/Transaction Does Not Exist"), addr)
+			return nil
+		}
+		s.send(newResponse(req, 200, "OK"), addr)
+		call.end("remote hangup")
+	case "CANCEL":
+		if !exists {
+			s.send(newResponse(req, 481, "Call/Transaction Does Not Exist"), addr)
+			return nil
+		}
+		s.send(newResponse(req, 200, "OK"), addr)
+		call.end("cancelled")
+	case "OPTIONS":
+		resp := newResponse(req, 200, "OK")
+		resp.Add("Allow", "INVITE, ACK, BYE, CANCEL, OPTIONS")
+		s.send(resp, addr)
+	default:
+		l.Warn().Msg("Received unsupported SIP request")
+		s.send(newResponse(req, 501, "Not Implemented"), addr)
+	}
+	return nil
+}
+
+// handleResponse passes responses to requests that we sent, i.e. BYE, to their call.
+func (s *Server) handleResponse(resp *Message) {
+	s.callsMu.Lock()
+	call, ok := s.calls[resp.Get("Call-ID")]
+	s.callsMu.Unlock()
+	if ok {
+		call.handleResponse(resp)
+	}
+}
+
+// answer negotiates the media of the INVITE and answers it.
+func (s *Server) answer(req *Message, addr *net.UDPAddr, l zerolog.Logger) (*Call, error) {
+	s.send(newResponse(req, 100, "Trying"), addr)
+
+	offer, err := parseSDP(req.Body)
+	if err != nil {
+		s.send(newResponse(req, 488, "Not Acceptable Here"), addr)
+		return nil, err
+	}
+	codec, ok := offer.selectCodec()
+	if !ok {
+		s.send(newResponse(req, 488, "Not Acceptable Here"), addr)
+		return nil, errors.New("caller does not support G.711")
+	}
+
+	localIP := s.localIP(addr)
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.listenIP()})
+	if err != nil {
+		s.send(newResponse(req, 500, "Server Internal Error"), addr)
+		return nil, fmt.Errorf("listen udp for rtp: %w", err)
+	}
+
+	call := newCall(s, req, addr, rtpConn, offer, codec, l)
+
+	resp := newResponse(req, 200, "OK")
+	resp.Set("To", req.Get("To")+";tag="+call.localTag)
+	resp.Add("Contact", fmt.Sprintf("<sip:voipttt@%s>", s.contactAddr(localIP)))
+	resp.Add("Allow", "INVITE, ACK, BYE, CANCEL, OPTIONS")
+	resp.Add("Content-Type", "application/sdp")
+	resp.Body = answerSDP(localIP, rtpConn.LocalAddr().(*net.UDPAddr).Port, codec, offer.telephoneEvent)
+
+	s.callsMu.Lock()
+	s.calls[call.callID] = call
+	s.callsMu.Unlock()
+
+	l.Info().
+		Str("caller", call.Caller()).
+		Uint8("payload_type", codec).
+		Uint8("telephone_event", offer.telephoneEvent).
+		Msg("Answer call")
+
+	call.start(resp)
+	return call, nil
+}
+
+// removeCall is called by a call once it has ended.
+func (s *Server) removeCall(call *Call) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	delete(s.calls, call.callID)
+}
+
+// hangupAll ends all calls, used when the server is stopped.
+func (s *Server) hangupAll() {
+	s.callsMu.Lock()
+	calls := make([]*Call, 0, len(s.calls))
+	for _, call := range s.calls {
+		calls = append(calls, call)
+	}
+	s.callsMu.Unlock()
+
+	for _, call := range calls {
+		call.end("server stopped")
+	}
+}
+
+// send sends the message to the given address.
+func (s *Server) send(msg *Message, addr *net.UDPAddr) {
+	if _, err := s.conn.WriteToUDP(msg.Marshal(), addr); err != nil {
+		s.log.Err(err).Str("remote_addr", addr.String()).Msg("Failed to send SIP message")
+	}
+}
+
+// listenIP returns the IP address of the SIP socket, used to bind RTP sockets
+// to the same interface.
+func (s *Server) listenIP() net.IP {
+	return s.conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// localIP returns the IP address that the caller at addr can reach us at.
+func (s *Server) localIP(addr *net.UDPAddr) net.IP {
+	if s.publicIP != nil {
+		return s.publicIP
+	}
+	if ip := s.listenIP(); !ip.IsUnspecified() {
+		return ip
+	}
+	// Let the OS pick the interface that routes to the caller.
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// contactAddr returns the host and port of the Contact header.
+func (s *Server) contactAddr(ip net.IP) string {
+	port := s.conn.LocalAddr().(*net.UDPAddr).Port
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
+
+// randomToken returns a random hex string used for tags and branches.
+func randomToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// randomUint32 returns a random number used for the initial state of RTP streams.
+func randomUint32() uint32 {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return binary.BigEndian.Uint32(b)
+}
+
+// isSameTransaction returns whether both requests belong to the same transaction.
+func isSameTransaction(a, b *Message) bool {
+	branch := func(m *Message) string {
+		return headerParam(m.Get("Via"), "branch")
+	}
+	seqA, _ := a.CSeq()
+	seqB, _ := b.CSeq()
+	return seqA == seqB && strings.EqualFold(branch(a), branch(b))
+}
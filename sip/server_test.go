@@ -0,0 +1,333 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/rtp"
+)
+
+// testCaller is a SIP phone that calls the server over UDP.
+type testCaller struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	server *net.UDPAddr
+	// Receives the RTP stream of the server, only used for its address in the offer.
+	rtpConn *net.UDPConn
+	callID  string
+	cseq    int
+	// To header of the 200 OK, which contains the tag of the server.
+	to string
+}
+
+func newTestCaller(t *testing.T, server net.Addr, callID string) *testCaller {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rtpConn.Close() })
+	return &testCaller{t: t, conn: conn, server: server.(*net.UDPAddr), rtpConn: rtpConn, callID: callID}
+}
+
+// request returns a request within the dialog of the caller.
+func (c *testCaller) request(method string, cseq int) *Message {
+	m := &Message{Method: method, RequestURI: "sip:voipttt@" + c.server.String()}
+	m.Add("Via", fmt.Sprintf("SIP/2.0/UDP %s;branch=z9hG4bK%s%d", c.conn.LocalAddr(), method, cseq))
+	m.Add("From", fmt.Sprintf("<sip:100@%s>;tag=caller", c.conn.LocalAddr()))
+	if c.to != "" {
+		m.Add("To", c.to)
+	} else {
+		m.Add("To", "<sip:voipttt@"+c.server.String()+">")
+	}
+	m.Add("Call-ID", c.callID)
+	m.Add("CSeq", fmt.Sprintf("%d %s", cseq, method))
+	m.Add("Contact", fmt.Sprintf("<sip:100@%s>", c.conn.LocalAddr()))
+	return m
+}
+
+func (c *testCaller) send(m *Message) {
+	c.t.Helper()
+	if _, err := c.conn.WriteToUDP(m.Marshal(), c.server); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads messages until one matches, skipping provisional responses and retransmissions.
+func (c *testCaller) expect(match func(*Message) bool) *Message {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 65535)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			c.t.Fatalf("did not receive the expected message: %v", err)
+		}
+		m, err := ParseMessage(buf[:n])
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if match(m) {
+			return m
+		}
+	}
+}
+
+// expectResponse waits for the final response to the given method.
+func (c *testCaller) expectResponse(method string, statusCode int) *Message {
+	c.t.Helper()
+	return c.expect(func(m *Message) bool {
+		_, cseqMethod := m.CSeq()
+		if m.IsRequest() || cseqMethod != method || m.StatusCode < 200 {
+			return false
+		}
+		if m.StatusCode != statusCode {
+			c.t.Fatalf("got response %d %s to %s, want %d", m.StatusCode, m.Reason, method, statusCode)
+		}
+		return true
+	})
+}
+
+// invite calls the server and returns the RTP address of the server once the call is established.
+func (c *testCaller) invite() *net.UDPAddr {
+	c.t.Helper()
+	c.cseq++
+	invite := c.request("INVITE", c.cseq)
+	invite.Add("Content-Type", "application/sdp")
+	invite.Body = []byte(fmt.Sprintf(
+		"v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=-\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\n"+
+			"m=audio %d RTP/AVP 0 101\r\na=rtpmap:0 PCMU/8000\r\na=rtpmap:101 telephone-event/8000\r\n",
+		c.rtpConn.LocalAddr().(*net.UDPAddr).Port,
+	))
+	c.send(invite)
+
+	ok := c.expectResponse("INVITE", 200)
+	if headerParam(ok.Get("To"), "tag") == "" {
+		c.t.Fatalf("200 OK does not contain a To tag: %q", ok.Get("To"))
+	}
+	c.to = ok.Get("To")
+	answer, err := parseSDP(ok.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if answer.telephoneEvent != 101 {
+		c.t.Fatalf("answer does not accept telephone events: %s", ok.Body)
+	}
+
+	c.send(c.request("ACK", c.cseq))
+	return &net.UDPAddr{IP: answer.ip, Port: answer.port}
+}
+
+// sendRTP sends an RTP packet to the server.
+func (c *testCaller) sendRTP(addr *net.UDPAddr, packet rtp.Packet) {
+	c.t.Helper()
+	if _, err := c.rtpConn.WriteToUDP(packet.Marshal(), addr); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// pressKey sends the RFC 4733 telephone event of a key press, the end of the event
+// is sent three times as recommended by the RFC.
+func (c *testCaller) pressKey(addr *net.UDPAddr, event byte, timestamp uint32) {
+	c.t.Helper()
+	c.sendRTP(addr, rtp.Packet{
+		Header:  rtp.Header{Marker: true, PayloadType: 101, Timestamp: timestamp},
+		Payload: []byte{event, 10, 0, 160},
+	})
+	for i := 0; i < 3; i++ {
+		c.sendRTP(addr, rtp.Packet{
+			Header:  rtp.Header{PayloadType: 101, Timestamp: timestamp},
+			Payload: []byte{event, 0x80 | 10, 3, 32},
+		})
+	}
+}
+
+func startServer(t *testing.T) (*Server, <-chan *Call) {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", "", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan *Call, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(ctx, func(ctx context.Context, call *Call) {
+			calls <- call
+			<-call.Done()
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, calls
+}
+
+func acceptCall(t *testing.T, calls <-chan *Call) *Call {
+	t.Helper()
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(time.Second * 5):
+		t.Fatal("handler was not called")
+		return nil
+	}
+}
+
+func TestServerCall(t *testing.T) {
+	s, calls := startServer(t)
+	caller := newTestCaller(t, s.Addr(), "call-1")
+
+	rtpAddr := caller.invite()
+	call := acceptCall(t, calls)
+	if call.Caller() != "100" || call.Codec() != PayloadTypePCMU {
+		t.Fatalf("got caller %q with codec %d", call.Caller(), call.Codec())
+	}
+
+	caller.pressKey(rtpAddr, 5, 160)
+	caller.pressKey(rtpAddr, 11, 320)
+	// Telephone events out of range are ignored.
+	caller.pressKey(rtpAddr, 42, 480)
+	caller.sendRTP(rtpAddr, rtp.Packet{Header: rtp.Header{PayloadType: 0}, Payload: []byte{0xff, 0x7f}})
+
+	for _, want := range []rune{'5', '#'} {
+		select {
+		case got := <-call.DTMF():
+			if got != want {
+				t.Fatalf("got key %q, want %q", got, want)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("did not receive key %q", want)
+		}
+	}
+	select {
+	case got := <-call.DTMF():
+		t.Fatalf("received repeated or invalid key %q", got)
+	default:
+	}
+	select {
+	case samples := <-call.Audio():
+		if len(samples) != 2 || samples[0] != 0xff {
+			t.Fatalf("got audio %v", samples)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("did not receive audio")
+	}
+
+	caller.cseq++
+	caller.send(caller.request("BYE", caller.cseq))
+	caller.expectResponse("BYE", 200)
+	select {
+	case <-call.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("call did not end after BYE")
+	}
+
+	// The dialog is gone once the call ended.
+	caller.cseq++
+	caller.send(caller.request("BYE", caller.cseq))
+	caller.expectResponse("BYE", 481)
+}
+
+func TestServerHangup(t *testing.T) {
+	s, calls := startServer(t)
+	caller := newTestCaller(t, s.Addr(), "call-2")
+	caller.invite()
+	call := acceptCall(t, calls)
+
+	hangupErr := make(chan error, 1)
+	go func() { hangupErr <- call.Hangup(context.Background()) }()
+
+	bye := caller.expect(func(m *Message) bool { return m.Method == "BYE" })
+	if bye.Get("Call-ID") != "call-2" || headerParam(bye.Get("To"), "tag") != "caller" {
+		t.Fatalf("got BYE outside of the dialog: %s", bye.Marshal())
+	}
+	_, _ = caller.conn.WriteToUDP(newResponse(bye, 200, "OK").Marshal(), caller.server)
+
+	if err := <-hangupErr; err != nil {
+		t.Fatalf("hangup failed: %v", err)
+	}
+	<-call.Done()
+}
+
+func TestServerRejectsOffer(t *testing.T) {
+	s, _ := startServer(t)
+	caller := newTestCaller(t, s.Addr(), "call-3")
+
+	invite := caller.request("INVITE", 1)
+	invite.Body = []byte("v=0\r\nc=IN IP4 127.0.0.1\r\nm=audio " +
+		strconv.Itoa(caller.rtpConn.LocalAddr().(*net.UDPAddr).Port) + " RTP/AVP 9\r\n")
+	caller.send(invite)
+	caller.expectResponse("INVITE", 488)
+
+	caller.send(caller.request("OPTIONS", 2))
+	if allow := caller.expectResponse("OPTIONS", 200).Get("Allow"); allow == "" {
+		t.Fatal("OPTIONS response does not contain the allowed methods")
+	}
+	caller.send(caller.request("SUBSCRIBE", 3))
+	caller.expectResponse("SUBSCRIBE", 501)
+}
+
+func TestCallSendAudio(t *testing.T) {
+	s, calls := startServer(t)
+	caller := newTestCaller(t, s.Addr(), "call-4")
+	caller.invite()
+	call := acceptCall(t, calls)
+
+	samples := make([]byte, 400)
+	for i := range samples {
+		samples[i] = byte(i)
+	}
+	if err := call.SendAudio(context.Background(), samples); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1500)
+	var first rtp.Packet
+	for i, size := range []int{160, 160, 80} {
+		_ = caller.rtpConn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		n, err := caller.rtpConn.Read(buf)
+		if err != nil {
+			t.Fatalf("did not receive packet %d: %v", i, err)
+		}
+		var p rtp.Packet
+		if err := p.Unmarshal(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = p
+		}
+		if p.Marker != (i == 0) ||
+			p.PayloadType != PayloadTypePCMU ||
+			p.SSRC != first.SSRC ||
+			p.SequenceNumber != first.SequenceNumber+uint16(i) ||
+			p.Timestamp != first.Timestamp+uint32(i*160) ||
+			len(p.Payload) != size ||
+			p.Payload[0] != byte(i*160) {
+			t.Fatalf("got packet %d %+v with %d bytes", i, p.Header, len(p.Payload))
+		}
+	}
+
+	// Playback stops once the caller hung up.
+	caller.cseq++
+	caller.send(caller.request("BYE", caller.cseq))
+	caller.expectResponse("BYE", 200)
+	<-call.Done()
+	if err := call.SendAudio(context.Background(), samples); !errors.Is(err, ErrHungUp) {
+		t.Fatalf("got error %v, want %v", err, ErrHungUp)
+	}
+}
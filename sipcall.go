@@ -0,0 +1,212 @@
+package voipttt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/audio"
+	"github.com/n9v9/voip-ttt/sip"
+)
+
+// SIPConfig configures the built-in SIP user agent.
+type SIPConfig struct {
+	// Addr is the UDP address to listen on for SIP messages, e.g. `:5060`.
+	Addr string
+	// PublicIP is the IP address announced to callers. If empty, the address of
+	// the interface that routes to the caller is used.
+	PublicIP string
+	// SoundsDir is the directory of the voice prompts that guide SIP callers through
+	// the game, see the Sound constants. Each prompt is a WAV file, e.g.
+	// `voipttt/your-turn.wav`, and digits are read from `digits/0.wav` to `digits/9.wav`.
+	// Callers do not hear any prompts if it is empty.
+	SoundsDir string
+}
+
+// sipCall is the CallSession of a call that is handled by the built-in SIP user agent
+// and therefore does not require asterisk.
+type sipCall struct {
+	call        *sip.Call
+	phoneNumber PhoneNumber
+	soundsDir   string // May be empty.
+	log         zerolog.Logger
+}
+
+func newSIPCall(call *sip.Call, soundsDir string, log zerolog.Logger) *sipCall {
+	phoneNumber := PhoneNumber(call.Caller())
+	if phoneNumber == "" {
+		phoneNumber = PhoneNumber(call.RemoteAddr().String())
+	}
+	return &sipCall{
+		call:        call,
+		phoneNumber: phoneNumber,
+		soundsDir:   soundsDir,
+		log:         log.With().Str("phone_number", string(phoneNumber)).Logger(),
+	}
+}
+
+// readInput returns the keys pressed by the caller as described by the spec.
+func (sc *sipCall) readInput(ctx context.Context, spec InputSpec) (string, error) {
+	keys, err := spec.Read(func(timeout time.Duration) (rune, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-sc.call.Done():
+			return 0, sip.ErrHungUp
+		case <-time.After(timeout):
+			return 0, nil
+		case key := <-sc.call.DTMF():
+			return key, nil
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	sc.log.Info().Str("digits", keys).Msg("Received final digits")
+	return keys, nil
+}
+
+func (sc *sipCall) ReadMove(ctx context.Context, spec InputSpec) (string, error) {
+	return sc.readInput(ctx, spec)
+}
+
+// StartAudio is a no-op, the audio stream is registered as soon as the code is verified.
+func (sc *sipCall) StartAudio(_ context.Context) error {
+	return nil
+}
+
+// Announce plays the voice prompts of the announcement over the call and returns once
+// they are played, just like the announce webhook of vt-client does.
+func (sc *sipCall) Announce(ctx context.Context, announcement Announcement) error {
+	if sc.soundsDir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(announcement.Data)
+	if err != nil {
+		return fmt.Errorf("encode announcement %s: %w", announcement.Type, err)
+	}
+	prompts, err := announcementRequest{Type: announcement.Type, Data: data}.prompts()
+	if err != nil {
+		return err
+	}
+	return sc.play(ctx, prompts)
+}
+
+// play plays the prompts one after another.
+func (sc *sipCall) play(ctx context.Context, prompts []Prompt) error {
+	for _, prompt := range prompts {
+		files := []string{prompt.Sound}
+		if prompt.Sound == "" {
+			files = files[:0]
+			for _, digit := range prompt.Digits {
+				files = append(files, "digits/"+string(digit))
+			}
+		}
+		for _, file := range files {
+			samples, err := sc.loadSound(file)
+			if err != nil {
+				return err
+			}
+			if err := sc.call.SendAudio(ctx, samples); err != nil {
+				return fmt.Errorf("play %s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadSound reads the WAV file of the given sound and encodes it with the codec of the call.
+func (sc *sipCall) loadSound(name string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(sc.soundsDir, filepath.FromSlash(name)+".wav"))
+	if err != nil {
+		return nil, fmt.Errorf("open sound: %w", err)
+	}
+	defer f.Close()
+
+	format, data, err := audio.ReadWAV(f)
+	if err != nil {
+		return nil, fmt.Errorf("read sound %s: %w", name, err)
+	}
+	return audio.NewConverter(format, (&sipAudioStream{call: sc.call}).Format()).Convert(data), nil
+}
+
+func (sc *sipCall) Hangup(ctx context.Context) error {
+	return sc.call.Hangup(ctx)
+}
+
+func (sc *sipCall) Done() <-chan struct{} {
+	return sc.call.Done()
+}
+
+// sipAudioStream is the G.711 encoded audio of a SIP call.
+type sipAudioStream struct {
+	call *sip.Call
+}
+
+func (sas *sipAudioStream) ReadAudio() ([]byte, error) {
+	select {
+	case <-sas.call.Done():
+		return nil, io.EOF
+	case data := <-sas.call.Audio():
+		return data, nil
+	}
+}
+
+func (sas *sipAudioStream) Format() audio.Format {
+	f := audio.FormatTelephone
+	if sas.call.Codec() == sip.PayloadTypePCMA {
+		f.Encoding = audio.EncodingALaw
+	} else {
+		f.Encoding = audio.EncodingULaw
+	}
+	return f
+}
+
+func (sas *sipAudioStream) RemoteAddr() net.Addr {
+	return sas.call.RemoteAddr()
+}
+
+// Close is a no-op, the stream ends with the call.
+func (sas *sipAudioStream) Close() error {
+	return nil
+}
+
+// handleSIPCall prompts the caller of the SIP call for the verification code, just like
+// vt-client does over AGI, and then hands the call over to the game.
+func (wsm *webSocketManager) handleSIPCall(ctx context.Context, call *sip.Call, soundsDir string, log zerolog.Logger) {
+	sc := newSIPCall(call, soundsDir, log)
+
+	if sc.soundsDir != "" {
+		if err := sc.play(ctx, []Prompt{{Sound: SoundEnterCode}}); err != nil {
+			sc.log.Err(err).Msg("Failed to play prompt")
+		}
+	}
+
+	sc.log.Info().Msg("Waiting for verification code")
+	digits, err := sc.readInput(ctx, CodeInputSpec)
+	if err != nil {
+		sc.log.Err(err).Msg("Failed to read verification code")
+		_ = call.Hangup(ctx)
+		return
+	}
+
+	code, err := strconv.ParseUint(digits, 10, 64)
+	if err == nil {
+		wsm.registerAudioConnection(sc.phoneNumber, &sipAudioStream{call: call})
+		err = wsm.verifyCode(VerificationCode(code), sc.phoneNumber, sc)
+	}
+	if err != nil {
+		sc.log.Err(err).Str("digits", digits).Msg("Failed to verify code")
+		wsm.removeAudioConnection(sc.phoneNumber)
+		_ = call.Hangup(ctx)
+	}
+}
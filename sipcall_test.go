@@ -0,0 +1,147 @@
+package voipttt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/n9v9/voip-ttt/rtp"
+	"github.com/n9v9/voip-ttt/sip"
+)
+
+// writeSound writes a μ-law WAV file with a single sample, which identifies the sound
+// in the RTP stream.
+func writeSound(t *testing.T, dir, name string, sample byte) {
+	t.Helper()
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	_ = binary.Write(&wav, binary.LittleEndian, uint32(4+8+16+8+2))
+	wav.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(7), uint16(1), uint32(8000), uint32(8000), uint16(1), uint16(8)} {
+		_ = binary.Write(&wav, binary.LittleEndian, v)
+	}
+	wav.WriteString("data")
+	_ = binary.Write(&wav, binary.LittleEndian, uint32(1))
+	wav.Write([]byte{sample, 0})
+
+	path := filepath.Join(dir, filepath.FromSlash(name)+".wav")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, wav.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialSIP calls the SIP server offering PCMU and returns the socket receiving the audio.
+func dialSIP(t *testing.T, server net.Addr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, server.(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rtpConn.Close() })
+
+	sdp := fmt.Sprintf("v=0\r\nc=IN IP4 127.0.0.1\r\nm=audio %d RTP/AVP 0\r\n", rtpConn.LocalAddr().(*net.UDPAddr).Port)
+	headers := fmt.Sprintf("Via: SIP/2.0/UDP %s;branch=z9hG4bK1\r\nFrom: <sip:100@127.0.0.1>;tag=1\r\n"+
+		"To: <sip:play@%s>\r\nCall-ID: announce\r\n", conn.LocalAddr(), server)
+	invite := fmt.Sprintf("INVITE sip:play@%s SIP/2.0\r\n%sCSeq: 1 INVITE\r\nContent-Length: %d\r\n\r\n%s", server, headers, len(sdp), sdp)
+	if _, err := conn.Write([]byte(invite)); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("call was not answered: %v", err)
+		}
+		if strings.HasPrefix(string(buf[:n]), "SIP/2.0 200") {
+			break
+		}
+	}
+	ack := fmt.Sprintf("ACK sip:play@%s SIP/2.0\r\n%sCSeq: 1 ACK\r\n\r\n", server, headers)
+	if _, err := conn.Write([]byte(ack)); err != nil {
+		t.Fatal(err)
+	}
+	return rtpConn
+}
+
+func TestSIPCallAnnounce(t *testing.T) {
+	dir := t.TempDir()
+	sounds := map[byte]string{
+		1: SoundOpponentHungUp,
+		2: SoundYouWin,
+		3: SoundSeriesScore,
+		4: "digits/2",
+		5: SoundScoreTo,
+		6: "digits/1",
+		7: SoundYouWinSeries,
+	}
+	for sample, name := range sounds {
+		writeSound(t, dir, name, sample)
+	}
+
+	server, err := sip.Listen("127.0.0.1:0", "", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	announced := make(chan error, 1)
+	go func() {
+		_ = server.Serve(ctx, func(ctx context.Context, call *sip.Call) {
+			sc := newSIPCall(call, dir, zerolog.Nop())
+			announced <- sc.Announce(ctx, Announcement{
+				Type: string(messageGameDone),
+				Data: &dataGameDone{
+					HasWinner:      true,
+					IsPlayerWinner: true,
+					Reason:         gameDoneHangup,
+					Series:         &dataSeries{Series: 1, Games: 3, BestOf: 3, PlayerWins: 2, OpponentWins: 1, Done: true},
+				},
+			})
+			_ = sc.Hangup(ctx)
+		})
+	}()
+
+	rtpConn := dialSIP(t, server.Addr())
+	if err := <-announced; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	buf := make([]byte, 1500)
+	for len(got) < len(sounds) {
+		_ = rtpConn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		n, err := rtpConn.Read(buf)
+		if err != nil {
+			t.Fatalf("received only %q: %v", got, err)
+		}
+		var p rtp.Packet
+		if err := p.Unmarshal(buf[:n]); err != nil || len(p.Payload) != 1 {
+			t.Fatalf("got invalid packet: %v", err)
+		}
+		got = append(got, sounds[p.Payload[0]])
+	}
+
+	want := []string{SoundOpponentHungUp, SoundYouWin, SoundSeriesScore, "digits/2", SoundScoreTo, "digits/1", SoundYouWinSeries}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("played %q, want %q", got, want)
+	}
+}
@@ -1,55 +1,148 @@
 package voipttt
 
-import "math/rand"
+import (
+	"fmt"
+	"strconv"
+)
 
-type player int
+// GameMisereTicTacToe is the name of misère Tic-Tac-Toe.
+const GameMisereTicTacToe = "misere-tic-tac-toe"
 
+// Variants of the rules of Tic-Tac-Toe.
 const (
-	playerNone player = 0 // The field is free.
-	playerOne  player = 1
-	playerTwo  player = 2
+	variantMisere  = "MISERE"  // The player who completes three in a row loses.
+	variantNotakto = "NOTAKTO" // Both players place X, completing three in a row loses.
 )
 
+// ticTacToeLines are the zero based fields of all rows, columns and diagonals.
+var ticTacToeLines = [...][3]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+	{0, 4, 8}, {2, 4, 6},
+}
+
 // ticTacToe represents an active game of Tic-Tac-Toe between
 // two players.
 type ticTacToe struct {
-	fields [9]player
+	fields [9]Player
+	turn   Player
+	// history are the zero based fields of all moves, -1 for a skipped turn.
+	history []int
+	// variant is the variant of the rules, empty for the standard rules.
+	// Only variantMisere is supported.
+	variant string
 }
 
-// selectField selects the given field for the given player.
-// The field number is zero based.
-// It is the callers responsibility to check before this call, that
-// the game is not done yet.
-func (t *ticTacToe) selectField(field int, isPlayerOne bool) bool {
-	if t.fields[field] == playerNone {
-		if isPlayerOne {
-			t.fields[field] = playerOne
-		} else {
-			t.fields[field] = playerTwo
-		}
-		return true
+func (t *ticTacToe) Turn() Player {
+	if t.turn == PlayerNone {
+		return PlayerOne
 	}
-	return false
+	return t.turn
 }
 
-// selectRandomField makes a random selection for the given player
-// returning the selected, zero based field.
-// It is the callers responsibility to check before this call, that
-// the game is not done yet.
-func (t *ticTacToe) selectRandomField(isPlayerOne bool) int {
-	var free []int
+// Moves returns the free fields as digits from 1 to 9.
+func (t *ticTacToe) Moves() []string {
+	if t.done() {
+		return nil
+	}
+	var moves []string
 	for i, v := range t.fields {
-		if v == playerNone {
-			free = append(free, i)
+		if v == PlayerNone {
+			moves = append(moves, strconv.Itoa(i+1))
 		}
 	}
-	field := free[rand.Intn(len(free))]
-	if isPlayerOne {
-		t.fields[field] = playerOne
-	} else {
-		t.fields[field] = playerTwo
+	return moves
+}
+
+// Play selects the field of the given digit from 1 to 9.
+func (t *ticTacToe) Play(move string) error {
+	field, err := strconv.Atoi(move)
+	if err != nil || field < 1 || field > len(t.fields) {
+		return fmt.Errorf("%w: %q is not a field", ErrInvalidMove, move)
+	}
+	if t.done() {
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	}
+	if !t.selectField(field-1, t.Turn()) {
+		return fmt.Errorf("%w: field %d is already taken", ErrIllegalMove, field)
+	}
+	t.turn = t.Turn().Opponent()
+	t.history = append(t.history, field-1)
+	return nil
+}
+
+func (t *ticTacToe) Skip() {
+	t.turn = t.Turn().Opponent()
+	t.history = append(t.history, -1)
+}
+
+func (t *ticTacToe) Undo() bool {
+	if len(t.history) == 0 {
+		return false
+	}
+	field := t.history[len(t.history)-1]
+	t.history = t.history[:len(t.history)-1]
+	if field >= 0 {
+		t.fields[field] = PlayerNone
+	}
+	t.turn = t.Turn().Opponent()
+	return true
+}
+
+func (t *ticTacToe) Outcome() Outcome {
+	winner, _, _ := t.hasWinner()
+	if t.variant == variantMisere {
+		// The player with three in a row loses.
+		winner = winner.Opponent()
+	}
+	return Outcome{
+		Done:   t.done(),
+		Winner: winner,
 	}
-	return field
+}
+
+func (t *ticTacToe) Variant() string {
+	return t.variant
+}
+
+func (t *ticTacToe) State() any {
+	fields := make([]Player, len(t.fields))
+	copy(fields, t.fields[:])
+	return &gridState{
+		Rows:   3,
+		Cols:   3,
+		Fields: fields,
+	}
+}
+
+func (t *ticTacToe) Input() InputSpec {
+	return MoveInputSpec
+}
+
+func (t *ticTacToe) Fields() []field {
+	fields := make([]field, len(t.fields))
+	for i, owner := range t.fields {
+		fields[i] = field{Move: strconv.Itoa(i + 1), Owner: owner}
+	}
+	return fields
+}
+
+func (t *ticTacToe) Clone() Game {
+	clone := *t
+	clone.history = append([]int(nil), t.history...)
+	return &clone
+}
+
+// selectField selects the given field for the given player.
+// The field number is zero based.
+// It is the callers responsibility to check before this call, that
+// the game is not done yet.
+func (t *ticTacToe) selectField(field int, player Player) bool {
+	if t.fields[field] == PlayerNone {
+		t.fields[field] = player
+		return true
+	}
+	return false
 }
 
 // done returns whether the game is over, either because
@@ -59,7 +152,7 @@ func (t *ticTacToe) done() bool {
 		return true
 	}
 	for _, v := range t.fields {
-		if v == playerNone {
+		if v == PlayerNone {
 			return false
 		}
 	}
@@ -70,39 +163,20 @@ func (t *ticTacToe) done() bool {
 // If it does, the winning player and the winning combination
 // are set accordingly. The winning combination is zero based.
 // The returned player is one of the above defined constants.
-func (t *ticTacToe) hasWinner() (winner player, fields [3]byte, ok bool) {
-	check := func(player player) ([3]byte, bool) {
-		if t.fields[0] == player && t.fields[1] == player && t.fields[2] == player {
-			return [...]byte{1, 2, 3}, true
-		}
-		if t.fields[3] == player && t.fields[4] == player && t.fields[5] == player {
-			return [...]byte{4, 5, 6}, true
-		}
-		if t.fields[6] == player && t.fields[7] == player && t.fields[8] == player {
-			return [...]byte{7, 8, 9}, true
-		}
-		if t.fields[0] == player && t.fields[3] == player && t.fields[6] == player {
-			return [...]byte{1, 4, 7}, true
-		}
-		if t.fields[1] == player && t.fields[4] == player && t.fields[7] == player {
-			return [...]byte{2, 5, 8}, true
-		}
-		if t.fields[2] == player && t.fields[5] == player && t.fields[8] == player {
-			return [...]byte{3, 6, 9}, true
-		}
-		if t.fields[0] == player && t.fields[4] == player && t.fields[8] == player {
-			return [...]byte{1, 5, 9}, true
-		}
-		if t.fields[2] == player && t.fields[4] == player && t.fields[6] == player {
-			return [...]byte{3, 5, 7}, true
+func (t *ticTacToe) hasWinner() (winner Player, fields [3]byte, ok bool) {
+	check := func(player Player) ([3]byte, bool) {
+		for _, line := range ticTacToeLines {
+			if t.fields[line[0]] == player && t.fields[line[1]] == player && t.fields[line[2]] == player {
+				return [...]byte{byte(line[0] + 1), byte(line[1] + 1), byte(line[2] + 1)}, true
+			}
 		}
 		return [3]byte{}, false
 	}
-	if fields, ok := check(playerOne); ok {
-		return playerOne, fields, true
+	if fields, ok := check(PlayerOne); ok {
+		return PlayerOne, fields, true
 	}
-	if fields, ok := check(playerTwo); ok {
-		return playerTwo, fields, true
+	if fields, ok := check(PlayerTwo); ok {
+		return PlayerTwo, fields, true
 	}
 	return 0, [3]byte{}, false
 }
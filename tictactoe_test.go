@@ -0,0 +1,134 @@
+package voipttt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMisereTicTacToeInvertsWinner(t *testing.T) {
+	tests := []struct {
+		variant string
+		want    Player
+	}{
+		{variant: "", want: PlayerOne},
+		{variant: variantMisere, want: PlayerTwo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.variant, func(t *testing.T) {
+			g := &ticTacToe{variant: tt.variant}
+			// Player one completes the top row.
+			playMoves(t, g, "1", "4", "2", "5", "3")
+
+			if outcome := g.Outcome(); outcome != (Outcome{Done: true, Winner: tt.want}) {
+				t.Fatalf("got %+v, want a win of %v", outcome, tt.want)
+			}
+		})
+	}
+}
+
+func TestMisereTicTacToeDraw(t *testing.T) {
+	g := &ticTacToe{variant: variantMisere}
+	playMoves(t, g, "1", "2", "3", "5", "4", "6", "8", "7", "9")
+
+	if outcome := g.Outcome(); outcome != (Outcome{Done: true}) {
+		t.Fatalf("got %+v, want a draw", outcome)
+	}
+}
+
+func TestTicTacToeMoves(t *testing.T) {
+	g := new(ticTacToe)
+	if moves := g.Moves(); !reflect.DeepEqual(moves, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}) {
+		t.Fatalf("got moves %v, want all fields", moves)
+	}
+
+	playMoves(t, g, "5", "1")
+	if g.Turn() != PlayerOne {
+		t.Fatalf("got turn %v, want %v", g.Turn(), PlayerOne)
+	}
+	if moves := g.Moves(); !reflect.DeepEqual(moves, []string{"2", "3", "4", "6", "7", "8", "9"}) {
+		t.Fatalf("got moves %v, want the free fields", moves)
+	}
+
+	if err := g.Play("5"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v for an occupied field", err, ErrIllegalMove)
+	}
+	for _, move := range []string{"", "0", "10", "a", "1#"} {
+		if err := g.Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+	if g.Turn() != PlayerOne {
+		t.Fatal("rejected move changed the turn")
+	}
+}
+
+func TestTicTacToeOutcome(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []string
+		want  Outcome
+	}{
+		{name: "not done", moves: []string{"1", "5"}, want: Outcome{}},
+		{name: "column", moves: []string{"5", "1", "3", "4", "9", "7"}, want: Outcome{Done: true, Winner: PlayerTwo}},
+		{name: "diagonal", moves: []string{"3", "1", "5", "2", "7"}, want: Outcome{Done: true, Winner: PlayerOne}},
+		{name: "draw", moves: []string{"1", "2", "3", "5", "4", "6", "8", "7", "9"}, want: Outcome{Done: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := new(ticTacToe)
+			playMoves(t, g, tt.moves...)
+			if outcome := g.Outcome(); outcome != tt.want {
+				t.Fatalf("got %+v, want %+v", outcome, tt.want)
+			}
+			if tt.want.Done {
+				if moves := g.Moves(); moves != nil {
+					t.Fatalf("got moves %v after the game is over", moves)
+				}
+				if err := g.Play("1"); !errors.Is(err, ErrIllegalMove) {
+					t.Fatalf("got %v, want %v after the game is over", err, ErrIllegalMove)
+				}
+			}
+		})
+	}
+}
+
+func TestTicTacToeState(t *testing.T) {
+	g := new(ticTacToe)
+	playMoves(t, g, "1", "5", "9")
+
+	state, err := json.Marshal(g.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"rows":3,"cols":3,"fields":[1,0,0,0,2,0,0,0,1]}`; string(state) != want {
+		t.Fatalf("got state %s, want %s", state, want)
+	}
+}
+
+func TestTicTacToeUndo(t *testing.T) {
+	g := new(ticTacToe)
+	if g.Undo() {
+		t.Fatal("took back a move before the first move")
+	}
+
+	playMoves(t, g, "5", "1")
+	g.Skip()
+	for _, want := range []Player{PlayerOne, PlayerTwo, PlayerOne} {
+		if !g.Undo() {
+			t.Fatal("could not take back a move")
+		}
+		if g.Turn() != want {
+			t.Fatalf("got turn %v after the takeback, want %v", g.Turn(), want)
+		}
+	}
+	if g.fields != ([9]Player{}) {
+		t.Fatalf("got fields %v, want an empty board", g.fields)
+	}
+	if g.Undo() {
+		t.Fatal("took back more moves than were made")
+	}
+}
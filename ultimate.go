@@ -0,0 +1,215 @@
+package voipttt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GameUltimateTicTacToe is the name of Ultimate Tic-Tac-Toe.
+const GameUltimateTicTacToe = "ultimate-tic-tac-toe"
+
+// ultimateTicTacToe is a game of Ultimate Tic-Tac-Toe, which is played on nine
+// small boards that are arranged like the fields of Tic-Tac-Toe. A small board is
+// won like a game of Tic-Tac-Toe, the game is won with three small boards in a row.
+//
+// A move consists of two digits from 1 to 9, the small board and its field.
+// The field sends the opponent to the small board at the same position,
+// unless that board is already decided, in which case any board can be chosen.
+type ultimateTicTacToe struct {
+	boards [9]ticTacToe
+	turn   Player
+	// next is the small board of the next move from 1 to 9, 0 if any board can be chosen.
+	next int
+	// history are the zero based board and field of all moves as board*9+field,
+	// -1 for a skipped turn.
+	history []int
+}
+
+func newUltimateTicTacToe() Game {
+	return new(ultimateTicTacToe)
+}
+
+// smallBoardsState is the state of games that are played on several small boards
+// of Tic-Tac-Toe as it is shown on the website. The website arranges the fields in
+// blocks of 3 × 3 fields, one block per small board.
+type smallBoardsState struct {
+	gridState
+	// Boards are the players who decided each small board, PlayerNone while the board is open.
+	Boards []Player `json:"boards"`
+	// ActiveBoard is the small board of the next move from 1, 0 if any open board
+	// can be chosen.
+	ActiveBoard int `json:"activeBoard"`
+}
+
+func (u *ultimateTicTacToe) Turn() Player {
+	if u.turn == PlayerNone {
+		return PlayerOne
+	}
+	return u.turn
+}
+
+// Moves returns the free fields of all boards that can be chosen.
+func (u *ultimateTicTacToe) Moves() []string {
+	if u.decided() {
+		return nil
+	}
+	var moves []string
+	for b := range u.boards {
+		if !u.canChoose(b) {
+			continue
+		}
+		for _, f := range u.boards[b].Moves() {
+			moves = append(moves, strconv.Itoa(b+1)+f)
+		}
+	}
+	return moves
+}
+
+func (u *ultimateTicTacToe) Play(move string) error {
+	if len(move) != 2 || move[0] < '1' || move[0] > '9' || move[1] < '1' || move[1] > '9' {
+		return fmt.Errorf("%w: %q is not a board followed by a field", ErrInvalidMove, move)
+	}
+	board, cell := int(move[0]-'1'), int(move[1]-'1')
+
+	switch {
+	case u.Outcome().Done:
+		return fmt.Errorf("%w: the game is over", ErrIllegalMove)
+	case u.boards[board].done():
+		return fmt.Errorf("%w: board %d is already decided", ErrIllegalMove, board+1)
+	case !u.canChoose(board):
+		return fmt.Errorf("%w: the move must be on board %d", ErrIllegalMove, u.next)
+	case !u.boards[board].selectField(cell, u.Turn()):
+		return fmt.Errorf("%w: field %d of board %d is already taken", ErrIllegalMove, cell+1, board+1)
+	}
+
+	u.next = u.nextBoard(cell)
+	u.turn = u.Turn().Opponent()
+	u.history = append(u.history, board*9+cell)
+	return nil
+}
+
+func (u *ultimateTicTacToe) Skip() {
+	u.turn = u.Turn().Opponent()
+	u.history = append(u.history, -1)
+}
+
+// Undo also restores the small board of the next move, which is sent by the
+// latest move that was not skipped.
+func (u *ultimateTicTacToe) Undo() bool {
+	if len(u.history) == 0 {
+		return false
+	}
+	move := u.history[len(u.history)-1]
+	u.history = u.history[:len(u.history)-1]
+	u.turn = u.Turn().Opponent()
+	if move < 0 {
+		return true
+	}
+
+	u.boards[move/9].fields[move%9] = PlayerNone
+	u.next = 0
+	for i := len(u.history) - 1; i >= 0; i-- {
+		if u.history[i] >= 0 {
+			u.next = u.nextBoard(u.history[i] % 9)
+			break
+		}
+	}
+	return true
+}
+
+func (u *ultimateTicTacToe) Outcome() Outcome {
+	winner, _, _ := u.overall().hasWinner()
+	return Outcome{
+		Done:   u.decided(),
+		Winner: winner,
+	}
+}
+
+func (u *ultimateTicTacToe) State() any {
+	state := &smallBoardsState{
+		gridState: gridState{
+			Rows:   9,
+			Cols:   9,
+			Fields: make([]Player, 0, 81),
+			Labels: make([]string, 0, 81),
+		},
+		Boards:      u.overall().fields[:],
+		ActiveBoard: u.next,
+	}
+	for row := 0; row < 9; row++ {
+		for col := 0; col < 9; col++ {
+			board := row/3*3 + col/3
+			cell := row%3*3 + col%3
+			state.Fields = append(state.Fields, u.boards[board].fields[cell])
+			state.Labels = append(state.Labels, fmt.Sprintf("%d%d", board+1, cell+1))
+		}
+	}
+	return state
+}
+
+// Input expects two keys, but accepts a single one, so that the board can
+// still be requested with 0#. The command *0 requests it without the #.
+func (u *ultimateTicTacToe) Input() InputSpec {
+	spec := MoveInputSpec
+	spec.MaxLength = 2
+	return spec
+}
+
+// Fields returns the fields of the small board of the next move. If any board can be
+// chosen, the small boards are returned with their winners instead.
+func (u *ultimateTicTacToe) Fields() []field {
+	if u.next == 0 {
+		return u.overall().Fields()
+	}
+	fields := u.boards[u.next-1].Fields()
+	for i := range fields {
+		fields[i].Move = strconv.Itoa(u.next) + fields[i].Move
+	}
+	return fields
+}
+
+func (u *ultimateTicTacToe) Clone() Game {
+	clone := *u
+	clone.history = append([]int(nil), u.history...)
+	return &clone
+}
+
+// nextBoard returns the small board from 1 to 9 a move on the given, zero based
+// field sends the opponent to, 0 if that board is decided and any board can be chosen.
+func (u *ultimateTicTacToe) nextBoard(cell int) int {
+	if u.boards[cell].done() {
+		return 0
+	}
+	return cell + 1
+}
+
+// canChoose returns whether the next move can be on the given, zero based board.
+func (u *ultimateTicTacToe) canChoose(board int) bool {
+	if u.boards[board].done() {
+		return false
+	}
+	return u.next == 0 || u.next == board+1
+}
+
+// overall returns the large board, whose fields are the winners of the small boards.
+func (u *ultimateTicTacToe) overall() *ticTacToe {
+	var overall ticTacToe
+	for i := range u.boards {
+		overall.fields[i], _, _ = u.boards[i].hasWinner()
+	}
+	return &overall
+}
+
+// decided returns whether a player won three small boards in a row or
+// all small boards are decided.
+func (u *ultimateTicTacToe) decided() bool {
+	if _, _, ok := u.overall().hasWinner(); ok {
+		return true
+	}
+	for i := range u.boards {
+		if !u.boards[i].done() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package voipttt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// playMoves plays the moves one after another and fails the test if one of them is not possible.
+func playMoves(t *testing.T, g Game, moves ...string) {
+	t.Helper()
+	for _, move := range moves {
+		if err := g.Play(move); err != nil {
+			t.Fatalf("play %q: %v", move, err)
+		}
+	}
+}
+
+func TestUltimateTicTacToeSendsToBoard(t *testing.T) {
+	u := newUltimateTicTacToe().(*ultimateTicTacToe)
+	playMoves(t, u, "15")
+
+	if u.next != 5 {
+		t.Fatalf("got next board %d, want 5", u.next)
+	}
+	for _, move := range u.Moves() {
+		if !strings.HasPrefix(move, "5") {
+			t.Fatalf("got move %q outside of board 5", move)
+		}
+	}
+	if err := u.Play("11"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+
+	// Player two wins board 1 with its middle row, the following move on
+	// field 1 sends player two to the decided board, so any board can be chosen.
+	u = newUltimateTicTacToe().(*ultimateTicTacToe)
+	playMoves(t, u, "11", "14", "41", "15", "51", "16")
+	if winner, _, _ := u.boards[0].hasWinner(); winner != PlayerTwo {
+		t.Fatalf("got winner %v of board 1, want %v", winner, PlayerTwo)
+	}
+	playMoves(t, u, "61")
+	if u.next != 0 {
+		t.Fatalf("got next board %d, want any board", u.next)
+	}
+	for _, move := range u.Moves() {
+		if strings.HasPrefix(move, "1") {
+			t.Fatalf("got move %q on decided board 1", move)
+		}
+	}
+	if err := u.Play("17"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+	playMoves(t, u, "99")
+}
+
+func TestUltimateTicTacToeWin(t *testing.T) {
+	u := newUltimateTicTacToe().(*ultimateTicTacToe)
+	for _, b := range []int{0, 1} {
+		for _, f := range []int{0, 1, 2} {
+			u.boards[b].fields[f] = PlayerOne
+		}
+	}
+	u.boards[2].fields[0] = PlayerOne
+	u.boards[2].fields[1] = PlayerOne
+	u.next = 3
+
+	playMoves(t, u, "33")
+
+	if outcome := u.Outcome(); outcome != (Outcome{Done: true, Winner: PlayerOne}) {
+		t.Fatalf("got %+v, want a win of %v", outcome, PlayerOne)
+	}
+	if moves := u.Moves(); moves != nil {
+		t.Fatalf("got moves %v after the game is over", moves)
+	}
+	if err := u.Play("44"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestUltimateTicTacToeInvalidMoves(t *testing.T) {
+	for _, move := range []string{"", "1", "10", "a1", "123"} {
+		if err := newUltimateTicTacToe().Play(move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("move %q: got %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+
+	u := newUltimateTicTacToe()
+	playMoves(t, u, "55")
+	if err := u.Play("55"); !errors.Is(err, ErrIllegalMove) {
+		t.Fatalf("got %v, want %v", err, ErrIllegalMove)
+	}
+}
+
+func TestUltimateTicTacToeUndo(t *testing.T) {
+	u := newUltimateTicTacToe().(*ultimateTicTacToe)
+	if u.Undo() {
+		t.Fatal("undid a move before the first move")
+	}
+
+	playMoves(t, u, "15", "53")
+	u.Skip()
+
+	if !u.Undo() || u.Turn() != PlayerOne || u.next != 3 {
+		t.Fatalf("got turn %v and next board %d after undoing the skip", u.Turn(), u.next)
+	}
+	if !u.Undo() || u.Turn() != PlayerTwo || u.next != 5 || u.boards[4].fields[2] != PlayerNone {
+		t.Fatalf("got turn %v and next board %d after undoing the second move", u.Turn(), u.next)
+	}
+	if !u.Undo() || u.Turn() != PlayerOne || u.next != 0 || u.boards[0].fields[4] != PlayerNone {
+		t.Fatalf("got turn %v and next board %d after undoing the first move", u.Turn(), u.next)
+	}
+	if u.Undo() {
+		t.Fatal("undid more moves than were played")
+	}
+}
@@ -2,10 +2,10 @@ package voipttt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
-	"net/http"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,6 +15,8 @@ import (
 	"github.com/moby/moby/pkg/namesgenerator"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/n9v9/voip-ttt/audio"
 )
 
 // errCodeNotExist is a sentinel error representing the scenario that an entered code
@@ -29,6 +31,26 @@ const (
 	messageOpponentReady       webSocketMessage = "OPPONENT_READY"
 	messageTurnInfo            webSocketMessage = "TURN_INFO"
 	messageGameDone            webSocketMessage = "GAME_DONE"
+	messageAudioFormat         webSocketMessage = "AUDIO_FORMAT"
+	messageBoardState          webSocketMessage = "BOARD_STATE"
+	messageSetupRejected       webSocketMessage = "SETUP_REJECTED"
+	messageClock               webSocketMessage = "CLOCK"
+	messageInvalidMove         webSocketMessage = "INVALID_MOVE"
+	messageDrawOffered         webSocketMessage = "DRAW_OFFERED"
+	messageDrawDeclined        webSocketMessage = "DRAW_DECLINED"
+	messageTakebackRequested   webSocketMessage = "TAKEBACK_REQUESTED"
+	messageTakebackAccepted    webSocketMessage = "TAKEBACK_ACCEPTED"
+	messageTakebackDeclined    webSocketMessage = "TAKEBACK_DECLINED"
+	messageRematchVote         webSocketMessage = "REMATCH_VOTE"
+	messageRematchAnswered     webSocketMessage = "REMATCH_ANSWERED"
+	messageRematchDeclined     webSocketMessage = "REMATCH_DECLINED"
+
+	// Messages sent by the client.
+
+	messageSetup          webSocketMessage = "SETUP"
+	messageDrawAnswer     webSocketMessage = "DRAW_ANSWER"
+	messageTakebackAnswer webSocketMessage = "TAKEBACK_ANSWER"
+	messageRematchAnswer  webSocketMessage = "REMATCH_ANSWER"
 )
 
 type webSocketData struct {
@@ -36,6 +58,13 @@ type webSocketData struct {
 	Data any              `json:"data"`
 }
 
+// webSocketRequest is a message sent by the client. Data is decoded by the receiver,
+// e.g. by the game in case of the SETUP message.
+type webSocketRequest struct {
+	Type webSocketMessage `json:"type"`
+	Data json.RawMessage  `json:"data"`
+}
+
 type dataVerificationCode struct {
 	Code            VerificationCode `json:"code"`
 	CallPhoneNumber PhoneNumber      `json:"callPhoneNumber"`
@@ -49,30 +78,180 @@ type dataWaitForOpponent struct {
 type dataOpponentReady struct {
 	OpponentPhoneNumber AnonymizedPhoneNumber `json:"opponentPhoneNumber"`
 	PlayerHasFirstTurn  bool                  `json:"playerHasFirstTurn"`
+	// Game is the name of the game that is played.
+	Game string `json:"game"`
+	// Variant is the variant of the rules of the game, empty for the standard rules.
+	Variant string `json:"variant,omitempty"`
+	// Player is the player the client plays as, which is needed to read the state.
+	Player Player `json:"player"`
+	// State is the initial state of the game as it is shown to the player,
+	// see Game.State and hiddenGame.
+	State any `json:"state"`
+	// NeedsSetup is set if the players prepare their boards before the first move, see setupGame.
+	NeedsSetup bool `json:"needsSetup,omitempty"`
+	// Series is the score before the game, if the players play a series, see SeriesConfig.
+	Series *dataSeries `json:"series,omitempty"`
 }
 
 type dataTurnInfo struct {
-	SelectedDigit int  `json:"selectedDigit"`
-	IsPlayer      bool `json:"isPlayer"`
+	// Move are the keys entered by the player who made the move.
+	Move     string `json:"move"`
+	IsPlayer bool   `json:"isPlayer"`
+	// Result is the result of the move, if the game has any, see resultGame.
+	Result string `json:"result,omitempty"`
+	// TimeUp is set if the player ran out of time and the move was made for them.
+	// The move is empty if the turn was skipped, see ClockConfig.
+	TimeUp bool `json:"timeUp,omitempty"`
+	// State is the state of the game after the move as it is shown to the player,
+	// see Game.State and hiddenGame.
+	State any `json:"state"`
+}
+
+type dataBoardState struct {
+	// State is the current state of the game as it is shown to the player.
+	State any `json:"state"`
+}
+
+// dataClock is sent at the start of every turn if the time of the players is limited.
+type dataClock struct {
+	// IsPlayer is set if it is the turn of the player.
+	IsPlayer bool `json:"isPlayer"`
+	// TurnMs is the time in milliseconds left for the current turn.
+	TurnMs int64 `json:"turnMs"`
+	// Total is only set if the total time of the players is limited.
+	Total *dataClockTotal `json:"total,omitempty"`
+}
+
+type dataClockTotal struct {
+	PlayerMs   int64 `json:"playerMs"`
+	OpponentMs int64 `json:"opponentMs"`
+}
+
+// dataInvalidMove is sent to the player who entered a move that is not possible.
+type dataInvalidMove struct {
+	// Move are the keys entered by the player.
+	Move string `json:"move"`
+	// Reason explains why the move is not possible.
+	Reason string `json:"reason"`
+	// Action is what happens next: the player is asked for another move, a random
+	// move is made for them or they forfeit the game.
+	Action InvalidMovePolicy `json:"action"`
 }
 
+// dataDrawOffer is sent to both players when a draw is offered and when it is declined.
+type dataDrawOffer struct {
+	// IsPlayer is set if the player offered the draw.
+	IsPlayer bool `json:"isPlayer"`
+}
+
+// dataTakeback is sent to both players when a takeback is requested, accepted or declined.
+type dataTakeback struct {
+	// IsPlayer is set if the player requested the takeback.
+	IsPlayer bool `json:"isPlayer"`
+	// Reason is set if the takeback is not possible, in which case the opponent is not asked.
+	Reason string `json:"reason,omitempty"`
+}
+
+// dataRematchAnswer is sent to both players when a player answered the rematch vote.
+type dataRematchAnswer struct {
+	// IsPlayer is set if the player answered.
+	IsPlayer bool `json:"isPlayer"`
+	Accept   bool `json:"accept"`
+}
+
+// dataRematchDeclined is sent to both players when the rematch vote failed.
+type dataRematchDeclined struct {
+	// IsPlayer is set if the player declined or did not answer in time.
+	IsPlayer bool `json:"isPlayer"`
+}
+
+// dataAnswer is sent by the client to answer a request of the opponent, e.g. a draw offer.
+type dataAnswer struct {
+	Accept bool `json:"accept"`
+}
+
+type dataSetupRejected struct {
+	// Reason explains why the setup is not possible.
+	Reason string `json:"reason"`
+}
+
+// gameDoneReason describes why a game has ended.
+type gameDoneReason string
+
+const (
+	gameDoneCompleted   gameDoneReason = "COMPLETED"    // The game ended with a win or a draw.
+	gameDoneHangup      gameDoneReason = "HANGUP"       // A player hung up and forfeited the game.
+	gameDoneTimeout     gameDoneReason = "TIMEOUT"      // A player ran out of time and forfeited the game.
+	gameDoneInvalidMove gameDoneReason = "INVALID_MOVE" // A player entered an invalid move and forfeited the game.
+	gameDoneResign      gameDoneReason = "RESIGN"       // A player resigned.
+	gameDoneDrawAgreed  gameDoneReason = "DRAW_AGREED"  // The players agreed to a draw.
+)
+
 type dataGameDone struct {
-	HasWinner      bool `json:"hasWinner"`
-	IsPlayerWinner bool `json:"isPlayerWinner"`
+	HasWinner      bool           `json:"hasWinner"`
+	IsPlayerWinner bool           `json:"isPlayerWinner"`
+	Reason         gameDoneReason `json:"reason"`
+	// Series is the score after the game, if the players play a series, see SeriesConfig.
+	Series *dataSeries `json:"series,omitempty"`
+}
+
+// dataSeries is the score of a series from the perspective of the player.
+type dataSeries struct {
+	// Series is the number of the series, which starts at 1 and grows with each rematch.
+	Series int `json:"series"`
+	// Games is the number of games played in the series.
+	Games        int `json:"games"`
+	BestOf       int `json:"bestOf"`
+	PlayerWins   int `json:"playerWins"`
+	OpponentWins int `json:"opponentWins"`
+	Draws        int `json:"draws"`
+	// Done is set once no more games are played in the series.
+	Done bool `json:"done"`
 }
 
 type webSocketClient struct {
-	conn          *websocket.Conn
+	conn          *websocket.Conn // Nil for bots, see isBot.
 	connMu        *sync.Mutex     // Used to serialize concurrent write access.
-	incomingAudio *websocket.Conn // Incoming connection from asterisk-audio-fork.
+	incomingAudio audioStream     // Incoming audio of the call, e.g. from asterisk-audio-fork.
 	phoneNumber   PhoneNumber
-	getDigitURL   WebhookURL
-	heartbeatURL  WebhookURL
-	gameDoneURL   WebhookURL
-	gameStartURL  WebhookURL
+	gameType      string // Name of the game the client wants to play.
+	bot           string // Name of the bot the client wants to play against, empty for a human opponent.
+	call          CallSession
 	log           zerolog.Logger
 }
 
+// isBot returns whether the client is a program that makes its moves through its
+// CallSession, like the computer opponent, instead of a caller with a website.
+// The phone number of a bot is its name.
+func (wsc *webSocketClient) isBot() bool {
+	return wsc.conn == nil
+}
+
+// remoteAddr returns the address of the web socket connection of the client.
+func (wsc *webSocketClient) remoteAddr() string {
+	if wsc.isBot() {
+		return "bot:" + string(wsc.phoneNumber)
+	}
+	return wsc.conn.RemoteAddr().String()
+}
+
+// close closes the web socket connection of the client.
+func (wsc *webSocketClient) close() {
+	if wsc.conn != nil {
+		_ = wsc.conn.Close()
+	}
+}
+
+// hasHungUp returns whether the caller hung up.
+func (wsc *webSocketClient) hasHungUp() bool {
+	select {
+	case <-wsc.call.Done():
+		return true
+	default:
+		return false
+	}
+}
+
 // sendCode sends the verification code to the client.
 func (wsc *webSocketClient) sendCode(code VerificationCode, callPhoneNumber PhoneNumber) error {
 	return wsc.sendData(webSocketData{
@@ -97,42 +276,126 @@ func (wsc *webSocketClient) sendWaitForOpponent(gameRoomName string) error {
 }
 
 // sendOpponentReady notifies the client that an opponent has been found.
-// It sends the opponent's phone number as well as whether the player we send it to
+// It sends the opponent's phone number, the game and whether the player we send it to
 // has the first turn.
-func (wsc *webSocketClient) sendOpponentReady(phoneNumber PhoneNumber, playerHasFirstTurn bool) error {
+func (wsc *webSocketClient) sendOpponentReady(data *dataOpponentReady) error {
 	return wsc.sendData(webSocketData{
 		Type: messageOpponentReady,
-		Data: &dataOpponentReady{
-			OpponentPhoneNumber: phoneNumber.Anonymized(),
-			PlayerHasFirstTurn:  playerHasFirstTurn,
-		},
+		Data: data,
 	})
 }
 
-// sendTurnInfo sends information about the selected digit and who selected it.
-func (wsc *webSocketClient) sendTurnInfo(selectedDigit int, isPlayer bool) error {
+// sendTurnInfo sends information about the latest move and who made it.
+func (wsc *webSocketClient) sendTurnInfo(data *dataTurnInfo) error {
 	return wsc.sendData(webSocketData{
 		Type: messageTurnInfo,
-		Data: &dataTurnInfo{
-			SelectedDigit: selectedDigit,
-			IsPlayer:      isPlayer,
-		},
+		Data: data,
+	})
+}
+
+// sendBoardState sends the current state of the game outside of a move,
+// e.g. after a player finished their setup.
+func (wsc *webSocketClient) sendBoardState(state any) error {
+	return wsc.sendData(webSocketData{
+		Type: messageBoardState,
+		Data: &dataBoardState{State: state},
+	})
+}
+
+// sendSetupRejected notifies the client that its setup of the game is not possible.
+func (wsc *webSocketClient) sendSetupRejected(reason string) error {
+	return wsc.sendData(webSocketData{
+		Type: messageSetupRejected,
+		Data: &dataSetupRejected{Reason: reason},
+	})
+}
+
+// sendInvalidMove notifies the client that its move is not possible.
+func (wsc *webSocketClient) sendInvalidMove(data *dataInvalidMove) error {
+	return wsc.sendData(webSocketData{
+		Type: messageInvalidMove,
+		Data: data,
+	})
+}
+
+// sendDrawOffered notifies the client that a draw was offered.
+func (wsc *webSocketClient) sendDrawOffered(isPlayer bool) error {
+	return wsc.sendData(webSocketData{
+		Type: messageDrawOffered,
+		Data: &dataDrawOffer{IsPlayer: isPlayer},
+	})
+}
+
+// sendDrawDeclined notifies the client that the draw offer was declined and the game goes on.
+func (wsc *webSocketClient) sendDrawDeclined(isPlayer bool) error {
+	return wsc.sendData(webSocketData{
+		Type: messageDrawDeclined,
+		Data: &dataDrawOffer{IsPlayer: isPlayer},
+	})
+}
+
+// sendTakeback notifies the client about a takeback request,
+// which is one of the TAKEBACK messages.
+func (wsc *webSocketClient) sendTakeback(messageType webSocketMessage, data *dataTakeback) error {
+	return wsc.sendData(webSocketData{
+		Type: messageType,
+		Data: data,
+	})
+}
+
+// sendClock notifies the client about the time left at the start of a turn.
+func (wsc *webSocketClient) sendClock(data *dataClock) error {
+	return wsc.sendData(webSocketData{
+		Type: messageClock,
+		Data: data,
 	})
 }
 
 // sendGameDone notifies the client that the game has ended and how it has ended.
-func (wsc *webSocketClient) sendGameDone(hasWinner, isPlayerWinner bool) error {
+func (wsc *webSocketClient) sendGameDone(data *dataGameDone) error {
 	return wsc.sendData(webSocketData{
 		Type: messageGameDone,
-		Data: &dataGameDone{
-			HasWinner:      hasWinner,
-			IsPlayerWinner: isPlayerWinner,
-		},
+		Data: data,
+	})
+}
+
+// sendRematchVote asks the client whether the player wants to play another series.
+func (wsc *webSocketClient) sendRematchVote() error {
+	return wsc.sendData(webSocketData{
+		Type: messageRematchVote,
+	})
+}
+
+// sendRematchAnswered notifies the client that a player answered the rematch vote.
+func (wsc *webSocketClient) sendRematchAnswered(data *dataRematchAnswer) error {
+	return wsc.sendData(webSocketData{
+		Type: messageRematchAnswered,
+		Data: data,
+	})
+}
+
+// sendRematchDeclined notifies the client that no rematch is played.
+func (wsc *webSocketClient) sendRematchDeclined(isPlayer bool) error {
+	return wsc.sendData(webSocketData{
+		Type: messageRematchDeclined,
+		Data: &dataRematchDeclined{IsPlayer: isPlayer},
+	})
+}
+
+// sendAudioFormat notifies the client about the format of the audio frames that follow.
+func (wsc *webSocketClient) sendAudioFormat(format audio.Format) error {
+	return wsc.sendData(webSocketData{
+		Type: messageAudioFormat,
+		Data: format,
 	})
 }
 
 // sendData is the generic send method and should only be called by higher level send methods.
 func (wsc *webSocketClient) sendData(data webSocketData) error {
+	if wsc.conn == nil {
+		return nil
+	}
+
 	wsc.connMu.Lock()
 	defer wsc.connMu.Unlock()
 
@@ -151,8 +414,13 @@ func (wsc *webSocketClient) sendData(data webSocketData) error {
 	return nil
 }
 
-// sendAudio sends raw PCM audio data as a web socket binary frame to the client.
+// sendAudio sends raw PCM audio data as a web socket binary frame to the client,
+// in the format previously sent with sendAudioFormat.
 func (wsc *webSocketClient) sendAudio(data []byte) error {
+	if wsc.conn == nil {
+		return nil
+	}
+
 	wsc.connMu.Lock()
 	defer wsc.connMu.Unlock()
 	if err := wsc.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
@@ -161,12 +429,43 @@ func (wsc *webSocketClient) sendAudio(data []byte) error {
 	return nil
 }
 
+// receive reads the messages sent by the client and passes them to the given channel,
+// until the connection is closed or the context is cancelled.
+func (wsc *webSocketClient) receive(ctx context.Context, messages chan<- clientMessage) {
+	if wsc.conn == nil {
+		return
+	}
+	for {
+		msgType, data, err := wsc.conn.ReadMessage()
+		if err != nil {
+			wsc.log.Info().Err(err).Msg("Stopped receiving messages from client")
+			return
+		}
+		if msgType != websocket.TextMessage {
+			continue
+		}
+
+		var request webSocketRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			wsc.log.Warn().Err(err).Msg("Ignored malformed message from client")
+			continue
+		}
+		wsc.log.Info().Str("data_type", string(request.Type)).Msg("Received data from client")
+
+		select {
+		case <-ctx.Done():
+			return
+		case messages <- clientMessage{client: wsc, webSocketRequest: request}:
+		}
+	}
+}
+
 // webSocketManager manages all web socket connections to play the game.
 // Each method is concurrency safe.
 type webSocketManager struct {
 	codeCounter atomic.Uint64
 
-	pendingAudioConns   map[PhoneNumber]*websocket.Conn
+	pendingAudioConns   map[PhoneNumber]audioStream
 	pendingAudioConnsMu *sync.Mutex
 
 	// Mapping from a verification code to a client. Contains all clients that
@@ -178,8 +477,31 @@ type webSocketManager struct {
 	// to be matched with an opponent.
 	lookingForMatch chan *webSocketClient
 
+	// Webhook calls that have been registered and are still active.
+	// Used to find the call that was hung up.
+	activeCalls   map[*webhookCall]struct{}
+	activeCallsMu *sync.Mutex
+
 	// Phone number that is sent to the client, so the client knows which number to call.
 	callPhoneNumber PhoneNumber
+
+	// Set if the server is connected to the asterisk manager interface.
+	callMonitor *callMonitor
+
+	// Set if callers play against the computer when no opponent is found in time.
+	computer *ComputerConfig
+
+	// Bots that players can choose as their opponent, by name.
+	bots map[string]BotConfig
+
+	// Set if the time players have for their moves is limited.
+	clock *ClockConfig
+
+	// How invalid moves are handled, by name of the game, see defaultInvalidMoveConfig.
+	invalidMoves map[string]InvalidMoveConfig
+
+	// Set if two callers play a series of games.
+	series *SeriesConfig
 }
 
 // newManager matches two web socket connections so that they can
@@ -187,16 +509,20 @@ type webSocketManager struct {
 func newManager(callPhoneNumber PhoneNumber) *webSocketManager {
 	return &webSocketManager{
 		codeCounter:         atomic.Uint64{},
-		pendingAudioConns:   map[PhoneNumber]*websocket.Conn{},
+		pendingAudioConns:   map[PhoneNumber]audioStream{},
 		pendingAudioConnsMu: new(sync.Mutex),
 		waitingForCode:      map[VerificationCode]*webSocketClient{},
 		waitingForCodeMu:    new(sync.Mutex),
 		lookingForMatch:     make(chan *webSocketClient),
+		activeCalls:         map[*webhookCall]struct{}{},
+		activeCallsMu:       new(sync.Mutex),
 		callPhoneNumber:     callPhoneNumber,
+		bots:                map[string]BotConfig{},
+		invalidMoves:        map[string]InvalidMoveConfig{},
 	}
 }
 
-func (wsm *webSocketManager) registerAudioConnection(phoneNumber PhoneNumber, conn *websocket.Conn) {
+func (wsm *webSocketManager) registerAudioConnection(phoneNumber PhoneNumber, conn audioStream) {
 	wsm.pendingAudioConnsMu.Lock()
 	defer wsm.pendingAudioConnsMu.Unlock()
 	wsm.pendingAudioConns[phoneNumber] = conn
@@ -209,12 +535,18 @@ func (wsm *webSocketManager) removeAudioConnection(phoneNumber PhoneNumber) {
 }
 
 // handleClient takes over the communication with the client and handles signalling,
-// matching them with another client and playing the game.
-func (wsm *webSocketManager) handleClient(conn *websocket.Conn) {
+// matching them with another client that wants to play the same game, or with the
+// given bot if it is not empty, and playing the game.
+func (wsm *webSocketManager) handleClient(conn *websocket.Conn, gameType, bot string) {
 	client := &webSocketClient{
-		conn:   conn,
-		connMu: new(sync.Mutex),
-		log:    log.Logger.With().Str("websocket_addr", conn.RemoteAddr().String()).Logger(),
+		conn:     conn,
+		connMu:   new(sync.Mutex),
+		gameType: gameType,
+		bot:      bot,
+		log: log.Logger.With().
+			Str("websocket_addr", conn.RemoteAddr().String()).
+			Str("game", gameType).
+			Logger(),
 	}
 
 	client.log.Info().Msg("Handle new client")
@@ -232,9 +564,9 @@ func (wsm *webSocketManager) handleClient(conn *websocket.Conn) {
 }
 
 // verifyCode notifies the webSocketManager that the client has called the displayed
-// phone number and entered the displayed code. It then sets up the given
-// webhooks which are used to notify the calling client of events like prompting
-// for a new digit or notifying that the game is done.
+// phone number and entered the displayed code. The given call session is then
+// used to communicate with the calling client, e.g. prompting for a new digit
+// or notifying that the game is done.
 //
 // If the code exists, the frontend will be notified.
 //
@@ -242,10 +574,7 @@ func (wsm *webSocketManager) handleClient(conn *websocket.Conn) {
 func (wsm *webSocketManager) verifyCode(
 	code VerificationCode,
 	clientPhoneNumber PhoneNumber,
-	selectDigitURL WebhookURL,
-	heartbeatURL WebhookURL,
-	gameDoneURL WebhookURL,
-	gameStartURL WebhookURL,
+	call CallSession,
 ) error {
 	wsm.waitingForCodeMu.Lock()
 	defer wsm.waitingForCodeMu.Unlock()
@@ -256,10 +585,7 @@ func (wsm *webSocketManager) verifyCode(
 	}
 
 	client.phoneNumber = clientPhoneNumber
-	client.getDigitURL = selectDigitURL
-	client.heartbeatURL = heartbeatURL
-	client.gameDoneURL = gameDoneURL
-	client.gameStartURL = gameStartURL
+	client.call = call
 
 	client.log.Info().Uint64("code", uint64(code)).Msg("Client verified code")
 
@@ -269,6 +595,45 @@ func (wsm *webSocketManager) verifyCode(
 	return nil
 }
 
+// trackCall keeps track of the webhook call until it is over, so that it can be
+// found when asterisk reports that it was hung up.
+func (wsm *webSocketManager) trackCall(call *webhookCall) {
+	wsm.activeCallsMu.Lock()
+	defer wsm.activeCallsMu.Unlock()
+
+	wsm.activeCalls[call] = struct{}{}
+	call.release = func() {
+		wsm.activeCallsMu.Lock()
+		defer wsm.activeCallsMu.Unlock()
+		delete(wsm.activeCalls, call)
+	}
+}
+
+// hangup notifies the webhook call that was hung up.
+// The call is identified by its channel or, if it did not register its channel,
+// by its phone number.
+func (wsm *webSocketManager) hangup(channel string, phoneNumber PhoneNumber) {
+	wsm.activeCallsMu.Lock()
+	var found *webhookCall
+	for call := range wsm.activeCalls {
+		if call.channel != "" && call.channel == channel {
+			found = call
+			break
+		}
+		if call.channel == "" && phoneNumber != "" && call.phoneNumber == phoneNumber {
+			found = call
+		}
+	}
+	wsm.activeCallsMu.Unlock()
+
+	if found == nil {
+		return
+	}
+
+	found.log.Info().Str("channel", channel).Msg("Client hung up")
+	found.markHungUp()
+}
+
 // runClientMatcher receives clients over the given channel and matches two clients so that they
 // can play a game against each other.
 func (wsm *webSocketManager) runClientMatcher(ctx context.Context) {
@@ -282,14 +647,22 @@ func (wsm *webSocketManager) runClientMatcher(ctx context.Context) {
 		if err := (*client).sendWaitForOpponent(roomName); err != nil {
 			(*client).log.Err(err).Msg("Failed to send waiting for opponent notification")
 			_ = (*client).conn.Close()
-			// This sets either first or second to nil, effectively continuing the search
+			// This sets the waiting or the matched client to nil, effectively continuing the search
 			// for a matching client.
 			*client = nil
+			return
+		}
+		if err := (*client).call.Announce(ctx, Announcement{
+			Type: string(messageSendWaitForOpponent),
+			Data: &dataWaitForOpponent{
+				GameRoomName:      roomName,
+				PlayerPhoneNumber: (*client).phoneNumber,
+			},
+		}); err != nil {
+			(*client).log.Err(err).Msg("Failed to announce waiting for opponent")
 		}
 	}
 
-	var first, second *webSocketClient
-
 	getRandomRoomName := func() string {
 		name := strings.Fields(strings.ReplaceAll(namesgenerator.GetRandomName(0), "_", " "))
 		adjective := strings.ToUpper(string(name[0][0])) + name[0][1:]
@@ -298,59 +671,178 @@ func (wsm *webSocketManager) runClientMatcher(ctx context.Context) {
 	}
 
 	rand.Seed(time.Now().Unix())
-	roomName := getRandomRoomName()
+
+	// Each game has its own room, in which a single client waits for an opponent.
+	type room struct {
+		name    string
+		waiting *webSocketClient
+	}
+	rooms := map[string]*room{}
+
+	// Receives clients that waited for an opponent longer than configured for the computer.
+	waitedTooLong := make(chan *webSocketClient)
+	playComputerAfterWait := func(client *webSocketClient) {
+		if wsm.computer == nil || client == nil {
+			return
+		}
+		time.AfterFunc(wsm.computer.Wait, func() {
+			select {
+			case <-ctx.Done():
+			case waitedTooLong <- client:
+			}
+		})
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+
+		case client := <-waitedTooLong:
+			r, ok := rooms[client.gameType]
+			if !ok || r.waiting != client {
+				// Matched with another client in the meantime.
+				continue
+			}
+			delete(rooms, client.gameType)
+
+			if client.hasHungUp() {
+				client.log.Info().Msg("Client hung up while waiting for opponent")
+				_ = client.conn.Close()
+				continue
+			}
+
+			rules, err := newGame(client.gameType)
+			if err != nil {
+				// Only known games are accepted by the public API.
+				client.log.Err(err).Msg("Failed to create game")
+				_ = client.conn.Close()
+				continue
+			}
+			client.log.Info().Msg("No opponent found in time, playing against the computer")
+			wsm.startGame(ctx, client, newComputerClient(rules, client.gameType, *wsm.computer), rules)
+
 		case client, ok := <-wsm.lookingForMatch:
 			if !ok {
 				return
 			}
-			if first == nil {
-				first = client
-				sendWaitMessage(&first, roomName)
-			} else if second == nil {
-				second = client
-				sendWaitMessage(&second, roomName)
+
+			if client.bot != "" {
+				sendWaitMessage(&client, getRandomRoomName())
+				if client != nil {
+					go wsm.startBotGame(ctx, client)
+				}
+				continue
 			}
+
+			r, ok := rooms[client.gameType]
+			if !ok {
+				r = &room{name: getRandomRoomName()}
+				rooms[client.gameType] = r
+			}
+
+			// Do not match with a client that hung up while waiting for an opponent.
+			if r.waiting != nil && r.waiting.hasHungUp() {
+				r.waiting.log.Info().Msg("Client hung up while waiting for opponent")
+				_ = r.waiting.conn.Close()
+				r.waiting = nil
+			}
+			if r.waiting == nil {
+				r.waiting = client
+				sendWaitMessage(&r.waiting, r.name)
+				playComputerAfterWait(r.waiting)
+				continue
+			}
+
+			second := client
+			sendWaitMessage(&second, r.name)
+			if second == nil {
+				continue
+			}
+
 			// Matched two clients.
 			// Start their game and wait for the next two players.
-			if first != nil && second != nil {
-				gameLogger := log.Logger.With().
-					Str("first_addr", first.conn.RemoteAddr().String()).
-					Str("second_addr", second.conn.RemoteAddr().String()).
-					Logger()
-
-				gameLogger.Info().Msg("Matched clients")
-
-				g := game{
-					playerOne: first,
-					playerTwo: second,
-					log:       gameLogger,
-				}
-
-				var wg sync.WaitGroup
-				wg.Add(2)
-				wsm.startAudioStream(ctx, &wg, g.playerOne)
-				wsm.startAudioStream(ctx, &wg, g.playerTwo)
-				wg.Wait()
-
-				go func() {
-					g.run()
-					wsm.removeAudioConnection(g.playerOne.phoneNumber)
-					wsm.removeAudioConnection(g.playerTwo.phoneNumber)
-				}()
-
-				first = nil
-				second = nil
-				roomName = getRandomRoomName()
+			first := r.waiting
+			delete(rooms, client.gameType)
+
+			rules, err := newGame(client.gameType)
+			if err != nil {
+				// Only known games are accepted by the public API.
+				client.log.Err(err).Msg("Failed to create game")
+				_ = first.conn.Close()
+				_ = second.conn.Close()
+				continue
 			}
+			wsm.startGame(ctx, first, second, rules)
 		}
 	}
 }
 
+// startBotGame starts the bot the client chose and their game.
+func (wsm *webSocketManager) startBotGame(ctx context.Context, client *webSocketClient) {
+	fail := func(err error, msg string) {
+		client.log.Err(err).Str("bot", client.bot).Msg(msg)
+		_ = client.conn.Close()
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+		if err := client.call.Hangup(ctx); err != nil {
+			client.log.Err(err).Msg("Failed to hang up call")
+		}
+	}
+
+	rules, err := newGame(client.gameType)
+	if err != nil {
+		// Only known games are accepted by the public API.
+		fail(err, "Failed to create game")
+		return
+	}
+	bot, err := newBotClient(wsm.bots[client.bot], rules, client.gameType)
+	if err != nil {
+		fail(err, "Failed to start bot")
+		return
+	}
+	wsm.startGame(ctx, client, bot, rules)
+}
+
+// startGame starts the game between the two clients in the background.
+func (wsm *webSocketManager) startGame(ctx context.Context, first, second *webSocketClient, rules Game) {
+	gameLogger := log.Logger.With().
+		Str("first_addr", first.remoteAddr()).
+		Str("second_addr", second.remoteAddr()).
+		Str("game", first.gameType).
+		Logger()
+
+	gameLogger.Info().Msg("Matched clients")
+
+	g := newGameSession(first, second, rules, gameLogger)
+	if wsm.clock != nil {
+		g.clock = newMoveClock(*wsm.clock)
+	}
+	if config, ok := wsm.invalidMoves[first.gameType]; ok {
+		g.invalidMove = config
+	}
+	// Bots only know the rules of the game they were started with.
+	if wsm.series != nil && !first.isBot() && !second.isBot() {
+		g.series = newSeries(*wsm.series)
+	}
+
+	// Bots have no audio stream.
+	var wg sync.WaitGroup
+	for _, client := range []*webSocketClient{g.playerOne, g.playerTwo} {
+		if !client.isBot() {
+			wg.Add(1)
+			wsm.startAudioStream(ctx, &wg, client)
+		}
+	}
+	wg.Wait()
+
+	go func() {
+		g.run(ctx)
+		wsm.removeAudioConnection(g.playerOne.phoneNumber)
+		wsm.removeAudioConnection(g.playerTwo.phoneNumber)
+	}()
+}
+
 func (wsm *webSocketManager) startAudioStream(
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -358,11 +850,8 @@ func (wsm *webSocketManager) startAudioStream(
 ) {
 	defer wg.Done()
 
-	if _, err := http.Get(string(client.gameStartURL)); err != nil {
-		client.log.Err(err).
-			Str("webhook", string(client.gameStartURL)).
-			Str("http_method", "GET").
-			Msg("Failed HTTP request to game start webhook")
+	if err := client.call.StartAudio(ctx); err != nil {
+		client.log.Err(err).Msg("Failed to start audio stream of call")
 	}
 
 	for {
@@ -375,7 +864,7 @@ func (wsm *webSocketManager) startAudioStream(
 			client.log = client.log.With().
 				Str("incoming_audio", audioConn.RemoteAddr().String()).
 				Logger()
-			client.log.Info().Msg("Matched client web socket with incoming audio web socket")
+			client.log.Info().Msg("Matched client web socket with incoming audio stream")
 			break
 		}
 
@@ -385,6 +874,9 @@ func (wsm *webSocketManager) startAudioStream(
 		select {
 		case <-ctx.Done():
 			return
+		case <-client.call.Done():
+			client.log.Info().Msg("Client hung up before its audio stream connected")
+			return
 		case <-time.After(time.Millisecond * 200):
 		}
 	}